@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	_ "github.com/lib/pq"
 
 	"file-manager/auth"
+	"file-manager/domain/file"
 	"file-manager/metadata"
 	"file-manager/storage"
 	"file-manager/telemetry"
@@ -24,6 +26,9 @@ type App struct {
 	config         *AppConfig
 	storageManager *storage.StorageManager
 	metadataStore  metadata.MetadataStore
+	fileRepo       *file.FileRepo
+	registry       *auth.Registry
+	tls            *certReloader // nil when serving plain HTTP
 }
 
 // GetRouter returns the router for testing purposes
@@ -43,10 +48,36 @@ func New(config *AppConfig) *App {
 	}
 	app.storageManager = storageManager
 
-	// Initialize Metadata Store (using in-memory for demo)
-	metadataStore := metadata.NewInMemoryMetadataStore()
+	// Initialize Metadata Store (using in-memory for demo), recording every change
+	history := metadata.NewInMemoryHistoryStore()
+	metadataStore := metadata.NewAuditedStore(metadata.NewInMemoryMetadataStore(), history)
 	app.metadataStore = metadataStore
 
+	fileRepo, err := file.NewFileRepo(storageManager, metadataStore, history, file.NewInMemoryShareStore(), config)
+	if err != nil {
+		log.Fatalf("Failed to create file repository: %v", err)
+	}
+	app.fileRepo = fileRepo
+
+	// Initialize the server registry used for authentication
+	serverStore, err := app.loadServerStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize server store: %v", err)
+	}
+	app.registry = auth.NewRegistry(serverStore)
+	if err := app.registry.Bootstrap(context.Background(), config); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	// Serve HTTPS, and accept client certificates, when configured
+	if config.TLS.CertFile != "" {
+		reloader, err := newCertReloader(config.TLS)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificates: %v", err)
+		}
+		app.tls = reloader
+	}
+
 	app.loadMiddleware()
 	app.loadRoutes()
 	return app
@@ -61,15 +92,30 @@ func (a *App) Start(ctx context.Context) error {
 		Handler: a.router,
 	}
 
+	if a.tls != nil {
+		server.TLSConfig = a.tls.serverConfig()
+		go a.tls.watch(ctx, a.config.TLS.ReloadInterval)
+	}
+
 	// Database connection is now established in New()
 	logger.Info("Starting application server...")
 
+	// Background jobs (lifecycle rules, trash purge, orphan GC) run until shutdown
+	go a.fileRepo.RunLifecycleSweeper(ctx, a.config.Lifecycle.SweepInterval)
+	go a.fileRepo.RunTrashPurger(ctx, a.config.Trash.PurgeInterval)
+	go a.fileRepo.RunGarbageCollector(ctx, a.config.GC.Interval, a.config.GC.DryRun)
+
 	ch := make(chan error, 1)
 
 	// Call the main function using another thread
 	go func() {
 		// Handle error on startup
-		err := server.ListenAndServe()
+		var err error
+		if a.tls != nil {
+			err = server.ListenAndServeTLS("", "") // Certificates come from server.TLSConfig
+		} else {
+			err = server.ListenAndServe()
+		}
 		if err != nil {
 			ch <- fmt.Errorf("failed to start server: %w", err)
 		}
@@ -102,27 +148,110 @@ func (a *App) Start(ctx context.Context) error {
 	}
 }
 
+// authenticators builds the authentication chain: client certificates when client CAs are
+// configured, signed requests, API keys, OIDC bearer tokens when an issuer is configured,
+// and server PINs, throttled by failed attempts.
+func (a *App) authenticators() auth.Chain {
+	var chain auth.Chain
+	if a.tls != nil && a.config.TLS.ClientCAFile != "" {
+		chain = append(chain, auth.CertificateAuthenticator{Registry: a.registry})
+	}
+	chain = append(chain,
+		auth.SignatureAuthenticator{Registry: a.registry, Nonces: auth.NewInMemoryNonceCache(), MaxSkew: a.config.Auth.SignatureMaxSkew},
+		auth.APIKeyAuthenticator{Registry: a.registry},
+	)
+	if a.config.Auth.OIDC.Issuer != "" {
+		oidc, err := auth.NewOIDCAuthenticator(a.config.Auth.OIDC, a.registry)
+		if err != nil {
+			log.Fatalf("Invalid OIDC configuration: %v", err)
+		}
+		if err := oidc.Refresh(context.Background()); err != nil {
+			log.Printf("OIDC keys are not available yet: %v", err)
+		}
+		chain = append(chain, oidc)
+	}
+	return append(chain, auth.PINAuthenticator{Registry: a.registry, Throttle: auth.NewLoginThrottle(a.config.Auth.Lockout)})
+}
+
+// loadServerStore opens the configured server store. The postgres store also opens the
+// application's database connection.
+func (a *App) loadServerStore() (auth.ServerStore, error) {
+	switch a.config.Auth.ServerStore {
+	case "file":
+		return auth.NewFileServerStore(a.config.Auth.ServerStoreFile)
+	case "postgres":
+		db, err := sql.Open("postgres", a.config.LoadDbUri())
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Ping(); err != nil {
+			return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+		}
+		a.db = db
+		return auth.NewPostgresServerStore(context.Background(), db)
+	default:
+		return nil, fmt.Errorf("unknown SERVER_STORE %q (supported: file, postgres)", a.config.Auth.ServerStore)
+	}
+}
+
 func (a *App) loadMiddleware() {
 	router := echo.New()
+	router.IPExtractor = a.ipExtractor()
 	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger())
 	router.Use(telemetry.Tracing())
 	router.Use(middleware.Recover())
 	router.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(1000)))
-	router.GET("/health", func(c echo.Context) error {
-		return c.String(http.StatusOK, "Ok")
-	})
-	router.Use(auth.ServerAuthMiddleware())
 
 	a.router = router
 }
 
+// ipExtractor returns how the client IP of a request is found, as used for PIN lockouts,
+// rate limiting and share access logs. Without trusted proxies it is the IP of the
+// connection, since clients could put anything in X-Forwarded-For; with them it is the
+// last X-Forwarded-For entry not added by a trusted proxy.
+func (a *App) ipExtractor() echo.IPExtractor {
+	if len(a.config.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range a.config.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES entry %q: %v", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// loadRoutes registers the routes. Only the health check and share links are served
+// without authentication.
 func (a *App) loadRoutes() {
+	authenticated := auth.ServerAuthMiddleware(a.registry, a.authenticators())
+
+	a.router.GET("/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "Ok")
+	})
 	a.router.GET("/", func(c echo.Context) error {
 		return c.String(http.StatusOK, "File Manager Service.")
-	})
+	}, authenticated)
+
+	// Share links for external recipients
+	a.loadShareRoutes(a.router.Group("/s"))
 
 	// App V1
-	fileGroup := a.router.Group("/v1/files")
+	v1 := a.router.Group("/v1", authenticated)
+
+	fileGroup := v1.Group("/files")
 	a.loadFileRoutes(fileGroup)
+
+	folderGroup := v1.Group("/folders")
+	a.loadFolderRoutes(folderGroup)
+
+	keyGroup := v1.Group("/keys", auth.RequirePermission(auth.PermKeysManage))
+	a.loadKeyRoutes(keyGroup)
+
+	adminGroup := v1.Group("/admin")
+	a.loadAdminRoutes(adminGroup)
 }
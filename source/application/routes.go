@@ -1,9 +1,9 @@
 package application
 
 import (
-	"log"
-
+	"file-manager/auth"
 	"file-manager/domain/file"
+	"file-manager/domain/server"
 	"file-manager/storage"
 
 	"github.com/labstack/echo/v4"
@@ -14,14 +14,88 @@ func (a *App) loadStorageManager() (*storage.StorageManager, error) {
 }
 
 func (a *App) loadFileRoutes(g *echo.Group) {
-	fileRepo, err := file.NewFileRepo(a.storageManager, a.metadataStore, a.config)
-	if err != nil {
-		log.Fatalf("Failed to create file repository: %v", err)
-	}
+	fileHandler := file.NewFileHandler(a.fileRepo)
+	read := auth.RequirePermission(auth.PermFilesRead)
+	write := auth.RequirePermission(auth.PermFilesWrite)
+	del := auth.RequirePermission(auth.PermFilesDelete)
+	share := auth.RequirePermission(auth.PermFilesShare)
+	hold := auth.RequirePermission(auth.PermFilesHold)
+	templates := auth.RequirePermission(auth.PermTemplatesManage)
+
+	g.POST("", fileHandler.UploadFile, write)
+	g.GET("", fileHandler.ListFiles, read)
+	g.GET("/trash", fileHandler.ListTrash, read)
+	g.GET("/usage", fileHandler.GetUsage, read)
+	g.GET("/:id", fileHandler.GetFileMetadata, read)
+	g.PATCH("/:id", fileHandler.UpdateFileMetadata, write)
+	g.GET("/:id/history", fileHandler.FileHistory, read)
+	g.DELETE("/:id", fileHandler.DeleteFile, del)
+	g.GET("/:id/download", fileHandler.DownloadFile, read)
+	g.GET("/:id/url", fileHandler.PresignDownload, read)
+	g.POST("/:id/copy", fileHandler.CopyFile, write)
+	g.POST("/:id/move", fileHandler.MoveFile, write)
+	g.POST("/:id/restore", fileHandler.RestoreFile, write)
+	g.POST("/:id/shares", fileHandler.CreateShare, share)
+	g.GET("/:id/shares", fileHandler.ListShares, share)
+	g.GET("/:id/shares/:share_id", fileHandler.GetShare, share)
+	g.DELETE("/:id/shares/:share_id", fileHandler.RevokeShare, share)
+	g.GET("/:id/acl", fileHandler.GetFileACL, read)
+	g.PUT("/:id/acl", fileHandler.SetFileACL, write)
+	g.PUT("/:id/legal-hold", fileHandler.SetLegalHold, hold)
+	g.DELETE("/:id/legal-hold", fileHandler.ReleaseLegalHold, hold)
+	g.POST("/render-template", fileHandler.Insert, templates)
+	g.POST("/preview", fileHandler.PreviewTemplate, templates)
+
+}
+
+// loadShareRoutes registers the public share link downloads; POST submits the passcode
+// form.
+func (a *App) loadShareRoutes(g *echo.Group) {
+	fileHandler := file.NewFileHandler(a.fileRepo)
+
+	g.GET("/:token", fileHandler.DownloadShare)
+	g.POST("/:token", fileHandler.DownloadShare)
+}
 
-	fileHandler := file.NewFileHandler(fileRepo)
+func (a *App) loadKeyRoutes(g *echo.Group) {
+	serverHandler := server.NewServerHandler(a.registry)
+
+	g.GET("", serverHandler.ListAPIKeys)
+	g.POST("", serverHandler.CreateAPIKey)
+	g.DELETE("/:key_id", serverHandler.RevokeAPIKey)
+}
+
+func (a *App) loadAdminRoutes(g *echo.Group) {
+	fileHandler := file.NewFileHandler(a.fileRepo)
+
+	g.POST("/gc", fileHandler.CollectOrphans, auth.RequirePermission(auth.PermStorageManage))
+
+	serverHandler := server.NewServerHandler(a.registry)
+	servers := auth.RequirePermission(auth.PermServersManage)
+	g.GET("/servers", serverHandler.ListServers, servers)
+	g.POST("/servers", serverHandler.RegisterServer, servers)
+	g.POST("/servers/:id/rotate", serverHandler.RotatePIN, servers)
+	g.POST("/servers/:id/disable", serverHandler.DisableServer, servers)
+	g.POST("/servers/:id/enable", serverHandler.EnableServer, servers)
+	g.GET("/servers/:id/keys", serverHandler.ListAPIKeys, servers)
+	g.POST("/servers/:id/keys", serverHandler.CreateAPIKey, servers)
+	g.DELETE("/servers/:id/keys/:key_id", serverHandler.RevokeAPIKey, servers)
+
+	// Roles are shared by every tenant, so only platform admins change them
+	roles := auth.RequirePermission(auth.PermRolesManage)
+	platform := auth.RequirePermission(auth.PermPlatformAdmin)
+	g.GET("/roles", serverHandler.ListRoles, roles)
+	g.PUT("/roles/:name", serverHandler.PutRole, roles, platform)
+	g.DELETE("/roles/:name", serverHandler.DeleteRole, roles, platform)
+}
 
-	g.POST("/render-template", fileHandler.Insert)
-	g.POST("/preview", fileHandler.PreviewTemplate)
+func (a *App) loadFolderRoutes(g *echo.Group) {
+	fileHandler := file.NewFileHandler(a.fileRepo)
 
+	g.GET("", fileHandler.ListFolder, auth.RequirePermission(auth.PermFilesRead))
+	g.POST("", fileHandler.CreateFolder, auth.RequirePermission(auth.PermFilesWrite))
+	g.POST("/move", fileHandler.MoveFolder, auth.RequirePermission(auth.PermFilesWrite))
+	g.DELETE("", fileHandler.DeleteFolder, auth.RequirePermission(auth.PermFilesDelete))
+	g.GET("/acl", fileHandler.GetFolderACL, auth.RequirePermission(auth.PermFilesRead))
+	g.PUT("/acl", fileHandler.SetFolderACL, auth.RequirePermission(auth.PermFilesWrite))
 }
@@ -0,0 +1,137 @@
+package application
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"file-manager/config"
+)
+
+// certReloader holds the TLS configuration built from the certificate, key and client
+// CA files, and rebuilds it when the files change, so renewed certificates and rotated
+// CAs take effect without a restart. Handshakes always use the latest configuration.
+type certReloader struct {
+	cfg      config.TLSConfig
+	current  atomic.Pointer[tls.Config]
+	modTimes map[string]time.Time // Of the files behind current; only touched by load
+}
+
+// newCertReloader loads the files once, failing on any error.
+func newCertReloader(cfg config.TLSConfig) (*certReloader, error) {
+	if cfg.KeyFile == "" {
+		return nil, fmt.Errorf("TLS_KEY_FILE is required with TLS_CERT_FILE")
+	}
+	if cfg.ClientAuth != "optional" && cfg.ClientAuth != "require" {
+		return nil, fmt.Errorf("unknown TLS_CLIENT_AUTH %q (supported: optional, require)", cfg.ClientAuth)
+	}
+	r := &certReloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// serverConfig is the configuration handed to http.Server. It defers every handshake to
+// the current configuration.
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// files lists the files the configuration is built from.
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// load builds the configuration from the files and swaps it in.
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.ClientAuth == "require" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r.current.Store(tlsConfig)
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any file was modified since the last successful load.
+func (r *certReloader) changed() bool {
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the configuration whenever the files change, until ctx is done. A
+// failed reload keeps the previous configuration and is retried on the next check,
+// which covers certificate and key files being replaced one after the other.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.load(); err != nil {
+				log.Printf("TLS reload failed, keeping the previous certificates: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificates")
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package application
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"file-manager/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate with its key, signed by the CA it was issued from.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issueCert returns a certificate for template, self-signed when ca is nil.
+func issueCert(t *testing.T, ca *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func newTestCA(t *testing.T, name string) *testCert {
+	return issueCert(t, nil, &x509.Certificate{
+		Subject: pkix.Name{CommonName: name}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	})
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func writeFile(t *testing.T, path string, data ...[]byte) {
+	t.Helper()
+	var content []byte
+	for _, d := range data {
+		content = append(content, d...)
+	}
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca, otherCA := newTestCA(t, "Client CA"), newTestCA(t, "Other CA")
+	server := issueCert(t, ca, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientOf := func(issuer *testCert, name string) *testCert {
+		return issueCert(t, issuer, &x509.Certificate{
+			Subject: pkix.Name{CommonName: name}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+	}
+	calculator, analytics := clientOf(ca, "calculator-server"), clientOf(otherCA, "analytics-server")
+
+	keyDER, err := x509.MarshalECPrivateKey(server.key)
+	require.NoError(t, err)
+	cfg := config.TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "client-ca.pem"),
+		ClientAuth:   "optional",
+	}
+	writeFile(t, cfg.CertFile, server.certPEM())
+	writeFile(t, cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	writeFile(t, cfg.ClientCAFile, ca.certPEM())
+
+	reloader, err := newCertReloader(cfg)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}
+	}))
+	srv.TLS = reloader.serverConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	// get returns the client certificate's name as seen by the server
+	get := func(client *testCert) (string, error) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if client != nil {
+			// Send the certificate even when the server does not list its CA, as curl does
+			cert := client.tlsCertificate()
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &cert, nil
+			}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := httpClient.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	name, err := get(calculator)
+	require.NoError(t, err)
+	assert.Equal(t, "calculator-server", name)
+	name, err = get(nil)
+	require.NoError(t, err, "client certificates are optional")
+	assert.Empty(t, name)
+	_, err = get(analytics)
+	assert.Error(t, err, "certificates of untrusted CAs fail the handshake")
+
+	// Trusting another CA takes effect once the changed file is reloaded
+	assert.False(t, reloader.changed())
+	writeFile(t, cfg.ClientCAFile, ca.certPEM(), otherCA.certPEM())
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(cfg.ClientCAFile, later, later))
+	require.True(t, reloader.changed())
+	require.NoError(t, reloader.load())
+	name, err = get(analytics)
+	require.NoError(t, err)
+	assert.Equal(t, "analytics-server", name)
+
+	// A broken file keeps the previous configuration
+	writeFile(t, cfg.ClientCAFile, []byte("not a certificate"))
+	assert.Error(t, reloader.load())
+	name, err = get(analytics)
+	require.NoError(t, err)
+	assert.Equal(t, "analytics-server", name)
+}
+
+func TestNewCertReloaderRejectsInvalidConfig(t *testing.T) {
+	for _, cfg := range []config.TLSConfig{
+		{CertFile: "server.crt", ClientAuth: "optional"},
+		{CertFile: "server.crt", KeyFile: "server.key", ClientAuth: "always"},
+		{CertFile: filepath.Join(t.TempDir(), "missing.crt"), KeyFile: "server.key", ClientAuth: "optional"},
+	} {
+		_, err := newCertReloader(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
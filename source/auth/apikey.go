@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"file-manager/auth/signing"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for unknown API key IDs.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKey is returned for API key requests with a bad name, scope or expiry.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// Scopes limit what an API key can do. PIN authentication is not limited by scopes.
+const (
+	ScopeFilesRead      = "files:read"      // Read metadata, download, list and search
+	ScopeFilesWrite     = "files:write"     // Upload, modify, move and delete files and folders
+	ScopeTemplatesWrite = "templates:write" // Render templates and previews
+	ScopeKeysManage     = "keys:manage"     // Create, list and revoke the server's own keys
+	ScopeAdmin          = "admin"           // Every other permission of the server's role
+)
+
+// Scopes lists every valid scope.
+var Scopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeTemplatesWrite, ScopeKeysManage, ScopeAdmin}
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot in code and logs.
+const apiKeyPrefix = signing.KeyPrefix
+
+// lastUsedResolution is how often the last-used time of a key is written back.
+const lastUsedResolution = time.Minute
+
+// APIKey is a long random credential of a server. Keys look like
+// fmk_<id>_<secret>: the ID is public and used for lookup. Only a verifier of the secret
+// and the key signed requests are checked with are stored, each derived from the secret
+// on its own.
+type APIKey struct {
+	ID           string     `json:"id"`
+	ServerID     string     `json:"server_id"`
+	Name         string     `json:"name"`
+	HashedSecret string     `json:"-"` // Hex verifier of the secret
+	SigningKey   string     `json:"-"` // Hex HMAC key of signed requests
+	Scopes       []string   `json:"scopes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// hashSecret returns the verifier of a key secret, the HMAC-SHA256 of "verify" under the
+// secret. Secrets are long and random, so a fast hash is as safe as bcrypt here and keeps
+// per-request verification cheap. It is derived apart from the signing key, so a leaked
+// verifier cannot sign requests and a leaked signing key cannot pass as the secret.
+func hashSecret(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("verify"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateAPIKey issues a new key for a server of tenant and returns it with the full key,
+// which is shown only once. A server can hold any number of active keys, so keys are
+// rotated by creating a new one, switching clients over and revoking the old one.
+func (r *Registry) CreateAPIKey(ctx context.Context, tenant, serverID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required (%s)", ErrInvalidAPIKey, strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", fmt.Errorf("%w: unknown scope %q (%s)", ErrInvalidAPIKey, scope, strings.Join(Scopes, ", "))
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKey)
+	}
+	if _, err := r.tenantServer(ctx, tenant, serverID); err != nil {
+		return nil, "", err
+	}
+
+	id := strings.ToLower(rand.Text()[:12])
+	secret := rand.Text() + rand.Text()
+	key := &APIKey{
+		ID:           id,
+		ServerID:     serverID,
+		Name:         name,
+		HashedSecret: hashSecret(secret),
+		SigningKey:   hex.EncodeToString(signing.DeriveKey(secret)),
+		Scopes:       slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt,
+	}
+	if err := r.store.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, apiKeyPrefix + id + "_" + secret, nil
+}
+
+// ListAPIKeys returns the keys of a server of tenant, including expired and revoked ones.
+func (r *Registry) ListAPIKeys(ctx context.Context, tenant, serverID string) ([]*APIKey, error) {
+	if _, err := r.tenantServer(ctx, tenant, serverID); err != nil {
+		return nil, err
+	}
+	return r.store.ListAPIKeys(ctx, serverID)
+}
+
+// RevokeAPIKey revokes a key of a server of tenant. Revoking twice keeps the first
+// revocation time.
+func (r *Registry) RevokeAPIKey(ctx context.Context, tenant, serverID, keyID string) (*APIKey, error) {
+	if _, err := r.tenantServer(ctx, tenant, serverID); err != nil {
+		return nil, err
+	}
+	key, err := r.store.GetAPIKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.ServerID != serverID {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, keyID)
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+	if err := r.store.RevokeAPIKey(ctx, keyID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return r.store.GetAPIKey(ctx, keyID)
+}
+
+// AuthenticateAPIKey checks an API key and returns its server. Unknown, wrong, expired
+// and revoked keys all return ErrInvalidCredentials; keys of disabled servers return
+// ErrServerDisabled.
+func (r *Registry) AuthenticateAPIKey(ctx context.Context, token string) (*Server, *APIKey, error) {
+	id, secret, ok := signing.ParseAPIKey(token)
+	if !ok {
+		return nil, nil, ErrInvalidCredentials
+	}
+	key, err := r.store.GetAPIKey(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.HashedSecret)) != 1 {
+		return nil, nil, ErrInvalidCredentials
+	}
+	return r.useAPIKey(ctx, key)
+}
+
+// SigningKey returns the active API key a signed request names, so unknown, expired
+// and revoked keys are rejected before the request body is read. Failures are reported
+// like AuthenticateAPIKey does.
+func (r *Registry) SigningKey(ctx context.Context, keyID string) (*APIKey, error) {
+	key, err := r.store.GetAPIKey(ctx, keyID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !key.Active(time.Now()) {
+		return nil, ErrInvalidCredentials
+	}
+	return key, nil
+}
+
+// VerifySignature checks a request signature made with a key from SigningKey and
+// returns the key's server. Failures are reported like AuthenticateAPIKey does.
+func (r *Registry) VerifySignature(ctx context.Context, key *APIKey, stringToSign, signature string) (*Server, *APIKey, error) {
+	hmacKey, err := hex.DecodeString(key.SigningKey)
+	if err != nil || len(hmacKey) == 0 {
+		return nil, nil, fmt.Errorf("corrupt signing key of API key %s", key.ID)
+	}
+	if !hmac.Equal([]byte(signing.Sign(hmacKey, stringToSign)), []byte(signature)) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	return r.useAPIKey(ctx, key)
+}
+
+// useAPIKey checks that a verified key may be used and records its use.
+func (r *Registry) useAPIKey(ctx context.Context, key *APIKey) (*Server, *APIKey, error) {
+	now := time.Now().UTC()
+	if !key.Active(now) {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	server, err := r.store.GetServer(ctx, key.ServerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if server.Disabled {
+		return nil, nil, ErrServerDisabled
+	}
+
+	// Record usage, but not on every request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := r.store.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return server, key, nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	registry := testRegistry(t)
+	key, token, err := registry.CreateAPIKey(ctx, "north", "north-app", "it-reader", []string{ScopeFilesRead}, nil)
+	require.NoError(t, err)
+	authenticator := APIKeyAuthenticator{Registry: registry}
+	authenticate := func(header, value string) (*Identity, error) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/files", nil)
+		req.Header.Set(header, value)
+		return authenticator.Authenticate(req)
+	}
+
+	for header, value := range map[string]string{"X-API-Key": token, "Authorization": "Bearer " + token} {
+		identity, err := authenticate(header, value)
+		require.NoError(t, err, header)
+		assert.Equal(t, &Identity{ServerID: "north-app", Role: "calculator", Tenant: "north", Method: "api_key", APIKeyID: key.ID, Scopes: []string{ScopeFilesRead}}, identity)
+	}
+	_, err = authenticate("Authorization", "Bearer not-an-api-key")
+	assert.ErrorIs(t, err, ErrNoCredentials, "other bearer tokens are left to OIDC")
+
+	keys, err := registry.ListAPIKeys(ctx, "north", "north-app")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+	assert.WithinDuration(t, time.Now(), *keys[0].LastUsedAt, time.Minute)
+
+	_, err = registry.RevokeAPIKey(ctx, "north", "north-app", key.ID)
+	require.NoError(t, err)
+	_, err = authenticate("X-API-Key", token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	t.Run("disabled server", func(t *testing.T) {
+		_, token, err := registry.CreateAPIKey(ctx, "south", "south-app", "ci", []string{ScopeFilesRead}, nil)
+		require.NoError(t, err)
+		_, err = registry.SetDisabled(ctx, "south", "south-app", true)
+		require.NoError(t, err)
+		_, err = authenticate("X-API-Key", token)
+		assert.ErrorIs(t, err, ErrServerDisabled)
+	})
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		keyName   string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		{"no name", "", []string{ScopeFilesRead}, nil},
+		{"no scopes", "ci", nil, nil},
+		{"unknown scope", "ci", []string{"files:delete"}, nil},
+		{"expired", "ci", []string{ScopeFilesRead}, &past},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := testRegistry(t).CreateAPIKey(ctx, "north", "north-app", tt.keyName, tt.scopes, tt.expiresAt)
+			assert.ErrorIs(t, err, ErrInvalidAPIKey)
+		})
+	}
+}
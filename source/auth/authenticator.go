@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an authenticator when a request carries none of the
+// credentials it checks, so the next authenticator of the chain is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	ServerID string
+	Role     string
+	Tenant   string
+	Method   string   // "api_key", "oidc" or "pin"
+	APIKeyID string   // Set for API key authentication
+	Scopes   []string // API key scopes; nil when the caller is not limited by scopes
+}
+
+// Authenticator checks one kind of credential. It returns ErrNoCredentials when the
+// request has none, ErrInvalidCredentials or ErrServerDisabled when it is rejected.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain tries its authenticators in order. The first one that finds its credentials in
+// the request decides; the others are not consulted.
+type Chain []Authenticator
+
+// Authenticate returns the identity from the first authenticator that finds credentials,
+// or ErrNoCredentials when none does.
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return identity, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// PINAuthenticator checks the X-Server-ID and X-PIN headers against the registry. With
+// a Throttle, attempts on server IDs locked out for their source IP, or from locked out
+// source IPs, are rejected with a LockoutError before the PIN is checked.
+type PINAuthenticator struct {
+	Registry *Registry
+	Throttle *LoginThrottle
+}
+
+// Authenticate implements Authenticator.
+func (a PINAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	serverID := r.Header.Get("X-Server-ID")
+	pin := r.Header.Get("X-PIN")
+	if serverID == "" || pin == "" {
+		return nil, ErrNoCredentials
+	}
+	ip := clientIP(r.Context())
+	if ip == "" {
+		ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	if a.Throttle != nil {
+		if err := a.Throttle.Check(serverID, ip); err != nil {
+			return nil, err
+		}
+	}
+	server, err := a.Registry.Authenticate(r.Context(), serverID, pin)
+	if a.Throttle != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			a.Throttle.Fail(serverID, ip)
+		case err == nil:
+			a.Throttle.Succeed(serverID, ip)
+		default:
+			a.Throttle.Release(serverID, ip)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{ServerID: server.ID, Role: server.Role, Tenant: server.Tenant, Method: "pin"}, nil
+}
+
+// APIKeyAuthenticator checks API keys sent as X-API-Key or "Authorization: Bearer fmk_...".
+type APIKeyAuthenticator struct {
+	Registry *Registry
+}
+
+// Authenticate implements Authenticator.
+func (a APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		if bearer := bearerToken(r); strings.HasPrefix(bearer, apiKeyPrefix) {
+			token = bearer
+		}
+	}
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	server, key, err := a.Registry.AuthenticateAPIKey(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		ServerID: server.ID,
+		Role:     server.Role,
+		Tenant:   server.Tenant,
+		Method:   "api_key",
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or "".
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+)
+
+// CertificateAuthenticator authenticates requests by the client certificate verified
+// during the TLS handshake. The certificate's subject common name and DNS SANs are
+// matched against the registered server IDs; the server's role and tenant apply.
+type CertificateAuthenticator struct {
+	Registry *Registry
+}
+
+// Authenticate implements Authenticator.
+func (a CertificateAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	server, err := a.Registry.AuthenticateCertificate(r.Context(), r.TLS.VerifiedChains[0][0])
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{ServerID: server.ID, Role: server.Role, Tenant: server.Tenant, Method: "certificate"}, nil
+}
+
+// AuthenticateCertificate returns the server named by a verified client certificate:
+// the subject common name first, then the DNS SANs in order. Certificates naming no
+// registered server return ErrInvalidCredentials, disabled servers ErrServerDisabled.
+func (r *Registry) AuthenticateCertificate(ctx context.Context, cert *x509.Certificate) (*Server, error) {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, name := range names {
+		if !serverIDPattern.MatchString(name) {
+			continue
+		}
+		server, err := r.store.GetServer(ctx, name)
+		if errors.Is(err, ErrServerNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if server.Disabled {
+			return nil, ErrServerDisabled
+		}
+		return server, nil
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateAuthenticator(t *testing.T) {
+	registry := testRegistry(t)
+	_, err := registry.SetDisabled(context.Background(), AllTenants, "south-app", true)
+	require.NoError(t, err)
+	authenticator := CertificateAuthenticator{Registry: registry}
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate // Leaf of the verified chain; nil for a request without one
+		wantID   string
+		wantRole string
+		wantErr  error
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "north-app"}}, "north-app", "calculator", nil},
+		{"DNS name", &x509.Certificate{Subject: pkix.Name{CommonName: "North App Client"}, DNSNames: []string{"nobody", "north-admin"}}, "north-admin", "admin", nil},
+		{"disabled server", &x509.Certificate{Subject: pkix.Name{CommonName: "south-app"}}, "", "", ErrServerDisabled},
+		{"unknown server", &x509.Certificate{Subject: pkix.Name{CommonName: "nobody"}}, "", "", ErrInvalidCredentials},
+		{"no certificate", nil, "", "", ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/files", nil)
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			identity, err := authenticator.Authenticate(req)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Identity{ServerID: tt.wantID, Role: tt.wantRole, Tenant: "north", Method: "certificate"}, identity)
+		})
+	}
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		_, err := authenticator.Authenticate(httptest.NewRequest("GET", "/v1/files", nil))
+		assert.ErrorIs(t, err, ErrNoCredentials)
+	})
+}
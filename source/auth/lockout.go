@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"file-manager/config"
+)
+
+// ErrLockedOut is matched by the LockoutError returned for PIN attempts on a server ID
+// locked out for their source IP, or from a locked out source IP.
+var ErrLockedOut = errors.New("too many failed attempts")
+
+// LockoutError is returned while a server ID and source IP pair, or a source IP, is
+// locked out.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrLockedOut, e.RetryAfter)
+}
+
+// Is makes errors.Is(err, ErrLockedOut) match.
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrLockedOut
+}
+
+// pendingRetryAfter is the Retry-After of attempts rejected because the attempts in flight
+// would reach the limit if they failed. Those settle within one PIN check.
+const pendingRetryAfter = time.Second
+
+// failureRecord counts the recent failed attempts of one server ID and source IP pair, or
+// of one source IP, and the attempts in flight.
+type failureRecord struct {
+	failures    int
+	pending     int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginThrottle tracks failed PIN attempts per server ID and source IP pair, and per
+// source IP. Once either reaches its limit, it is locked out for BaseDuration, doubled
+// with every further failure up to MaxDuration. Server IDs are only locked out for the
+// IPs that failed on them, so anonymous clients cannot lock a server out everywhere by
+// sending bad PINs for its ID. Locked out attempts are rejected before the PIN is
+// checked, so they cost no bcrypt comparison. Check reserves an attempt that counts
+// against the limits until Fail, Succeed or Release settles it, so a concurrent burst
+// gets no more guesses than a sequential one. Each instance keeps its own counts.
+type LoginThrottle struct {
+	cfg       config.LockoutConfig
+	mu        sync.Mutex
+	pairs     map[string]*failureRecord // By pairKey
+	ips       map[string]*failureRecord
+	lastPrune time.Time
+}
+
+// NewLoginThrottle creates a LoginThrottle with the given limits.
+func NewLoginThrottle(cfg config.LockoutConfig) *LoginThrottle {
+	return &LoginThrottle{
+		cfg:   cfg,
+		pairs: make(map[string]*failureRecord),
+		ips:   make(map[string]*failureRecord),
+	}
+}
+
+// pairKey keys the failures of one server ID from one source IP.
+func pairKey(serverID, ip string) string {
+	return serverID + "\x00" + ip
+}
+
+// Check returns a LockoutError while the server ID is locked out for the source IP, or
+// the source IP is locked out, or the attempts in flight would lock either out if they
+// failed. Otherwise it reserves an attempt, which the caller must settle with Fail,
+// Succeed or Release.
+func (t *LoginThrottle) Check(serverID, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+	key := pairKey(serverID, ip)
+	var wait time.Duration
+	for _, check := range []struct {
+		record *failureRecord
+		limit  int
+	}{{t.pairs[key], t.cfg.MaxServerFailures}, {t.ips[ip], t.cfg.MaxIPFailures}} {
+		switch record := check.record; {
+		case record == nil:
+		case record.lockedUntil.After(now):
+			wait = max(wait, record.lockedUntil.Sub(now))
+		case t.recentFailures(record, now)+record.pending >= check.limit:
+			wait = max(wait, pendingRetryAfter)
+		}
+	}
+	if wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+
+	t.reserve(t.pairs, key).pending++
+	t.reserve(t.ips, ip).pending++
+	return nil
+}
+
+// Fail settles an attempt reserved by Check as failed, and logs an alert when it locks
+// out the pair or the IP.
+func (t *LoginThrottle) Fail(serverID, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	key := pairKey(serverID, ip)
+	t.release(serverID, ip)
+	if d := t.record(t.pairs, key, t.cfg.MaxServerFailures, now); d > 0 {
+		log.Printf("ALERT: server %s locked out for source IP %s for %s after %d failed PIN attempts",
+			serverID, ip, d, t.pairs[key].failures)
+	}
+	if d := t.record(t.ips, ip, t.cfg.MaxIPFailures, now); d > 0 {
+		log.Printf("ALERT: source IP %s locked out for %s after %d failed PIN attempts (last on server %s)",
+			ip, d, t.ips[ip].failures, serverID)
+	}
+}
+
+// Succeed settles an attempt reserved by Check as successful and forgets the failed
+// attempts on serverID from ip. Those of the source IP are kept, so a client holding one
+// valid PIN cannot reset its count while guessing others.
+func (t *LoginThrottle) Succeed(serverID, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release(serverID, ip)
+	key := pairKey(serverID, ip)
+	if record := t.pairs[key]; record != nil && record.pending > 0 {
+		record.failures, record.lockedUntil = 0, time.Time{}
+	} else {
+		delete(t.pairs, key)
+	}
+}
+
+// Release settles an attempt reserved by Check without counting it, for attempts that
+// neither proved nor disproved the PIN.
+func (t *LoginThrottle) Release(serverID, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release(serverID, ip)
+}
+
+// reserve returns the record of key, creating it. Callers must hold t.mu.
+func (t *LoginThrottle) reserve(records map[string]*failureRecord, key string) *failureRecord {
+	record := records[key]
+	if record == nil {
+		record = &failureRecord{}
+		records[key] = record
+	}
+	return record
+}
+
+// release drops an attempt reserved by Check. Callers must hold t.mu.
+func (t *LoginThrottle) release(serverID, ip string) {
+	for _, record := range []*failureRecord{t.pairs[pairKey(serverID, ip)], t.ips[ip]} {
+		if record != nil && record.pending > 0 {
+			record.pending--
+		}
+	}
+}
+
+// recentFailures returns the failures of record, or 0 once they are older than the reset
+// window.
+func (t *LoginThrottle) recentFailures(record *failureRecord, now time.Time) int {
+	if now.Sub(record.lastFailure) > t.cfg.ResetAfter {
+		return 0
+	}
+	return record.failures
+}
+
+// record counts a failure for key and returns the lockout it starts, or 0.
+func (t *LoginThrottle) record(records map[string]*failureRecord, key string, limit int, now time.Time) time.Duration {
+	record := t.reserve(records, key)
+	record.failures = t.recentFailures(record, now)
+	record.failures++
+	record.lastFailure = now
+	if record.failures < limit {
+		return 0
+	}
+
+	d := t.cfg.BaseDuration
+	for i := limit; i < record.failures && d < t.cfg.MaxDuration; i++ {
+		d *= 2
+	}
+	d = min(d, t.cfg.MaxDuration)
+	record.lockedUntil = now.Add(d)
+	return d
+}
+
+// prune drops records without failures in the reset window or attempts in flight, at most
+// once a minute.
+func (t *LoginThrottle) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < time.Minute {
+		return
+	}
+	for _, records := range []map[string]*failureRecord{t.pairs, t.ips} {
+		for key, record := range records {
+			if record.pending == 0 && now.Sub(record.lastFailure) > t.cfg.ResetAfter && !record.lockedUntil.After(now) {
+				delete(records, key)
+			}
+		}
+	}
+	t.lastPrune = now
+}
+
+type clientIPKey struct{}
+
+// withClientIP returns a context carrying the source IP of a request.
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// clientIP returns the source IP set by ServerAuthMiddleware, or "" outside it. It comes
+// from the router's IP extractor, which only trusts forwarding headers of configured
+// proxies.
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
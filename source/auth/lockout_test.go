@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"file-manager/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	cfg := config.LockoutConfig{
+		MaxServerFailures: 3,
+		MaxIPFailures:     5,
+		BaseDuration:      time.Minute,
+		MaxDuration:       time.Hour,
+		ResetAfter:        time.Hour,
+	}
+	type attempt struct {
+		server, ip string
+		ok         bool
+	}
+	tests := []struct {
+		name     string
+		attempts []attempt
+		server   string
+		ip       string
+		locked   bool
+	}{
+		{
+			name:     "below the server limit",
+			attempts: []attempt{{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}},
+			server:   "a", ip: "1.1.1.1",
+		},
+		{
+			name:     "server limit locks the pair",
+			attempts: []attempt{{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}},
+			server:   "a", ip: "1.1.1.1",
+			locked: true,
+		},
+		{
+			name:     "other IPs can still try the locked server",
+			attempts: []attempt{{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}},
+			server:   "a", ip: "2.2.2.2",
+		},
+		{
+			name:     "the locked IP can still try other servers",
+			attempts: []attempt{{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}},
+			server:   "b", ip: "1.1.1.1",
+		},
+		{
+			name: "IP limit locks every server for the IP",
+			attempts: []attempt{
+				{"a", "1.1.1.1", false}, {"b", "1.1.1.1", false}, {"c", "1.1.1.1", false},
+				{"d", "1.1.1.1", false}, {"e", "1.1.1.1", false},
+			},
+			server: "f", ip: "1.1.1.1",
+			locked: true,
+		},
+		{
+			name:     "success resets the pair",
+			attempts: []attempt{{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}, {"a", "1.1.1.1", true}, {"a", "1.1.1.1", false}},
+			server:   "a", ip: "1.1.1.1",
+		},
+		{
+			name: "success keeps the IP count",
+			attempts: []attempt{
+				{"a", "1.1.1.1", false}, {"a", "1.1.1.1", false}, {"a", "1.1.1.1", true},
+				{"b", "1.1.1.1", false}, {"b", "1.1.1.1", true}, {"c", "1.1.1.1", false},
+				{"d", "1.1.1.1", false},
+			},
+			server: "e", ip: "1.1.1.1",
+			locked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewLoginThrottle(cfg)
+			for _, a := range tt.attempts {
+				if a.ok {
+					throttle.Succeed(a.server, a.ip)
+				} else {
+					throttle.Fail(a.server, a.ip)
+				}
+			}
+
+			err := throttle.Check(tt.server, tt.ip)
+			if !tt.locked {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrLockedOut)
+			var lockout *LockoutError
+			require.True(t, errors.As(err, &lockout))
+			assert.Greater(t, lockout.RetryAfter, time.Duration(0))
+			assert.LessOrEqual(t, lockout.RetryAfter, cfg.BaseDuration)
+		})
+	}
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	cfg := config.LockoutConfig{
+		MaxServerFailures: 2,
+		MaxIPFailures:     100,
+		BaseDuration:      time.Minute,
+		MaxDuration:       5 * time.Minute,
+		ResetAfter:        time.Hour,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute}, // Capped at MaxDuration
+		{8, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		throttle := NewLoginThrottle(cfg)
+		for range tt.failures {
+			throttle.Fail("a", "1.1.1.1")
+		}
+		var lockout *LockoutError
+		require.True(t, errors.As(throttle.Check("a", "1.1.1.1"), &lockout), "%d failures", tt.failures)
+		assert.InDelta(t, tt.want, lockout.RetryAfter, float64(time.Second), "%d failures", tt.failures)
+	}
+}
+
+func TestLoginThrottleConcurrentBurst(t *testing.T) {
+	cfg := config.LockoutConfig{
+		MaxServerFailures: 3,
+		MaxIPFailures:     100,
+		BaseDuration:      time.Minute,
+		MaxDuration:       time.Hour,
+		ResetAfter:        time.Hour,
+	}
+	authenticator := PINAuthenticator{Registry: testRegistry(t), Throttle: NewLoginThrottle(cfg)}
+
+	var guesses, lockouts atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/v1/files", nil)
+			req.Header.Set("X-Server-ID", "north-app")
+			req.Header.Set("X-PIN", "wrong")
+			_, err := authenticator.Authenticate(req)
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				guesses.Add(1)
+			case errors.Is(err, ErrLockedOut):
+				lockouts.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only the reserved attempts reach bcrypt, however the requests interleave
+	assert.Equal(t, int32(cfg.MaxServerFailures), guesses.Load())
+	assert.Equal(t, int32(20-cfg.MaxServerFailures), lockouts.Load())
+	assert.ErrorIs(t, authenticator.Throttle.Check("north-app", "192.0.2.1"), ErrLockedOut)
+}
+
+func TestLoginThrottleReservations(t *testing.T) {
+	cfg := config.LockoutConfig{
+		MaxServerFailures: 2,
+		MaxIPFailures:     3,
+		BaseDuration:      time.Minute,
+		MaxDuration:       time.Hour,
+		ResetAfter:        time.Hour,
+	}
+	throttle := NewLoginThrottle(cfg)
+
+	// Attempts in flight count against the limit until they are settled
+	require.NoError(t, throttle.Check("a", "1.1.1.1"))
+	require.NoError(t, throttle.Check("a", "1.1.1.1"))
+	var lockout *LockoutError
+	require.True(t, errors.As(throttle.Check("a", "1.1.1.1"), &lockout))
+	assert.Equal(t, pendingRetryAfter, lockout.RetryAfter)
+
+	// Successes and releases give the reservation back
+	throttle.Succeed("a", "1.1.1.1")
+	throttle.Release("a", "1.1.1.1")
+	for range 5 {
+		require.NoError(t, throttle.Check("a", "1.1.1.1"))
+		throttle.Succeed("a", "1.1.1.1")
+	}
+
+	// Reservations on other servers count against the limit of the IP
+	require.NoError(t, throttle.Check("b", "1.1.1.1"))
+	require.NoError(t, throttle.Check("c", "1.1.1.1"))
+	require.NoError(t, throttle.Check("d", "1.1.1.1"))
+	assert.ErrorIs(t, throttle.Check("e", "1.1.1.1"), ErrLockedOut)
+	throttle.Release("b", "1.1.1.1")
+	assert.NoError(t, throttle.Check("e", "1.1.1.1"))
+}
+
+func TestServerAuthMiddlewareLockout(t *testing.T) {
+	cfg := config.LockoutConfig{
+		MaxServerFailures: 3,
+		MaxIPFailures:     100,
+		BaseDuration:      time.Minute,
+		MaxDuration:       time.Hour,
+		ResetAfter:        time.Hour,
+	}
+	registry := testRegistry(t)
+	e := echo.New()
+	e.Use(ServerAuthMiddleware(registry, Chain{PINAuthenticator{Registry: registry, Throttle: NewLoginThrottle(cfg)}}))
+	e.GET("/v1/files", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	login := func(server, pin, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/files", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-Server-ID", server)
+		req.Header.Set("X-PIN", pin)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range cfg.MaxServerFailures {
+		assert.Equal(t, http.StatusUnauthorized, login("north-app", "wrong", "1.1.1.1").Code)
+	}
+	rec := login("north-app", "0123456789abcdef", "1.1.1.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "the right PIN is locked out too")
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, login("south-app", "0123456789abcdef", "1.1.1.1").Code, "other servers")
+	assert.Equal(t, http.StatusOK, login("north-app", "0123456789abcdef", "2.2.2.2").Code, "other IPs")
+}
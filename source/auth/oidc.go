@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"file-manager/config"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// oidcAlgorithms are the signature algorithms accepted for OIDC tokens. HMAC algorithms
+// are excluded: the JWKS only holds public keys.
+var oidcAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// jwksMinRefresh limits how often tokens signed with an unknown key trigger a JWKS
+// fetch, so garbage tokens cannot hammer the provider.
+const jwksMinRefresh = 5 * time.Second
+
+// maxJWKSSize bounds the JWKS and discovery documents read from the provider.
+const maxJWKSSize = 1 << 20
+
+// OIDCAuthenticator checks "Authorization: Bearer" JWTs of an OpenID Connect provider
+// against the provider's JWKS. The keys are cached and fetched again after the refresh
+// interval, or earlier when a token names a key the cache does not know, which picks up
+// key rotations at the provider. Tokens must name a registered server of their tenant.
+type OIDCAuthenticator struct {
+	cfg      config.OIDCConfig
+	registry *Registry
+	client   *http.Client
+
+	mu          sync.Mutex
+	jwksURL     string // Resolved through discovery when not configured
+	keys        *jose.JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewOIDCAuthenticator checks the configuration. Keys are fetched on first use.
+func NewOIDCAuthenticator(cfg config.OIDCConfig, registry *Registry) (*OIDCAuthenticator, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("OIDC_ISSUER is required")
+	}
+	if cfg.Audience == "" {
+		return nil, errors.New("OIDC_AUDIENCE is required")
+	}
+	if cfg.ServerIDClaim == "" || cfg.RoleClaim == "" || cfg.TenantClaim == "" {
+		return nil, errors.New("OIDC_SERVER_ID_CLAIM, OIDC_ROLE_CLAIM and OIDC_TENANT_CLAIM must not be empty")
+	}
+	return &OIDCAuthenticator{
+		cfg:      cfg,
+		registry: registry,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		jwksURL:  cfg.JWKSURL,
+	}, nil
+}
+
+// Refresh fetches the provider's keys.
+func (a *OIDCAuthenticator) Refresh(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.refresh(ctx)
+}
+
+// Authenticate implements Authenticator. API keys sent as bearer tokens are left to the
+// API key authenticator.
+func (a *OIDCAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" || strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, ErrNoCredentials
+	}
+
+	parsed, err := jwt.ParseSigned(token, oidcAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	key, err := a.signingKey(r.Context(), parsed.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var custom map[string]any
+	if err := parsed.Claims(key, &claims, &custom); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrInvalidCredentials)
+	}
+	expected := jwt.Expected{Issuer: a.cfg.Issuer, AnyAudience: jwt.Audience{a.cfg.Audience}, Time: time.Now()}
+	if err := claims.ValidateWithLeeway(expected, jwt.DefaultLeeway); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	identity := &Identity{
+		ServerID: stringClaim(custom, a.cfg.ServerIDClaim),
+		Role:     stringClaim(custom, a.cfg.RoleClaim),
+		Tenant:   stringClaim(custom, a.cfg.TenantClaim),
+		Method:   "oidc",
+	}
+	if identity.ServerID == "" || identity.Role == "" || identity.Tenant == "" {
+		return nil, fmt.Errorf("%w: token lacks the %s, %s or %s claim", ErrInvalidCredentials, a.cfg.ServerIDClaim, a.cfg.RoleClaim, a.cfg.TenantClaim)
+	}
+	if _, err := a.registry.AuthenticateOIDC(r.Context(), identity.ServerID, identity.Tenant); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// AuthenticateOIDC returns the registered server an OIDC token was issued for, so that
+// disabling a server also stops its tokens before they expire. Tokens naming no server,
+// or a server of another tenant, return ErrInvalidCredentials, disabled servers
+// ErrServerDisabled.
+func (r *Registry) AuthenticateOIDC(ctx context.Context, id, tenant string) (*Server, error) {
+	server, err := r.store.GetServer(ctx, id)
+	if errors.Is(err, ErrServerNotFound) {
+		return nil, fmt.Errorf("%w: token names unknown server %s", ErrInvalidCredentials, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if server.Tenant != tenant {
+		return nil, fmt.Errorf("%w: server %s is not in tenant %s", ErrInvalidCredentials, id, tenant)
+	}
+	if server.Disabled {
+		return nil, ErrServerDisabled
+	}
+	return server, nil
+}
+
+// signingKey returns the key with the given ID, fetching the keys when they are stale
+// or do not contain it. Tokens without a key ID are accepted when the set has one key.
+func (a *OIDCAuthenticator) signingKey(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	canRefresh := now.Sub(a.attemptedAt) >= jwksMinRefresh
+	if canRefresh && (a.keys == nil || now.Sub(a.fetchedAt) >= a.cfg.RefreshInterval) {
+		if err := a.refresh(ctx); err != nil {
+			log.Printf("Failed to refresh OIDC keys: %v", err)
+		}
+		canRefresh = false
+	}
+	key := a.lookup(kid)
+	if key == nil && canRefresh {
+		if err := a.refresh(ctx); err != nil {
+			log.Printf("Failed to refresh OIDC keys: %v", err)
+		}
+		key = a.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidCredentials, kid)
+	}
+	return key, nil
+}
+
+// lookup finds a key in the cached set. Callers must hold a.mu.
+func (a *OIDCAuthenticator) lookup(kid string) *jose.JSONWebKey {
+	if a.keys == nil {
+		return nil
+	}
+	if kid == "" {
+		if len(a.keys.Keys) == 1 {
+			return &a.keys.Keys[0]
+		}
+		return nil
+	}
+	for _, key := range a.keys.Key(kid) {
+		if key.Use == "" || key.Use == "sig" {
+			return &key
+		}
+	}
+	return nil
+}
+
+// refresh fetches the keys, keeping the previous ones on failure. Callers must hold a.mu.
+func (a *OIDCAuthenticator) refresh(ctx context.Context) error {
+	a.attemptedAt = time.Now()
+	if a.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := a.fetchJSON(ctx, strings.TrimSuffix(a.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery document has no jwks_uri")
+		}
+		a.jwksURL = discovery.JWKSURI
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := a.fetchJSON(ctx, a.jwksURL, &keys); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	a.keys = &keys
+	a.fetchedAt = a.attemptedAt
+	return nil
+}
+
+// fetchJSON decodes the document at rawURL, which may be an http(s) or file:// URL.
+func (a *OIDCAuthenticator) fetchJSON(ctx context.Context, rawURL string, dst any) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch u.Scheme {
+	case "file":
+		data, err = os.ReadFile(u.Path)
+		if err != nil {
+			return err
+		}
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s returned %s", rawURL, resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// stringClaim returns a string claim. Dots in name select nested objects, as in
+// "realm_access.role".
+func stringClaim(claims map[string]any, name string) string {
+	if name == "" {
+		return ""
+	}
+	var value any = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = object[part]
+	}
+	s, _ := value.(string)
+	return s
+}
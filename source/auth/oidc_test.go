@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"file-manager/config"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIssuer signs OIDC tokens with keys published in a JWKS file.
+type testIssuer struct {
+	t        *testing.T
+	jwksPath string
+	keys     []jose.JSONWebKey // Private keys; the last one signs
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{t: t, jwksPath: filepath.Join(t.TempDir(), "jwks.json")}
+	issuer.rotate()
+	return issuer
+}
+
+// rotate adds a signing key and publishes it.
+func (i *testIssuer) rotate() {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(i.t, err)
+	i.keys = append(i.keys, jose.JSONWebKey{Key: private, KeyID: fmt.Sprintf("key-%d", len(i.keys)+1), Algorithm: string(jose.ES256), Use: "sig"})
+
+	var public jose.JSONWebKeySet
+	for _, key := range i.keys {
+		public.Keys = append(public.Keys, key.Public())
+	}
+	data, err := json.Marshal(public)
+	require.NoError(i.t, err)
+	require.NoError(i.t, os.WriteFile(i.jwksPath, data, 0o600))
+}
+
+// token signs claims for the issuer and audience of testOIDCConfig.
+func (i *testIssuer) token(claims map[string]any, audience string, ttl time.Duration) string {
+	key := i.keys[len(i.keys)-1]
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(i.t, err)
+	now := time.Now()
+	registered := jwt.Claims{
+		Issuer:   "https://issuer.example.com",
+		Audience: jwt.Audience{audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(ttl)),
+	}
+	token, err := jwt.Signed(signer).Claims(registered).Claims(claims).Serialize()
+	require.NoError(i.t, err)
+	return token
+}
+
+func (i *testIssuer) authenticator(registry *Registry) *OIDCAuthenticator {
+	cfg := config.OIDCConfig{
+		Issuer:          "https://issuer.example.com",
+		Audience:        "file-manager",
+		JWKSURL:         "file://" + i.jwksPath,
+		ServerIDClaim:   "sub",
+		RoleClaim:       "role",
+		TenantClaim:     "tenant",
+		RefreshInterval: time.Hour,
+	}
+	authenticator, err := NewOIDCAuthenticator(cfg, registry)
+	require.NoError(i.t, err)
+	return authenticator
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/v1/files", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	northApp := map[string]any{"sub": "north-app", "role": "calculator", "tenant": "north"}
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		audience string
+		ttl      time.Duration
+		disable  string // Server disabled before the request
+		wantErr  error
+	}{
+		{name: "valid token", claims: northApp},
+		{name: "expired", claims: northApp, ttl: -5 * time.Minute, wantErr: ErrInvalidCredentials},
+		{name: "other audience", claims: northApp, audience: "other-service", wantErr: ErrInvalidCredentials},
+		{name: "no role", claims: map[string]any{"sub": "north-app", "tenant": "north"}, wantErr: ErrInvalidCredentials},
+		{name: "no tenant", claims: map[string]any{"sub": "north-app", "role": "calculator"}, wantErr: ErrInvalidCredentials},
+		{name: "unknown server", claims: map[string]any{"sub": "nobody", "role": "calculator", "tenant": "north"}, wantErr: ErrInvalidCredentials},
+		{name: "server of another tenant", claims: map[string]any{"sub": "north-app", "role": "calculator", "tenant": "south"}, wantErr: ErrInvalidCredentials},
+		{name: "platform admin in the default tenant", claims: map[string]any{"sub": "platform", "role": PlatformRole}, wantErr: ErrInvalidCredentials},
+		{name: "disabled server", claims: northApp, disable: "north-app", wantErr: ErrServerDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := testRegistry(t)
+			if tt.disable != "" {
+				_, err := registry.SetDisabled(context.Background(), AllTenants, tt.disable, true)
+				require.NoError(t, err)
+			}
+			issuer := newTestIssuer(t)
+			audience, ttl := tt.audience, tt.ttl
+			if audience == "" {
+				audience = "file-manager"
+			}
+			if ttl == 0 {
+				ttl = time.Hour
+			}
+
+			identity, err := issuer.authenticator(registry).Authenticate(bearerRequest(issuer.token(tt.claims, audience, ttl)))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Identity{ServerID: "north-app", Role: "calculator", Tenant: "north", Method: "oidc"}, identity)
+		})
+	}
+
+	t.Run("rotated key", func(t *testing.T) {
+		issuer := newTestIssuer(t)
+		authenticator := issuer.authenticator(testRegistry(t))
+		_, err := authenticator.Authenticate(bearerRequest(issuer.token(northApp, "file-manager", time.Hour)))
+		require.NoError(t, err)
+
+		issuer.rotate()
+		authenticator.attemptedAt = time.Now().Add(-jwksMinRefresh) // As if the last fetch was a while ago
+		_, err = authenticator.Authenticate(bearerRequest(issuer.token(northApp, "file-manager", time.Hour)))
+		assert.NoError(t, err)
+	})
+	t.Run("API keys are left to their authenticator", func(t *testing.T) {
+		issuer := newTestIssuer(t)
+		_, err := issuer.authenticator(testRegistry(t)).Authenticate(bearerRequest(apiKeyPrefix + "abc_def"))
+		assert.ErrorIs(t, err, ErrNoCredentials)
+	})
+}
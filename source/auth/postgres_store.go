@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresServerStore keeps the servers in the servers table, their API keys in the
+// api_keys table and the custom roles in the roles table.
+type PostgresServerStore struct {
+	db *sql.DB
+}
+
+const createTables = `
+CREATE TABLE IF NOT EXISTS servers (
+	id         TEXT PRIMARY KEY,
+	hashed_pin TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	tenant     TEXT NOT NULL,
+	disabled   BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS api_keys (
+	id            TEXT PRIMARY KEY,
+	server_id     TEXT NOT NULL REFERENCES servers (id),
+	name          TEXT NOT NULL,
+	hashed_secret TEXT NOT NULL,
+	signing_key   TEXT NOT NULL,
+	scopes        TEXT[] NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL,
+	expires_at    TIMESTAMPTZ,
+	last_used_at  TIMESTAMPTZ,
+	revoked_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_keys_server_id ON api_keys (server_id);
+CREATE TABLE IF NOT EXISTS roles (
+	name        TEXT PRIMARY KEY,
+	permissions TEXT[] NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL
+)`
+
+const serverColumns = "id, hashed_pin, role, tenant, disabled, created_at, updated_at"
+
+const apiKeyColumns = "id, server_id, name, hashed_secret, signing_key, scopes, created_at, expires_at, last_used_at, revoked_at"
+
+// NewPostgresServerStore creates the tables if needed.
+func NewPostgresServerStore(ctx context.Context, db *sql.DB) (*PostgresServerStore, error) {
+	if _, err := db.ExecContext(ctx, createTables); err != nil {
+		return nil, fmt.Errorf("failed to create server tables: %w", err)
+	}
+	return &PostgresServerStore{db: db}, nil
+}
+
+// GetServer returns a server by ID.
+func (s *PostgresServerStore) GetServer(ctx context.Context, id string) (*Server, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+serverColumns+" FROM servers WHERE id = $1", id)
+	server, err := scanServer(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server %s: %w", id, err)
+	}
+	return server, nil
+}
+
+// ListServers returns all servers ordered by ID.
+func (s *PostgresServerStore) ListServers(ctx context.Context) ([]*Server, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+serverColumns+" FROM servers ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	defer rows.Close()
+
+	servers := make([]*Server, 0)
+	for rows.Next() {
+		server, err := scanServer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list servers: %w", err)
+		}
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
+
+// CreateServer inserts a server.
+func (s *PostgresServerStore) CreateServer(ctx context.Context, server *Server) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO servers ("+serverColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		server.ID, server.HashedPIN, server.Role, server.Tenant, server.Disabled, server.CreatedAt, server.UpdatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return fmt.Errorf("%w: %s", ErrServerExists, server.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create server %s: %w", server.ID, err)
+	}
+	return nil
+}
+
+// UpdateServer replaces a server's PIN hash, role, tenant and state.
+func (s *PostgresServerStore) UpdateServer(ctx context.Context, server *Server) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE servers SET hashed_pin = $2, role = $3, tenant = $4, disabled = $5, updated_at = $6 WHERE id = $1",
+		server.ID, server.HashedPIN, server.Role, server.Tenant, server.Disabled, server.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update server %s: %w", server.ID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, server.ID)
+	}
+	return nil
+}
+
+// CreateAPIKey inserts an API key.
+func (s *PostgresServerStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_keys ("+apiKeyColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		key.ID, key.ServerID, key.Name, key.HashedSecret, key.SigningKey, pq.Array(key.Scopes), key.CreatedAt, key.ExpiresAt, key.LastUsedAt, key.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+// GetAPIKey returns an API key by ID.
+func (s *PostgresServerStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key %s: %w", id, err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the API keys of a server, oldest first.
+func (s *PostgresServerStore) ListAPIKeys(ctx context.Context, serverID string) ([]*APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE server_id = $1 ORDER BY created_at, id", serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey sets the revocation time of an API key unless it is already revoked.
+func (s *PostgresServerStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	return s.execAPIKey(ctx, id, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1", at)
+}
+
+// TouchAPIKey sets the last-used time of an API key.
+func (s *PostgresServerStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return s.execAPIKey(ctx, id, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", at)
+}
+
+func (s *PostgresServerStore) execAPIKey(ctx context.Context, id, query string, at time.Time) error {
+	result, err := s.db.ExecContext(ctx, query, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to update API key %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return nil
+}
+
+// GetRole returns a custom role by name.
+func (s *PostgresServerStore) GetRole(ctx context.Context, name string) (*Role, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT name, permissions, updated_at FROM roles WHERE name = $1", name)
+	role, err := scanRole(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role %s: %w", name, err)
+	}
+	return role, nil
+}
+
+// ListRoles returns all custom roles ordered by name.
+func (s *PostgresServerStore) ListRoles(ctx context.Context) ([]*Role, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, permissions, updated_at FROM roles ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make([]*Role, 0)
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// PutRole inserts or replaces a custom role.
+func (s *PostgresServerStore) PutRole(ctx context.Context, role *Role) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO roles (name, permissions, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET permissions = EXCLUDED.permissions, updated_at = EXCLUDED.updated_at`,
+		role.Name, pq.Array(role.Permissions), role.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save role %s: %w", role.Name, err)
+	}
+	return nil
+}
+
+// DeleteRole deletes a custom role.
+func (s *PostgresServerStore) DeleteRole(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete role %s: %w", name, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanServer(row rowScanner) (*Server, error) {
+	var server Server
+	err := row.Scan(&server.ID, &server.HashedPIN, &server.Role, &server.Tenant, &server.Disabled, &server.CreatedAt, &server.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.ServerID, &key.Name, &key.HashedSecret, &key.SigningKey, pq.Array(&key.Scopes), &key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.ExpiresAt = nullTime(expiresAt)
+	key.LastUsedAt = nullTime(lastUsedAt)
+	key.RevokedAt = nullTime(revokedAt)
+	return &key, nil
+}
+
+func scanRole(row rowScanner) (*Role, error) {
+	var role Role
+	if err := row.Scan(&role.Name, pq.Array(&role.Permissions), &role.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
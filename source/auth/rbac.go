@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// ErrRoleNotFound is returned for undefined roles.
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrInvalidRole is returned for role definitions with a bad name or permission.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrRoleReadOnly is returned when changing a built-in or configured role.
+	ErrRoleReadOnly = errors.New("role is built in or configured and cannot be changed")
+	// ErrRoleInUse is returned when deleting a role that servers still have.
+	ErrRoleInUse = errors.New("role is in use")
+)
+
+// Permissions. Those on files apply to the caller's own files with the ":own" suffix and
+// to every file with ":any"; roles grant them with a suffix, routes and handlers check
+// them without.
+const (
+	PermFilesRead       = "files:read"       // Metadata, downloads, listings, usage and history
+	PermFilesWrite      = "files:write"      // Uploads, metadata updates, copies, moves, restores and folders
+	PermFilesDelete     = "files:delete"     // Moving files and folders to the trash
+	PermFilesShare      = "files:share"      // Share links for external recipients
+	PermFilesHold       = "files:hold"       // Placing and releasing legal holds
+	PermTemplatesManage = "templates:manage" // Rendering templates and previews
+	PermKeysManage      = "keys:manage"      // The caller's own API keys
+	PermServersManage   = "servers:manage"   // The server registry and every server's API keys
+	PermRolesManage     = "roles:manage"     // Custom roles
+	PermStorageManage   = "storage:manage"   // Storage maintenance such as orphan collection
+	PermPlatformAdmin   = "platform:admin"   // Servers, keys and roles of every tenant; not granted by "*"
+)
+
+// ownedPermissions are granted per owner, with an ":own" or ":any" suffix.
+var ownedPermissions = []string{PermFilesRead, PermFilesWrite, PermFilesDelete, PermFilesShare}
+
+// Permissions lists every permission a role can grant, besides "*" for all of them.
+var Permissions = []string{
+	PermFilesRead + ":own", PermFilesRead + ":any",
+	PermFilesWrite + ":own", PermFilesWrite + ":any",
+	PermFilesDelete + ":own", PermFilesDelete + ":any",
+	PermFilesShare + ":own", PermFilesShare + ":any",
+	PermFilesHold, PermTemplatesManage, PermKeysManage,
+	PermServersManage, PermRolesManage, PermStorageManage, PermPlatformAdmin,
+}
+
+// permissionScopes maps permissions to the API key scope they need.
+var permissionScopes = map[string]string{
+	PermFilesRead:       ScopeFilesRead,
+	PermFilesWrite:      ScopeFilesWrite,
+	PermFilesDelete:     ScopeFilesWrite,
+	PermFilesShare:      ScopeFilesWrite,
+	PermTemplatesManage: ScopeTemplatesWrite,
+	PermKeysManage:      ScopeKeysManage,
+}
+
+// ownFiles is what the built-in non-admin roles may do.
+var ownFiles = []string{
+	PermFilesRead + ":own", PermFilesWrite + ":own", PermFilesDelete + ":own", PermFilesShare + ":own",
+	PermTemplatesManage, PermKeysManage,
+}
+
+// PlatformRole is the built-in role that administers every tenant.
+const PlatformRole = "platform-admin"
+
+// builtinRoles are always defined and cannot be changed. "admin" administers its own
+// tenant; only PlatformRole reaches the servers of other tenants.
+var builtinRoles = map[string][]string{
+	PlatformRole: {"*", PermPlatformAdmin},
+	"admin":      {"*"},
+	"calculator": ownFiles,
+	"analytics":  ownFiles,
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	Source      string    `json:"source"` // "builtin", "config" or "custom"
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+// validatePermissions checks a role's permissions and returns them sorted.
+func validatePermissions(permissions []string) ([]string, error) {
+	if len(permissions) == 0 {
+		return nil, fmt.Errorf("%w: at least one permission is required", ErrInvalidRole)
+	}
+	for _, permission := range permissions {
+		if permission != "*" && !slices.Contains(Permissions, permission) {
+			return nil, fmt.Errorf("%w: unknown permission %q (%s or *)", ErrInvalidRole, permission, strings.Join(Permissions, ", "))
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(permissions))), nil
+}
+
+// setConfigRoles validates the roles defined in configuration.
+func (r *Registry) setConfigRoles(roles map[string][]string) error {
+	configRoles := make(map[string][]string, len(roles))
+	for name, permissions := range roles {
+		if _, builtin := builtinRoles[name]; builtin {
+			return fmt.Errorf("%w: %s is a built-in role", ErrInvalidRole, name)
+		}
+		if !roleNamePattern.MatchString(name) {
+			return fmt.Errorf("%w: malformed role name %q", ErrInvalidRole, name)
+		}
+		sorted, err := validatePermissions(permissions)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", name, err)
+		}
+		configRoles[name] = sorted
+	}
+	r.configRoles = configRoles
+	return nil
+}
+
+// RolePermissions returns the permissions of a role: built-in roles first, then those
+// from configuration, then custom roles from the store.
+func (r *Registry) RolePermissions(ctx context.Context, name string) ([]string, error) {
+	if permissions, ok := builtinRoles[name]; ok {
+		return permissions, nil
+	}
+	if permissions, ok := r.configRoles[name]; ok {
+		return permissions, nil
+	}
+	role, err := r.store.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+// ListRoles returns every role ordered by name.
+func (r *Registry) ListRoles(ctx context.Context) ([]*Role, error) {
+	roles, err := r.store.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		role.Source = "custom"
+	}
+	for name, permissions := range builtinRoles {
+		roles = append(roles, &Role{Name: name, Permissions: permissions, Source: "builtin"})
+	}
+	for name, permissions := range r.configRoles {
+		roles = append(roles, &Role{Name: name, Permissions: permissions, Source: "config"})
+	}
+	slices.SortFunc(roles, func(a, b *Role) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return roles, nil
+}
+
+// PutRole creates or replaces a custom role.
+func (r *Registry) PutRole(ctx context.Context, name string, permissions []string) (*Role, error) {
+	if _, ok := builtinRoles[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoleReadOnly, name)
+	}
+	if _, ok := r.configRoles[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoleReadOnly, name)
+	}
+	if !roleNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be 1-63 lowercase letters, digits, '_' or '-', starting with a letter", ErrInvalidRole)
+	}
+	sorted, err := validatePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &Role{Name: name, Permissions: sorted, Source: "custom", UpdatedAt: time.Now().UTC()}
+	if err := r.store.PutRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that no server has.
+func (r *Registry) DeleteRole(ctx context.Context, name string) error {
+	if _, ok := builtinRoles[name]; ok {
+		return fmt.Errorf("%w: %s", ErrRoleReadOnly, name)
+	}
+	if _, ok := r.configRoles[name]; ok {
+		return fmt.Errorf("%w: %s", ErrRoleReadOnly, name)
+	}
+	servers, err := r.store.ListServers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if server.Role == name {
+			return fmt.Errorf("%w: server %s has role %s", ErrRoleInUse, server.ID, name)
+		}
+	}
+	return r.store.DeleteRole(ctx, name)
+}
+
+// grants reports whether a set of granted permissions covers permission. For files
+// permissions, owner is the server owning the file, or "" for files of any server.
+// PermPlatformAdmin has to be granted by name.
+func grants(granted []string, permission, caller, owner string) bool {
+	if permission == PermPlatformAdmin {
+		return slices.Contains(granted, PermPlatformAdmin)
+	}
+	if slices.Contains(granted, "*") {
+		return true
+	}
+	if !slices.Contains(ownedPermissions, permission) {
+		return slices.Contains(granted, permission)
+	}
+	if slices.Contains(granted, permission+":any") {
+		return true
+	}
+	return owner != "" && owner == caller && slices.Contains(granted, permission+":own")
+}
+
+// Authorize checks that the caller of a request holds permission, and for API keys that
+// the key has the matching scope. For files permissions, owner is the server owning the
+// file, or "" when the request covers files of every server. It returns a 403 error when
+// the caller is not authorized.
+func Authorize(c echo.Context, permission, owner string) error {
+	granted, _ := c.Get("permissions").([]string)
+	serverID, _ := c.Get("serverID").(string)
+	if !grants(granted, permission, serverID, owner) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Access denied. Requires permission: %s", permissionLabel(permission, serverID, owner)))
+	}
+
+	if scopes, isAPIKey := c.Get("apiKeyScopes").([]string); isAPIKey {
+		scope, ok := permissionScopes[permission]
+		if !ok {
+			scope = ScopeAdmin
+		}
+		if !slices.Contains(scopes, scope) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Access denied. API key lacks scope: %s", scope))
+		}
+	}
+	return nil
+}
+
+// permissionLabel names the permission a failed check needed.
+func permissionLabel(permission, caller, owner string) string {
+	if !slices.Contains(ownedPermissions, permission) {
+		return permission
+	}
+	if owner != "" && owner == caller {
+		return permission + ":own"
+	}
+	return permission + ":any"
+}
+
+// RequirePermission declares the permission a route needs. For files permissions the
+// caller needs it at least for its own files; handlers then check the file's owner.
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			owner := ""
+			if slices.Contains(ownedPermissions, permission) {
+				owner, _ = c.Get("serverID").(string)
+			}
+			if err := Authorize(c, permission, owner); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
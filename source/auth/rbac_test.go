@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	auditor := []string{"files:read:any"}
+	tests := []struct {
+		name        string
+		granted     []string
+		permission  string
+		owner       string // "" for requests covering every server's files
+		wantAllowed bool
+		wantLabel   string // Permission named when denied
+	}{
+		{"own file", ownFiles, PermFilesRead, "app", true, ""},
+		{"another server's file", ownFiles, PermFilesRead, "other", false, "files:read:any"},
+		{"every server's files", ownFiles, PermFilesRead, "", false, "files:read:any"},
+		{"any file", auditor, PermFilesRead, "other", true, ""},
+		{"delete without the permission", auditor, PermFilesDelete, "other", false, "files:delete:any"},
+		{"delete own file without the permission", auditor, PermFilesDelete, "app", false, "files:delete:own"},
+		{"unowned permission", ownFiles, PermTemplatesManage, "", true, ""},
+		{"storage maintenance", ownFiles, PermStorageManage, "", false, "storage:manage"},
+		{"all permissions", []string{"*"}, PermStorageManage, "", true, ""},
+		{"platform admin by name only", []string{"*"}, PermPlatformAdmin, "", false, "platform:admin"},
+		{"platform admin", builtinRoles[PlatformRole], PermPlatformAdmin, "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			c.Set("serverID", "app")
+			c.Set("permissions", tt.granted)
+			err := Authorize(c, tt.permission, tt.owner)
+			if tt.wantAllowed {
+				assert.NoError(t, err)
+				return
+			}
+			var httpErr *echo.HTTPError
+			require.ErrorAs(t, err, &httpErr)
+			assert.Equal(t, http.StatusForbidden, httpErr.Code)
+			assert.Equal(t, "Access denied. Requires permission: "+tt.wantLabel, httpErr.Message)
+		})
+	}
+
+	t.Run("API key scopes", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.Set("serverID", "app")
+		c.Set("permissions", ownFiles)
+		c.Set("apiKeyScopes", []string{ScopeFilesRead})
+		assert.NoError(t, Authorize(c, PermFilesRead, "app"))
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, Authorize(c, PermFilesWrite, "app"), &httpErr)
+		assert.Equal(t, "Access denied. API key lacks scope: "+ScopeFilesWrite, httpErr.Message)
+	})
+}
+
+func TestRoles(t *testing.T) {
+	ctx := context.Background()
+	registry := testRegistry(t)
+	require.NoError(t, registry.setConfigRoles(map[string][]string{"archivist": {"files:read:any", "files:read:any"}}))
+
+	permissions, err := registry.RolePermissions(ctx, "archivist")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"files:read:any"}, permissions, "configured roles are deduplicated")
+
+	role, err := registry.PutRole(ctx, "auditor", []string{"files:read:any", "files:hold"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"files:hold", "files:read:any"}, role.Permissions)
+	permissions, err = registry.RolePermissions(ctx, "auditor")
+	require.NoError(t, err)
+	assert.Equal(t, role.Permissions, permissions)
+	_, _, err = registry.RegisterServer(ctx, "it-auditor", "auditor", "north", "")
+	require.NoError(t, err)
+
+	_, err = registry.RolePermissions(ctx, "undefined")
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+	_, _, err = registry.RegisterServer(ctx, "it-nobody", "undefined", "north", "")
+	assert.ErrorIs(t, err, ErrInvalidServer)
+
+	for _, tt := range []struct {
+		name        string
+		role        string
+		permissions []string
+		wantErr     error
+	}{
+		{"unknown permission", "broken", []string{"files:read"}, ErrInvalidRole},
+		{"no permissions", "broken", nil, ErrInvalidRole},
+		{"malformed name", "Broken Role", []string{"files:read:own"}, ErrInvalidRole},
+		{"built-in role", "admin", []string{"files:read:own"}, ErrRoleReadOnly},
+		{"configured role", "archivist", []string{"files:read:own"}, ErrRoleReadOnly},
+	} {
+		_, err := registry.PutRole(ctx, tt.role, tt.permissions)
+		assert.ErrorIs(t, err, tt.wantErr, tt.name)
+	}
+
+	assert.ErrorIs(t, registry.DeleteRole(ctx, "auditor"), ErrRoleInUse)
+	assert.ErrorIs(t, registry.DeleteRole(ctx, "calculator"), ErrRoleReadOnly)
+	_, err = registry.PutRole(ctx, "unused", []string{"files:read:own"})
+	require.NoError(t, err)
+	require.NoError(t, registry.DeleteRole(ctx, "unused"))
+	_, err = registry.RolePermissions(ctx, "unused")
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+
+	roles, err := registry.ListRoles(ctx)
+	require.NoError(t, err)
+	sources := make(map[string]string)
+	for _, role := range roles {
+		sources[role.Name] = role.Source
+	}
+	assert.Equal(t, map[string]string{
+		"admin": "builtin", "analytics": "builtin", "calculator": "builtin", PlatformRole: "builtin",
+		"archivist": "config", "auditor": "custom",
+	}, sources)
+
+	assert.ErrorIs(t, registry.setConfigRoles(map[string][]string{"admin": {"*"}}), ErrInvalidRole)
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"file-manager/config"
+)
+
+var (
+	// ErrInvalidServer is returned for registrations with a malformed ID, role, tenant or PIN.
+	ErrInvalidServer = errors.New("invalid server")
+	// ErrServerDisabled is returned when a disabled server authenticates.
+	ErrServerDisabled = errors.New("server is disabled")
+	// ErrInvalidCredentials is returned for unknown servers and wrong PINs alike.
+	ErrInvalidCredentials = errors.New("invalid server ID or PIN")
+)
+
+// MinPINLength is the minimum length of registered and rotated PINs.
+const MinPINLength = 16
+
+// DefaultTenant is the tenant of servers registered without one, and of OIDC tokens
+// without a tenant claim.
+const DefaultTenant = "default"
+
+// AllTenants scopes registry calls to the servers of every tenant. Tenant names never
+// match it.
+const AllTenants = "*"
+
+var serverIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,62}$`)
+
+// demoServers are seeded into empty development stores. Their PINs are public, so the
+// service refuses to start outside development while any of them is still in use.
+var demoServers = []struct {
+	ID, PIN, Role string
+}{
+	{"calculator-server", "123", "calculator"},
+	{"analytics-server", "456", "analytics"},
+	{"admin-server", "789", PlatformRole},
+}
+
+// dummyHash is compared against for unknown server IDs, so they take as long to reject
+// as wrong PINs and cannot be told apart by timing.
+var dummyHash, _ = hashPIN("not-a-server")
+
+// Registry registers and authenticates servers.
+type Registry struct {
+	store       ServerStore
+	configRoles map[string][]string // Roles defined in configuration, set by Bootstrap
+	pinCacheTTL time.Duration       // Set by Bootstrap; 0 disables the cache
+
+	pinMu    sync.Mutex
+	pinKey   []byte
+	verified map[string]verifiedPIN // By server ID
+}
+
+// verifiedPIN is a PIN that passed bcrypt, kept as an HMAC under a key that never leaves
+// the process so that short PINs cannot be recovered from it.
+type verifiedPIN struct {
+	mac       []byte
+	hashedPIN string // Hash the PIN was checked against; rotating the PIN changes it
+	expires   time.Time
+}
+
+// NewRegistry creates a Registry backed by store.
+func NewRegistry(store ServerStore) *Registry {
+	return &Registry{store: store, pinKey: []byte(rand.Text()), verified: make(map[string]verifiedPIN)}
+}
+
+// Authenticate checks a server's PIN. Unknown servers and wrong PINs both return
+// ErrInvalidCredentials; disabled servers with a valid PIN return ErrServerDisabled.
+// PINs verified within the PIN cache TTL are not checked with bcrypt again.
+func (r *Registry) Authenticate(ctx context.Context, id, pin string) (*Server, error) {
+	server, err := r.store.GetServer(ctx, id)
+	if errors.Is(err, ErrServerNotFound) {
+		checkPINHash(pin, dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !r.pinVerified(server, pin) {
+		if !checkPINHash(pin, server.HashedPIN) {
+			return nil, ErrInvalidCredentials
+		}
+		r.rememberPIN(server, pin)
+	}
+	if server.Disabled {
+		return nil, ErrServerDisabled
+	}
+	return server, nil
+}
+
+// pinVerified reports whether pin was verified for the server's current PIN hash within
+// the cache TTL.
+func (r *Registry) pinVerified(server *Server, pin string) bool {
+	r.pinMu.Lock()
+	entry, ok := r.verified[server.ID]
+	r.pinMu.Unlock()
+	if !ok || entry.hashedPIN != server.HashedPIN || time.Now().After(entry.expires) {
+		return false
+	}
+	return hmac.Equal(entry.mac, r.pinMAC(pin))
+}
+
+// rememberPIN caches a PIN that passed bcrypt.
+func (r *Registry) rememberPIN(server *Server, pin string) {
+	if r.pinCacheTTL <= 0 {
+		return
+	}
+	entry := verifiedPIN{mac: r.pinMAC(pin), hashedPIN: server.HashedPIN, expires: time.Now().Add(r.pinCacheTTL)}
+	r.pinMu.Lock()
+	r.verified[server.ID] = entry
+	r.pinMu.Unlock()
+}
+
+// forgetPIN drops the cached PIN of a server.
+func (r *Registry) forgetPIN(id string) {
+	r.pinMu.Lock()
+	delete(r.verified, id)
+	r.pinMu.Unlock()
+}
+
+func (r *Registry) pinMAC(pin string) []byte {
+	mac := hmac.New(sha256.New, r.pinKey)
+	mac.Write([]byte(pin))
+	return mac.Sum(nil)
+}
+
+// ListServers returns the servers of tenant, or of every tenant for AllTenants.
+func (r *Registry) ListServers(ctx context.Context, tenant string) ([]*Server, error) {
+	servers, err := r.store.ListServers(ctx)
+	if err != nil || tenant == AllTenants {
+		return servers, err
+	}
+	return slices.DeleteFunc(servers, func(server *Server) bool {
+		return server.Tenant != tenant
+	}), nil
+}
+
+// tenantServer returns a server of tenant, or of any tenant for AllTenants. Servers of
+// other tenants return ErrServerNotFound, so their IDs cannot be probed.
+func (r *Registry) tenantServer(ctx context.Context, tenant, id string) (*Server, error) {
+	server, err := r.store.GetServer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != AllTenants && server.Tenant != tenant {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, id)
+	}
+	return server, nil
+}
+
+// GetServer returns a server of tenant, or of any tenant for AllTenants.
+func (r *Registry) GetServer(ctx context.Context, tenant, id string) (*Server, error) {
+	return r.tenantServer(ctx, tenant, id)
+}
+
+// GrantsPlatform reports whether a role grants PermPlatformAdmin. Undefined roles do not.
+func (r *Registry) GrantsPlatform(ctx context.Context, role string) (bool, error) {
+	permissions, err := r.RolePermissions(ctx, role)
+	if errors.Is(err, ErrRoleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, PermPlatformAdmin), nil
+}
+
+// RegisterServer registers a new server. Without a PIN a random one is generated. The
+// PIN is returned so it can be handed to the server once; only its hash is stored.
+func (r *Registry) RegisterServer(ctx context.Context, id, role, tenant, pin string) (*Server, string, error) {
+	if !serverIDPattern.MatchString(id) {
+		return nil, "", fmt.Errorf("%w: id must be 1-63 lowercase letters, digits, '.', '_' or '-'", ErrInvalidServer)
+	}
+	if role == "" {
+		return nil, "", fmt.Errorf("%w: role is required", ErrInvalidServer)
+	}
+	if _, err := r.RolePermissions(ctx, role); errors.Is(err, ErrRoleNotFound) {
+		return nil, "", fmt.Errorf("%w: role %s is not defined", ErrInvalidServer, role)
+	} else if err != nil {
+		return nil, "", err
+	}
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	if !serverIDPattern.MatchString(tenant) {
+		return nil, "", fmt.Errorf("%w: tenant must be 1-63 lowercase letters, digits, '.', '_' or '-'", ErrInvalidServer)
+	}
+	pin, hashed, err := preparePIN(pin)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	server := &Server{ID: id, HashedPIN: hashed, Role: role, Tenant: tenant, CreatedAt: now, UpdatedAt: now}
+	if err := r.store.CreateServer(ctx, server); err != nil {
+		return nil, "", err
+	}
+	return server, pin, nil
+}
+
+// RotatePIN replaces the PIN of a server of tenant, generating one when pin is empty.
+// The old PIN stops working immediately.
+func (r *Registry) RotatePIN(ctx context.Context, tenant, id, pin string) (*Server, string, error) {
+	server, err := r.tenantServer(ctx, tenant, id)
+	if err != nil {
+		return nil, "", err
+	}
+	pin, hashed, err := preparePIN(pin)
+	if err != nil {
+		return nil, "", err
+	}
+	server.HashedPIN = hashed
+	server.UpdatedAt = time.Now().UTC()
+	if err := r.store.UpdateServer(ctx, server); err != nil {
+		return nil, "", err
+	}
+	r.forgetPIN(id)
+	return server, pin, nil
+}
+
+// SetDisabled disables or re-enables a server of tenant.
+func (r *Registry) SetDisabled(ctx context.Context, tenant, id string, disabled bool) (*Server, error) {
+	server, err := r.tenantServer(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	server.Disabled = disabled
+	server.UpdatedAt = time.Now().UTC()
+	if err := r.store.UpdateServer(ctx, server); err != nil {
+		return nil, err
+	}
+	r.forgetPIN(id)
+	return server, nil
+}
+
+// Bootstrap prepares the store at startup. The PIN cache TTL and the roles from
+// configuration are applied, empty development stores are seeded with the demo servers,
+// the configured bootstrap admin is registered if missing, and outside development
+// startup fails while any demo server still accepts its public PIN.
+func (r *Registry) Bootstrap(ctx context.Context, cfg *config.AppConfig) error {
+	r.pinCacheTTL = cfg.Auth.Lockout.PINCacheTTL
+	if err := r.setConfigRoles(cfg.Auth.Roles); err != nil {
+		return err
+	}
+
+	servers, err := r.store.ListServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(servers) == 0 && cfg.IsDevelopment() {
+		now := time.Now().UTC()
+		for _, demo := range demoServers {
+			hashed, err := hashPIN(demo.PIN)
+			if err != nil {
+				return err
+			}
+			server := &Server{ID: demo.ID, HashedPIN: hashed, Role: demo.Role, Tenant: DefaultTenant, CreatedAt: now, UpdatedAt: now}
+			if err := r.store.CreateServer(ctx, server); err != nil {
+				return err
+			}
+		}
+		log.Printf("Seeded the server store with the demo servers")
+	}
+
+	if id := cfg.Auth.BootstrapAdminID; id != "" {
+		_, err := r.store.GetServer(ctx, id)
+		if errors.Is(err, ErrServerNotFound) {
+			if cfg.Auth.BootstrapAdminPIN == "" {
+				return fmt.Errorf("BOOTSTRAP_ADMIN_PIN is required to create the bootstrap admin %s", id)
+			}
+			if _, _, err := r.RegisterServer(ctx, id, PlatformRole, DefaultTenant, cfg.Auth.BootstrapAdminPIN); err != nil {
+				return fmt.Errorf("failed to create the bootstrap admin: %w", err)
+			}
+			log.Printf("Registered bootstrap admin server %s", id)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if cfg.IsDevelopment() {
+		return nil
+	}
+	for _, demo := range demoServers {
+		server, err := r.store.GetServer(ctx, demo.ID)
+		if errors.Is(err, ErrServerNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !server.Disabled && checkPINHash(demo.PIN, server.HashedPIN) {
+			return fmt.Errorf("server %s still uses its demo PIN; rotate or disable it, or set APP_ENV=development", demo.ID)
+		}
+	}
+	return nil
+}
+
+// preparePIN validates a PIN, or generates one when it is empty, and hashes it.
+func preparePIN(pin string) (string, string, error) {
+	if pin == "" {
+		pin = rand.Text()
+	}
+	if len(pin) < MinPINLength || len(pin) > 72 { // bcrypt ignores bytes past 72
+		return "", "", fmt.Errorf("%w: PIN must be %d to 72 characters", ErrInvalidServer, MinPINLength)
+	}
+	hashed, err := hashPIN(pin)
+	if err != nil {
+		return "", "", err
+	}
+	return pin, hashed, nil
+}
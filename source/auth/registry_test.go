@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPINHash is computed once, since bcrypt dominates the run time otherwise.
+var testPINHash = sync.OnceValue(func() string {
+	hashed, err := hashPIN("0123456789abcdef")
+	if err != nil {
+		panic(err)
+	}
+	return hashed
+})
+
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	store, err := NewFileServerStore(filepath.Join(t.TempDir(), "servers.json"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, s := range []struct{ id, role, tenant string }{
+		{"north-app", "calculator", "north"},
+		{"north-admin", "admin", "north"},
+		{"south-app", "calculator", "south"},
+		{"platform", PlatformRole, "ops"},
+	} {
+		server := &Server{ID: s.id, HashedPIN: testPINHash(), Role: s.role, Tenant: s.tenant, CreatedAt: time.Now()}
+		require.NoError(t, store.CreateServer(ctx, server))
+	}
+	return NewRegistry(store)
+}
+
+func TestRegistryTenantScoping(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		tenant string
+		target string
+		found  bool
+	}{
+		{"own tenant", "north", "north-app", true},
+		{"other tenant", "north", "south-app", false},
+		{"unknown server", "north", "nobody", false},
+		{"all tenants", AllTenants, "south-app", true},
+		{"no tenant", "", "north-app", false},
+	}
+	operations := map[string]func(r *Registry, tenant, id string) error{
+		"rotate PIN": func(r *Registry, tenant, id string) error {
+			_, _, err := r.RotatePIN(ctx, tenant, id, "")
+			return err
+		},
+		"disable": func(r *Registry, tenant, id string) error {
+			_, err := r.SetDisabled(ctx, tenant, id, true)
+			return err
+		},
+		"create key": func(r *Registry, tenant, id string) error {
+			_, _, err := r.CreateAPIKey(ctx, tenant, id, "ci", []string{ScopeFilesRead}, nil)
+			return err
+		},
+		"list keys": func(r *Registry, tenant, id string) error {
+			_, err := r.ListAPIKeys(ctx, tenant, id)
+			return err
+		},
+	}
+	for opName, op := range operations {
+		for _, tt := range tests {
+			t.Run(opName+"/"+tt.name, func(t *testing.T) {
+				err := op(testRegistry(t), tt.tenant, tt.target)
+				if tt.found {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrServerNotFound)
+				}
+			})
+		}
+	}
+
+	t.Run("revoke key of another tenant", func(t *testing.T) {
+		registry := testRegistry(t)
+		key, _, err := registry.CreateAPIKey(ctx, "south", "south-app", "ci", []string{ScopeFilesRead}, nil)
+		require.NoError(t, err)
+		_, err = registry.RevokeAPIKey(ctx, "north", "south-app", key.ID)
+		assert.ErrorIs(t, err, ErrServerNotFound)
+	})
+	t.Run("list servers", func(t *testing.T) {
+		registry := testRegistry(t)
+		servers, err := registry.ListServers(ctx, "north")
+		require.NoError(t, err)
+		var ids []string
+		for _, server := range servers {
+			ids = append(ids, server.ID)
+		}
+		assert.ElementsMatch(t, []string{"north-app", "north-admin"}, ids)
+
+		servers, err = registry.ListServers(ctx, AllTenants)
+		require.NoError(t, err)
+		assert.Len(t, servers, 4)
+	})
+	t.Run("platform role", func(t *testing.T) {
+		registry := testRegistry(t)
+		for role, want := range map[string]bool{PlatformRole: true, "admin": false, "calculator": false, "undefined": false} {
+			got, err := registry.GrantsPlatform(ctx, role)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, role)
+		}
+	})
+}
+
+func TestRegistryServerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "servers.json")
+	store, err := NewFileServerStore(path)
+	require.NoError(t, err)
+	registry := NewRegistry(store)
+
+	server, pin, err := registry.RegisterServer(ctx, "it-server", "calculator", "north", "")
+	require.NoError(t, err)
+	assert.Equal(t, "north", server.Tenant)
+	require.NotEmpty(t, pin, "a PIN is generated when none is given")
+	_, err = registry.Authenticate(ctx, "it-server", pin)
+	require.NoError(t, err)
+
+	_, rotated, err := registry.RotatePIN(ctx, "north", "it-server", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, pin, rotated)
+	_, err = registry.Authenticate(ctx, "it-server", pin)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "the old PIN stops working at once")
+	_, err = registry.Authenticate(ctx, "it-server", rotated)
+	require.NoError(t, err)
+
+	_, err = registry.SetDisabled(ctx, "north", "it-server", true)
+	require.NoError(t, err)
+	_, err = registry.Authenticate(ctx, "it-server", rotated)
+	assert.ErrorIs(t, err, ErrServerDisabled)
+
+	// The store file outlives the registry
+	reopened, err := NewFileServerStore(path)
+	require.NoError(t, err)
+	stored, err := reopened.GetServer(ctx, "it-server")
+	require.NoError(t, err)
+	assert.True(t, stored.Disabled)
+	assert.Equal(t, "calculator", stored.Role)
+
+	for _, tt := range []struct{ name, id, role, pin string }{
+		{"short PIN", "weak-server", "calculator", "123"},
+		{"PIN beyond bcrypt's limit", "long-server", "calculator", strings.Repeat("x", 73)},
+		{"malformed ID", "Bad Server", "calculator", ""},
+		{"no role", "roleless", "", ""},
+	} {
+		_, _, err := registry.RegisterServer(ctx, tt.id, tt.role, "north", tt.pin)
+		assert.ErrorIs(t, err, ErrInvalidServer, tt.name)
+	}
+	_, _, err = registry.RegisterServer(ctx, "it-server", "calculator", "north", "")
+	assert.ErrorIs(t, err, ErrServerExists)
+}
@@ -1,8 +1,15 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"file-manager/metadata"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -10,24 +17,21 @@ import (
 
 // Server represents a server client in the system
 type Server struct {
-	ID        string `json:"id"`
-	HashedPIN string `json:"-"`    // Don't expose PIN hash
-	Role      string `json:"role"` // e.g., "calculator-server", "data-processor"
-}
-
-// In-memory store for demo purposes. In production, use a secure database.
-var servers = map[string]*Server{
-	"calculator-server": {ID: "calculator-server", HashedPIN: hashPIN("123"), Role: "calculator"},
-	"analytics-server":  {ID: "analytics-server", HashedPIN: hashPIN("456"), Role: "analytics"},
-	"admin-server":      {ID: "admin-server", HashedPIN: hashPIN("789"), Role: "admin"},
+	ID        string    `json:"id"`
+	HashedPIN string    `json:"-"`      // Don't expose PIN hash
+	Role      string    `json:"role"`   // e.g., "calculator-server", "data-processor"
+	Tenant    string    `json:"tenant"` // Organization (e.g. clinic) the server belongs to
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func hashPIN(pin string) string {
+func hashPIN(pin string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
 	if err != nil {
-		panic(err) // In production, handle this gracefully
+		return "", fmt.Errorf("failed to hash PIN: %w", err)
 	}
-	return string(bytes)
+	return string(bytes), nil
 }
 
 func checkPINHash(pin, hash string) bool {
@@ -35,44 +39,65 @@ func checkPINHash(pin, hash string) bool {
 	return err == nil
 }
 
-// ServerAuthMiddleware provides API key/PIN based authentication for server-to-server communication.
-// It expects X-Server-ID and X-PIN headers.
-func ServerAuthMiddleware() echo.MiddlewareFunc {
+// ServerAuthMiddleware authenticates every request with the first authenticator of the
+// chain that finds its credentials: a client certificate, a request signature, an API
+// key, an OIDC bearer token or the X-Server-ID and X-PIN headers, depending on what the
+// application configures. The permissions of the identity's role are then resolved for
+// Authorize; identities with an undefined role get none. The request context is limited
+// to the identity's tenant, so no handler can reach the files of another tenant.
+// Locked out PIN attempts get 429 Too Many Requests with a Retry-After header.
+func ServerAuthMiddleware(registry *Registry, chain Chain) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			serverID := c.Request().Header.Get("X-Server-ID")
-			pin := c.Request().Header.Get("X-PIN")
-
-			if serverID == "" || pin == "" {
-				return echo.NewHTTPError(http.StatusBadRequest, "Missing X-Server-ID or X-PIN headers")
+			c.SetRequest(c.Request().WithContext(withClientIP(c.Request().Context(), c.RealIP())))
+			identity, err := chain.Authenticate(c.Request())
+			if errors.Is(err, ErrNoCredentials) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Missing API key, bearer token or X-Server-ID and X-PIN headers")
 			}
-
-			server, ok := servers[serverID]
-			if !ok || !checkPINHash(pin, server.HashedPIN) {
-				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid Server ID or PIN")
+			var lockout *LockoutError
+			if errors.As(err, &lockout) {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed attempts, try again later")
+			}
+			if errors.Is(err, ErrBodyTooLarge) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Signed request bodies are limited to %d bytes", MaxSignedBodySize))
+			}
+			if errors.Is(err, ErrServerDisabled) {
+				return echo.NewHTTPError(http.StatusForbidden, "Server is disabled")
+			}
+			if errors.Is(err, ErrInvalidCredentials) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+			}
+			if err != nil {
+				log.Printf("Error authenticating request: %v", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to authenticate")
 			}
 
-			// Store server ID and role in context for later use in handlers
-			c.Set("serverID", server.ID)
-			c.Set("serverRole", server.Role)
-
-			return next(c)
-		}
-	}
-}
+			permissions, err := registry.RolePermissions(c.Request().Context(), identity.Role)
+			if errors.Is(err, ErrRoleNotFound) {
+				log.Printf("Server %s has undefined role %q and gets no permissions", identity.ServerID, identity.Role)
+			} else if err != nil {
+				log.Printf("Error resolving role %s: %v", identity.Role, err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to authenticate")
+			}
 
-// RBACMiddleware checks server roles for authorization.
-func RBACMiddleware(requiredRole string) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			serverRole, ok := c.Get("serverRole").(string)
-			if !ok {
-				return echo.NewHTTPError(http.StatusInternalServerError, "Server role not found in context")
+			if identity.Tenant == "" {
+				identity.Tenant = DefaultTenant
 			}
 
-			if serverRole != requiredRole && serverRole != "admin" { // Admin server can do anything
-				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Access denied. Requires role: %s", requiredRole))
+			// Store server ID, role and permissions in context for later use in handlers
+			c.Set("serverID", identity.ServerID)
+			c.Set("serverRole", identity.Role)
+			c.Set("serverTenant", identity.Tenant)
+			c.Set("authMethod", identity.Method)
+			c.Set("permissions", permissions)
+			if identity.Scopes != nil {
+				c.Set("apiKeyID", identity.APIKeyID)
+				c.Set("apiKeyScopes", identity.Scopes)
 			}
+			ctx := metadata.WithActor(c.Request().Context(), identity.ServerID)
+			c.SetRequest(c.Request().WithContext(metadata.WithTenant(ctx, identity.Tenant)))
+
 			return next(c)
 		}
 	}
@@ -86,3 +111,12 @@ func GetServerIDFromContext(c echo.Context) (string, error) {
 	}
 	return serverID, nil
 }
+
+// GetTenantFromContext extracts the authenticated server's tenant from Echo context.
+func GetTenantFromContext(c echo.Context) (string, error) {
+	tenant, ok := c.Get("serverTenant").(string)
+	if !ok {
+		return "", fmt.Errorf("tenant not found in context")
+	}
+	return tenant, nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"file-manager/auth/signing"
+)
+
+// ErrBodyTooLarge is returned for signed requests whose body exceeds MaxSignedBodySize.
+var ErrBodyTooLarge = errors.New("signed request body too large")
+
+// MaxSignedBodySize bounds the body of signed requests, which is read into memory to
+// check its digest before the handler runs.
+const MaxSignedBodySize = 32 << 20
+
+// NonceCache remembers the nonces of accepted signatures until they expire.
+type NonceCache interface {
+	// Add records a nonce and reports false when it was already recorded.
+	Add(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+// InMemoryNonceCache is a NonceCache for a single instance. Instances behind a load
+// balancer each keep their own, so a replay to another instance is only stopped by the
+// timestamp check.
+type InMemoryNonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewInMemoryNonceCache creates an empty nonce cache.
+func NewInMemoryNonceCache() *InMemoryNonceCache {
+	return &InMemoryNonceCache{nonces: make(map[string]time.Time)}
+}
+
+// Add implements NonceCache. Expired nonces are dropped at most once a second.
+func (c *InMemoryNonceCache) Add(ctx context.Context, nonce string, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPrune) >= time.Second {
+		for n, exp := range c.nonces {
+			if now.After(exp) {
+				delete(c.nonces, n)
+			}
+		}
+		c.lastPrune = now
+	}
+	if exp, seen := c.nonces[nonce]; seen && !now.After(exp) {
+		return false, nil
+	}
+	c.nonces[nonce] = expires
+	return true, nil
+}
+
+// SignatureAuthenticator checks requests signed with an API key (see package signing).
+// A signature is accepted once, within MaxSkew of its timestamp.
+type SignatureAuthenticator struct {
+	Registry *Registry
+	Nonces   NonceCache
+	MaxSkew  time.Duration
+}
+
+// Authenticate implements Authenticator. It reads and replaces the request body.
+func (a SignatureAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	signature := r.Header.Get(signing.HeaderSignature)
+	if signature == "" {
+		return nil, ErrNoCredentials
+	}
+	keyID := r.Header.Get(signing.HeaderKeyID)
+	timestamp := r.Header.Get(signing.HeaderTimestamp)
+	nonce := r.Header.Get(signing.HeaderNonce)
+	if keyID == "" || timestamp == "" || len(nonce) < 16 || len(nonce) > 128 {
+		return nil, fmt.Errorf("%w: incomplete signature headers", ErrInvalidCredentials)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed timestamp", ErrInvalidCredentials)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := time.Since(signedAt); skew > a.MaxSkew || skew < -a.MaxSkew {
+		return nil, fmt.Errorf("%w: timestamp outside the allowed clock skew", ErrInvalidCredentials)
+	}
+
+	// The key is resolved first, so requests naming no usable key are turned away without
+	// buffering their body.
+	key, err := a.Registry.SigningKey(r.Context(), keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxSignedBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signed body: %w", err)
+		}
+		if len(body) > MaxSignedBodySize {
+			return nil, ErrBodyTooLarge
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	stringToSign := signing.StringToSign(r.Method, r.URL.EscapedPath(), r.URL.RawQuery, signing.BodyDigest(body), timestamp, nonce)
+	server, key, err := a.Registry.VerifySignature(r.Context(), key, stringToSign, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only verified signatures reach the cache, so forged requests cannot fill it. The
+	// nonce has to be kept until its timestamp leaves the skew window.
+	fresh, err := a.Nonces.Add(r.Context(), keyID+":"+nonce, signedAt.Add(a.MaxSkew))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: replayed nonce", ErrInvalidCredentials)
+	}
+
+	return &Identity{
+		ServerID: server.ID,
+		Role:     server.Role,
+		Tenant:   server.Tenant,
+		Method:   "signature",
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"file-manager/auth/signing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyDerivedSecrets(t *testing.T) {
+	ctx := context.Background()
+	registry := testRegistry(t)
+	key, token, err := registry.CreateAPIKey(ctx, "north", "north-app", "ci", []string{ScopeFilesRead}, nil)
+	require.NoError(t, err)
+	_, secret, ok := signing.ParseAPIKey(token)
+	require.True(t, ok)
+
+	assert.NotEqual(t, key.HashedSecret, key.SigningKey, "the verifier must not be the signing key")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"full key", token, true},
+		{"verifier as secret", signing.KeyPrefix + key.ID + "_" + key.HashedSecret, false},
+		{"signing key as secret", signing.KeyPrefix + key.ID + "_" + key.SigningKey, false},
+		{"wrong secret", signing.KeyPrefix + key.ID + "_" + secret + "x", false},
+		{"malformed", "fmk_" + key.ID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := registry.AuthenticateAPIKey(ctx, tt.token)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+// countingReader records whether a request body was read.
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestSignatureAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	registry := testRegistry(t)
+	_, token, err := registry.CreateAPIKey(ctx, "north", "north-app", "ci", []string{ScopeFilesRead}, nil)
+	require.NoError(t, err)
+	revoked, revokedToken, err := registry.CreateAPIKey(ctx, "north", "north-app", "old", []string{ScopeFilesRead}, nil)
+	require.NoError(t, err)
+	_, err = registry.RevokeAPIKey(ctx, "north", "north-app", revoked.ID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		keyID    string            // Overrides the signed key ID
+		tamper   bool              // Changes the body after signing
+		headers  map[string]string // Override signed headers
+		valid    bool
+		bodyRead bool
+	}{
+		{name: "valid signature", token: token, valid: true, bodyRead: true},
+		{name: "tampered body", token: token, tamper: true, bodyRead: true},
+		{name: "unknown key", token: token, keyID: "unknown"},
+		{name: "revoked key", token: revokedToken},
+		{name: "forged signature", token: token, headers: map[string]string{signing.HeaderSignature: "00"}, bodyRead: true},
+		{name: "stale timestamp", token: token, headers: map[string]string{signing.HeaderTimestamp: strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)}},
+		{name: "future timestamp", token: token, headers: map[string]string{signing.HeaderTimestamp: strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := signing.NewSigner(tt.token)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/v1/files/upload?x=1", strings.NewReader(`{"a":1}`))
+			require.NoError(t, signer.Sign(req))
+			if tt.keyID != "" {
+				req.Header.Set(signing.HeaderKeyID, tt.keyID)
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			content := `{"a":1}`
+			if tt.tamper {
+				content = `{"a":2}`
+			}
+			body := &countingReader{Reader: strings.NewReader(content)}
+			req.Body = io.NopCloser(body)
+
+			authenticator := SignatureAuthenticator{Registry: registry, Nonces: NewInMemoryNonceCache(), MaxSkew: time.Minute}
+			identity, err := authenticator.Authenticate(req)
+			if tt.valid {
+				require.NoError(t, err)
+				assert.Equal(t, "north-app", identity.ServerID)
+				assert.Equal(t, "north", identity.Tenant)
+				rest, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				assert.Equal(t, content, string(rest), "handlers still read the verified body")
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+			}
+			assert.Equal(t, tt.bodyRead, body.read > 0)
+		})
+	}
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		signer, err := signing.NewSigner(token)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/v1/files", nil)
+		require.NoError(t, signer.Sign(req))
+		authenticator := SignatureAuthenticator{Registry: registry, Nonces: NewInMemoryNonceCache(), MaxSkew: time.Minute}
+		_, err = authenticator.Authenticate(req)
+		require.NoError(t, err)
+		_, err = authenticator.Authenticate(req)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerNotFound is returned for unknown server IDs.
+	ErrServerNotFound = errors.New("server not found")
+	// ErrServerExists is returned when registering a server ID that is taken.
+	ErrServerExists = errors.New("server already exists")
+)
+
+// ServerStore persists the registered servers with their hashed PINs, their API keys
+// and the custom roles.
+type ServerStore interface {
+	GetServer(ctx context.Context, id string) (*Server, error)
+	ListServers(ctx context.Context) ([]*Server, error) // Ordered by ID
+	CreateServer(ctx context.Context, server *Server) error
+	UpdateServer(ctx context.Context, server *Server) error
+
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, serverID string) ([]*APIKey, error) // Oldest first
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error     // Keeps an earlier revocation
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error      // Sets the last-used time
+
+	GetRole(ctx context.Context, name string) (*Role, error)
+	ListRoles(ctx context.Context) ([]*Role, error) // Ordered by name
+	PutRole(ctx context.Context, role *Role) error  // Creates or replaces
+	DeleteRole(ctx context.Context, name string) error
+}
+
+// storedServer is the file store's record of a server, which unlike the API
+// representation includes the PIN hash.
+type storedServer struct {
+	ID        string    `json:"id"`
+	HashedPIN string    `json:"hashed_pin"`
+	Role      string    `json:"role"`
+	Tenant    string    `json:"tenant"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// storedAPIKey is the file store's record of an API key, including the secret verifier
+// and signing key.
+type storedAPIKey struct {
+	ID           string     `json:"id"`
+	ServerID     string     `json:"server_id"`
+	Name         string     `json:"name"`
+	HashedSecret string     `json:"hashed_secret"`
+	SigningKey   string     `json:"signing_key"`
+	Scopes       []string   `json:"scopes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// storedRole is the file store's record of a custom role.
+type storedRole struct {
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// storeFile is the layout of the file store.
+type storeFile struct {
+	Servers []storedServer `json:"servers"`
+	APIKeys []storedAPIKey `json:"api_keys"`
+	Roles   []storedRole   `json:"roles,omitempty"`
+}
+
+// FileServerStore keeps the servers, API keys and custom roles in a JSON file, rewritten on every
+// change. Meant for development and single-instance deployments.
+type FileServerStore struct {
+	mu      sync.RWMutex
+	path    string
+	servers map[string]*Server
+	keys    map[string]*APIKey
+	roles   map[string]*Role
+}
+
+// NewFileServerStore loads the servers from path. A missing file is an empty store.
+func NewFileServerStore(path string) (*FileServerStore, error) {
+	store := &FileServerStore{
+		path:    path,
+		servers: make(map[string]*Server),
+		keys:    make(map[string]*APIKey),
+		roles:   make(map[string]*Role),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server store %s: %w", path, err)
+	}
+	var content storeFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse server store %s: %w", path, err)
+	}
+	for _, r := range content.Servers {
+		server := Server(r)
+		store.servers[r.ID] = &server
+	}
+	for _, r := range content.APIKeys {
+		key := APIKey(r)
+		store.keys[r.ID] = &key
+	}
+	for _, r := range content.Roles {
+		store.roles[r.Name] = &Role{Name: r.Name, Permissions: r.Permissions, UpdatedAt: r.UpdatedAt}
+	}
+	return store, nil
+}
+
+// GetServer returns a copy of a server.
+func (s *FileServerStore) GetServer(ctx context.Context, id string) (*Server, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	server, ok := s.servers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, id)
+	}
+	copied := *server
+	return &copied, nil
+}
+
+// ListServers returns copies of all servers.
+func (s *FileServerStore) ListServers(ctx context.Context) ([]*Server, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	servers := make([]*Server, 0, len(s.servers))
+	for _, server := range s.servers {
+		copied := *server
+		servers = append(servers, &copied)
+	}
+	slices.SortFunc(servers, func(a, b *Server) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return servers, nil
+}
+
+// CreateServer adds a server and saves the file.
+func (s *FileServerStore) CreateServer(ctx context.Context, server *Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.servers[server.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrServerExists, server.ID)
+	}
+	copied := *server
+	s.servers[server.ID] = &copied
+	if err := s.save(); err != nil {
+		delete(s.servers, server.ID)
+		return err
+	}
+	return nil
+}
+
+// UpdateServer replaces a server and saves the file.
+func (s *FileServerStore) UpdateServer(ctx context.Context, server *Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.servers[server.ID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, server.ID)
+	}
+	copied := *server
+	s.servers[server.ID] = &copied
+	if err := s.save(); err != nil {
+		s.servers[server.ID] = previous
+		return err
+	}
+	return nil
+}
+
+// CreateAPIKey adds an API key and saves the file.
+func (s *FileServerStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("API key %s already exists", key.ID)
+	}
+	copied := *key
+	s.keys[key.ID] = &copied
+	if err := s.save(); err != nil {
+		delete(s.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+// GetAPIKey returns a copy of an API key.
+func (s *FileServerStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// ListAPIKeys returns copies of a server's API keys.
+func (s *FileServerStore) ListAPIKeys(ctx context.Context, serverID string) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0)
+	for _, key := range s.keys {
+		if key.ServerID == serverID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	slices.SortFunc(keys, compareAPIKeys)
+	return keys, nil
+}
+
+// RevokeAPIKey sets the revocation time of an API key unless it is already revoked.
+func (s *FileServerStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	return s.updateAPIKey(id, func(key *APIKey) {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &at
+		}
+	})
+}
+
+// TouchAPIKey sets the last-used time of an API key.
+func (s *FileServerStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return s.updateAPIKey(id, func(key *APIKey) {
+		key.LastUsedAt = &at
+	})
+}
+
+func (s *FileServerStore) updateAPIKey(id string, update func(*APIKey)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	copied := *previous
+	update(&copied)
+	s.keys[id] = &copied
+	if err := s.save(); err != nil {
+		s.keys[id] = previous
+		return err
+	}
+	return nil
+}
+
+// GetRole returns a copy of a custom role.
+func (s *FileServerStore) GetRole(ctx context.Context, name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	role, ok := s.roles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	copied := *role
+	return &copied, nil
+}
+
+// ListRoles returns copies of all custom roles.
+func (s *FileServerStore) ListRoles(ctx context.Context) ([]*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]*Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		copied := *role
+		roles = append(roles, &copied)
+	}
+	slices.SortFunc(roles, func(a, b *Role) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return roles, nil
+}
+
+// PutRole creates or replaces a custom role and saves the file.
+func (s *FileServerStore) PutRole(ctx context.Context, role *Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.roles[role.Name]
+	copied := *role
+	s.roles[role.Name] = &copied
+	if err := s.save(); err != nil {
+		if existed {
+			s.roles[role.Name] = previous
+		} else {
+			delete(s.roles, role.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteRole deletes a custom role and saves the file.
+func (s *FileServerStore) DeleteRole(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.roles[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	delete(s.roles, name)
+	if err := s.save(); err != nil {
+		s.roles[name] = previous
+		return err
+	}
+	return nil
+}
+
+func compareAPIKeys(a, b *APIKey) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// save writes the store to a temporary file and renames it over the store, so a crash
+// never leaves a truncated file. Callers must hold s.mu.
+func (s *FileServerStore) save() error {
+	content := storeFile{
+		Servers: make([]storedServer, 0, len(s.servers)),
+		APIKeys: make([]storedAPIKey, 0, len(s.keys)),
+		Roles:   make([]storedRole, 0, len(s.roles)),
+	}
+	for _, server := range s.servers {
+		content.Servers = append(content.Servers, storedServer(*server))
+	}
+	slices.SortFunc(content.Servers, func(a, b storedServer) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	keys := slices.Collect(maps.Values(s.keys))
+	slices.SortFunc(keys, compareAPIKeys)
+	for _, key := range keys {
+		content.APIKeys = append(content.APIKeys, storedAPIKey(*key))
+	}
+	for _, role := range s.roles {
+		content.Roles = append(content.Roles, storedRole{Name: role.Name, Permissions: role.Permissions, UpdatedAt: role.UpdatedAt})
+	}
+	slices.SortFunc(content.Roles, func(a, b storedRole) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save server store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save server store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save server store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save server store: %w", err)
+	}
+	return nil
+}
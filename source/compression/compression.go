@@ -0,0 +1,156 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"file-manager/config"
+)
+
+// Supported content encodings, named after their HTTP Content-Encoding tokens.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Codec compresses and decompresses file content for a single encoding.
+type Codec interface {
+	// Encoding returns the HTTP Content-Encoding token of this codec.
+	Encoding() string
+	// Compress returns the compressed form of data.
+	Compress(data []byte) ([]byte, error)
+	// NewReader returns a reader that decompresses r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GetCodec returns the codec for the given encoding.
+func GetCodec(encoding string) (Codec, error) {
+	switch encoding {
+	case Gzip:
+		return gzipCodec{}, nil
+	case Zstd:
+		return zstdCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// Policy decides which uploads get compressed, based on content type and size.
+type Policy struct {
+	codec        Codec
+	contentTypes []string
+	minSize      int64
+}
+
+// NewPolicy builds a Policy from configuration. A disabled configuration yields a
+// policy that never compresses.
+func NewPolicy(cfg config.CompressionConfig) (*Policy, error) {
+	if !cfg.Enabled {
+		return &Policy{}, nil
+	}
+	codec, err := GetCodec(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{
+		codec:        codec,
+		contentTypes: cfg.ContentTypes,
+		minSize:      cfg.MinSize,
+	}, nil
+}
+
+// Select returns the codec to apply to a file, or nil when the file should be stored as is.
+func (p *Policy) Select(contentType string, size int64) Codec {
+	if p.codec == nil || size < p.minSize {
+		return nil
+	}
+	if MatchContentType(p.contentTypes, contentType) {
+		return p.codec
+	}
+	return nil
+}
+
+// MatchContentType reports whether contentType matches any of the patterns.
+// Patterns are exact media types (application/json) or type wildcards (text/*);
+// parameters such as charset are ignored.
+func MatchContentType(patterns []string, contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" || pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsEncoding reports whether an Accept-Encoding header value allows the given encoding.
+func AcceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		token := strings.ToLower(strings.TrimSpace(fields[0]))
+		if token != encoding && token != "*" {
+			continue
+		}
+		// An explicit q=0 means "not acceptable"
+		rejected := false
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(param, " ", ""), "q="); ok {
+				rejected = strings.Trim(q, "0.") == ""
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Encoding() string { return Gzip }
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Encoding() string { return Zstd }
+
+func (zstdCodec) Compress(data []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil), nil
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	return dec.IOReadCloser(), nil
+}
@@ -8,17 +8,201 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // StorageConfig holds storage-related configurations
 type StorageConfig struct {
-	AWSRegion            string
-	AWSAccessKeyID       string
-	AWSSecretAccessKey   string
-	GCPProjectID         string
-	GCPCredentialsFile   string
-	DefaultCloud         string // e.g., "aws", "gcp"
-	ReplicateToAllClouds bool   // Whether to replicate uploads to all configured clouds
+	AWSRegion             string
+	AWSAccessKeyID        string
+	AWSSecretAccessKey    string
+	AWSProfile            string // Shared config profile used when static keys are not set
+	AWSEndpointURL        string // S3-compatible endpoint (MinIO, LocalStack); empty for AWS
+	AWSUsePathStyle       bool   // Path-style bucket addressing, required by most S3 stand-ins
+	AWSCABundle           string // PEM bundle to trust for a self-signed S3 endpoint
+	GCPProjectID          string
+	GCPCredentialsFile    string
+	AzureConnectionString string // Full connection string, e.g. for the Azurite emulator
+	AzureStorageAccount   string
+	AzureStorageKey       string
+	AzureEndpointURL      string // Blob service URL; defaults to https://<account>.blob.core.windows.net/
+	DefaultCloud          string // e.g., "aws", "gcp", "azure"
+	ReplicateToAllClouds  bool   // Whether to replicate uploads to all configured clouds
+
+	// Bucket routing by tenant, server, logical path or content type; BucketName is the fallback
+	Routes []StorageRoute
+
+	// Dedicated storage per tenant, keyed by tenant
+	Tenants map[string]TenantStorage
+
+	// Upload defaults, overridable per request
+	AWSEncryption        string // "", "managed" (SSE-S3) or "kms" (SSE-KMS)
+	AWSKMSKeyID          string // KMS key ARN/ID used with SSE-KMS
+	AWSStorageClass      string // e.g., "STANDARD_IA", "INTELLIGENT_TIERING"
+	GCPKMSKeyName        string // Cloud KMS key name used as CMEK
+	GCPStorageClass      string // e.g., "NEARLINE", "COLDLINE"
+	AzureEncryptionScope string // Encryption scope holding a customer-managed key
+	AzureAccessTier      string // e.g., "Hot", "Cool", "Cold"
+	CacheControl         string // Cache-Control header stored with each object
+	ContentDisposition   string // Content-Disposition header stored with each object
+}
+
+// StorageRoute maps uploads to a cloud provider and bucket. A route applies when all of its
+// non-empty match fields match the upload; the first matching route wins.
+type StorageRoute struct {
+	Tenant      string `json:"tenant,omitempty"`
+	ServerID    string `json:"server_id,omitempty"`
+	PathPrefix  string `json:"path_prefix,omitempty"`  // Logical path prefix, e.g. "/clinics/north/"
+	ContentType string `json:"content_type,omitempty"` // Exact media type or wildcard such as "image/*"
+
+	Provider       string            `json:"provider,omitempty"`        // Primary cloud; defaults to DefaultCloud
+	Bucket         string            `json:"bucket"`                    // Bucket on the primary cloud
+	ReplicaBuckets map[string]string `json:"replica_buckets,omitempty"` // Buckets on other clouds when replicating
+}
+
+// TenantStorage keeps the objects of a tenant apart from those of other tenants: they go
+// to the tenant's own buckets, and storage routes that do not name the tenant are skipped
+// for it.
+type TenantStorage struct {
+	Provider       string            `json:"provider,omitempty"`        // Primary cloud; defaults to DefaultCloud
+	Bucket         string            `json:"bucket"`                    // Bucket on the primary cloud, and on others without a replica bucket
+	ReplicaBuckets map[string]string `json:"replica_buckets,omitempty"` // Buckets on other clouds when replicating
+
+	// Customer-managed keys of the tenant, replacing the configured upload defaults
+	AWSKMSKeyID          string `json:"aws_kms_key_id,omitempty"`
+	GCPKMSKeyName        string `json:"gcp_kms_key_name,omitempty"`
+	AzureEncryptionScope string `json:"azure_encryption_scope,omitempty"`
+}
+
+// CompressionConfig controls transparent compression of stored objects
+type CompressionConfig struct {
+	Enabled      bool
+	Algorithm    string   // "gzip" or "zstd"
+	ContentTypes []string // Media types to compress, e.g. "application/json" or "text/*"
+	MinSize      int64    // Files smaller than this many bytes are stored as is
+}
+
+// LifecycleConfig holds retention and expiry rules and how often they are applied
+type LifecycleConfig struct {
+	Rules         []LifecycleRule
+	SweepInterval time.Duration // How often the background sweeper applies the rules
+}
+
+// LifecycleRule defines retention, expiry and storage class transitions for files. A rule
+// applies when all of its non-empty match fields match the file; the first matching rule wins.
+type LifecycleRule struct {
+	Name        string            `json:"name"`
+	PathPrefix  string            `json:"path_prefix,omitempty"`  // Logical path prefix, e.g. "/records/"
+	Tags        map[string]string `json:"tags,omitempty"`         // Custom tags the file must carry
+	ContentType string            `json:"content_type,omitempty"` // Exact media type or wildcard such as "image/*"
+
+	MinRetentionDays int                   `json:"min_retention_days,omitempty"` // Deletes are refused before this age
+	ExpireAfterDays  int                   `json:"expire_after_days,omitempty"`  // Files are moved to the trash at this age; 0 keeps them
+	Transitions      []LifecycleTransition `json:"transitions,omitempty"`
+}
+
+// LifecycleTransition moves the cloud copies of a file to another storage class once the
+// file reaches the given age.
+type LifecycleTransition struct {
+	AfterDays    int    `json:"after_days"`
+	Provider     string `json:"provider,omitempty"` // Limit the transition to one cloud; storage classes are provider specific
+	StorageClass string `json:"storage_class"`      // e.g. "GLACIER_IR", "COLDLINE", "Archive"
+}
+
+// TrashConfig controls soft deletes
+type TrashConfig struct {
+	Retention     time.Duration // How long deleted files stay restorable before they are purged
+	PurgeInterval time.Duration // How often the purge job runs
+}
+
+// QuotaConfig limits the storage used per server and per tenant. Servers and tenants
+// without an entry use the defaults; zero limits are unlimited.
+type QuotaConfig struct {
+	DefaultServer QuotaLimit            `json:"default_server"`
+	DefaultTenant QuotaLimit            `json:"default_tenant"`
+	Servers       map[string]QuotaLimit `json:"servers,omitempty"` // Keyed by server ID
+	Tenants       map[string]QuotaLimit `json:"tenants,omitempty"`
+}
+
+// QuotaLimit caps the stored bytes and the number of files.
+type QuotaLimit struct {
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	MaxFiles int64 `json:"max_files,omitempty"`
+}
+
+// ServerLimit returns the quota of a server.
+func (q QuotaConfig) ServerLimit(serverID string) QuotaLimit {
+	if limit, ok := q.Servers[serverID]; ok {
+		return limit
+	}
+	return q.DefaultServer
+}
+
+// TenantLimit returns the quota of a tenant.
+func (q QuotaConfig) TenantLimit(tenant string) QuotaLimit {
+	if limit, ok := q.Tenants[tenant]; ok {
+		return limit
+	}
+	return q.DefaultTenant
+}
+
+// GCConfig controls the orphan object garbage collector
+type GCConfig struct {
+	Interval    time.Duration // How often the collector runs; 0 disables the background job
+	GracePeriod time.Duration // Objects younger than this are never collected (uploads in flight)
+	DryRun      bool          // Only report orphans from the background job
+}
+
+// ShareConfig controls share links for external recipients
+type ShareConfig struct {
+	BaseURL             string        // Public URL the links start with; the request's host is used while empty
+	DefaultTTL          time.Duration // Lifetime of links created without an expiry
+	MaxTTL              time.Duration // Longest lifetime a link can have
+	MaxPasscodeAttempts int           // Wrong passcodes after which a link is revoked
+}
+
+// AuthConfig controls where server credentials are stored and how the first admin is created
+type AuthConfig struct {
+	ServerStore       string // "file" (development) or "postgres"
+	ServerStoreFile   string // JSON file used by the file store
+	BootstrapAdminID  string // Admin server created at startup when it does not exist yet
+	BootstrapAdminPIN string
+	SignatureMaxSkew  time.Duration       // Clock skew tolerated for signed requests
+	Roles             map[string][]string // Custom roles from configuration, besides those in the store
+	OIDC              OIDCConfig
+	Lockout           LockoutConfig
+}
+
+// LockoutConfig throttles PIN guessing. Server IDs and source IPs with too many recent
+// failed attempts are locked out for a time that doubles with every further failure.
+type LockoutConfig struct {
+	MaxServerFailures int           // Failed attempts on one server ID from one IP before the pair is locked out
+	MaxIPFailures     int           // Failed attempts from one source IP before it is locked out
+	BaseDuration      time.Duration // First lockout
+	MaxDuration       time.Duration // Upper bound of a lockout
+	ResetAfter        time.Duration // Failures are forgotten after this long without another one
+	PINCacheTTL       time.Duration // How long a verified PIN skips bcrypt; 0 disables the cache
+}
+
+// OIDCConfig enables bearer authentication with JWTs of an OpenID Connect provider.
+// It is disabled while Issuer is empty.
+type OIDCConfig struct {
+	Issuer          string        // Expected "iss" claim; the JWKS is discovered from it unless JWKSURL is set
+	Audience        string        // Expected "aud" claim
+	JWKSURL         string        // http(s) or file:// URL of the signing keys
+	ServerIDClaim   string        // Claim holding the server ID
+	RoleClaim       string        // Claim holding the role; dots select nested claims
+	TenantClaim     string        // Claim holding the tenant; dots select nested claims
+	RefreshInterval time.Duration // How long fetched keys are used before they are fetched again
+}
+
+// TLSConfig enables HTTPS and client certificate (mTLS) authentication
+type TLSConfig struct {
+	CertFile       string        // Server certificate chain (PEM); TLS is disabled while empty
+	KeyFile        string        // Server private key (PEM)
+	ClientCAFile   string        // CAs that sign client certificates; none are requested while empty
+	ClientAuth     string        // "optional" also accepts requests without a certificate, "require" rejects them
+	ReloadInterval time.Duration // How often the files are checked for changes
 }
 
 // DatabaseConfig holds database-related configurations
@@ -33,15 +217,33 @@ type DatabaseConfig struct {
 
 // AppConfig holds application-wide configurations
 type AppConfig struct {
+	Environment   string // "development" allows the demo servers; anything else refuses them
 	ServerPort    uint16
 	Database      DatabaseConfig
 	BucketName    string
 	GotenbergURL  string
 	StorageConfig StorageConfig
+	Compression   CompressionConfig
+	Lifecycle     LifecycleConfig
+	Trash         TrashConfig
+	Quotas        QuotaConfig
+	GC            GCConfig
+	Shares        ShareConfig
+	Auth          AuthConfig
+	TLS           TLSConfig
+	// TrustedProxies are the CIDRs of reverse proxies whose X-Forwarded-For header names
+	// the client IP. Without any, the IP of the connection is used and the header ignored.
+	TrustedProxies []string
+}
+
+// IsDevelopment reports whether the service runs in the development environment.
+func (c *AppConfig) IsDevelopment() bool {
+	return c.Environment == "development"
 }
 
 func LoadConfig() *AppConfig {
 	cfg := AppConfig{
+		Environment:  "production",
 		GotenbergURL: "http://localhost:3001",
 		Database: DatabaseConfig{
 			Name:     "equilibria_files",
@@ -62,11 +264,55 @@ func LoadConfig() *AppConfig {
 			DefaultCloud:         "aws",
 			ReplicateToAllClouds: false,
 		},
+		Compression: CompressionConfig{
+			Enabled:      false,
+			Algorithm:    "gzip",
+			ContentTypes: []string{"text/*", "application/json", "application/xml", "image/svg+xml"},
+			MinSize:      1024,
+		},
+		Lifecycle: LifecycleConfig{
+			SweepInterval: time.Hour,
+		},
+		GC: GCConfig{
+			GracePeriod: 24 * time.Hour,
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Shares: ShareConfig{
+			DefaultTTL:          7 * 24 * time.Hour,
+			MaxTTL:              30 * 24 * time.Hour,
+			MaxPasscodeAttempts: 5,
+		},
+		Auth: AuthConfig{
+			ServerStore:      "file",
+			ServerStoreFile:  "servers.json",
+			SignatureMaxSkew: 5 * time.Minute,
+			OIDC: OIDCConfig{
+				ServerIDClaim:   "sub",
+				RoleClaim:       "role",
+				TenantClaim:     "tenant",
+				RefreshInterval: time.Hour,
+			},
+			Lockout: LockoutConfig{
+				MaxServerFailures: 5,
+				MaxIPFailures:     20,
+				BaseDuration:      time.Second,
+				MaxDuration:       15 * time.Minute,
+				ResetAfter:        15 * time.Minute,
+				PINCacheTTL:       5 * time.Minute,
+			},
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "optional",
+			ReloadInterval: time.Minute,
+		},
 	}
 
+	secretsMap := make(map[string]string)
 	if secrets, exists := os.LookupEnv("SECRETS"); exists {
 		// Parse secrets which is a JSON string into a map
-		secretsMap := make(map[string]string)
 		err := json.Unmarshal([]byte(secrets), &secretsMap)
 		if err != nil {
 			log.Fatalf("Error parsing secrets: %v", err)
@@ -131,17 +377,176 @@ func LoadConfig() *AppConfig {
 		}
 	}
 
-	cfg.StorageConfig.AWSRegion = os.Getenv("AWS_REGION")
-	cfg.StorageConfig.AWSAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
-	cfg.StorageConfig.AWSSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	// Environment overrides secrets, but an unset variable must not wipe a configured value
+	if AWSRegion := os.Getenv("AWS_REGION"); AWSRegion != "" {
+		cfg.StorageConfig.AWSRegion = AWSRegion
+	}
+	if AWSAccessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); AWSAccessKeyID != "" {
+		cfg.StorageConfig.AWSAccessKeyID = AWSAccessKeyID
+	}
+	if AWSSecretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY"); AWSSecretAccessKey != "" {
+		cfg.StorageConfig.AWSSecretAccessKey = AWSSecretAccessKey
+	}
+
+	// S3-compatible endpoints and credential chain
+	cfg.StorageConfig.AWSProfile = settingOr(secretsMap, "AWS_PROFILE", cfg.StorageConfig.AWSProfile)
+	cfg.StorageConfig.AWSEndpointURL = settingOr(secretsMap, "AWS_ENDPOINT_URL", cfg.StorageConfig.AWSEndpointURL)
+	cfg.StorageConfig.AWSUsePathStyle = settingOr(secretsMap, "AWS_S3_USE_PATH_STYLE", strconv.FormatBool(cfg.StorageConfig.AWSUsePathStyle)) == "true"
+	cfg.StorageConfig.AWSCABundle = settingOr(secretsMap, "AWS_CA_BUNDLE", cfg.StorageConfig.AWSCABundle)
 
 	if gotenbergEnv := os.Getenv("GOTENBERG_URL"); gotenbergEnv != "" {
 		cfg.GotenbergURL = gotenbergEnv
 	}
 
+	// Azure Blob Storage
+	cfg.StorageConfig.AzureConnectionString = settingOr(secretsMap, "AZURE_STORAGE_CONNECTION_STRING", cfg.StorageConfig.AzureConnectionString)
+	cfg.StorageConfig.AzureStorageAccount = settingOr(secretsMap, "AZURE_STORAGE_ACCOUNT", cfg.StorageConfig.AzureStorageAccount)
+	cfg.StorageConfig.AzureStorageKey = settingOr(secretsMap, "AZURE_STORAGE_KEY", cfg.StorageConfig.AzureStorageKey)
+	cfg.StorageConfig.AzureEndpointURL = settingOr(secretsMap, "AZURE_STORAGE_ENDPOINT", cfg.StorageConfig.AzureEndpointURL)
+
+	// Upload defaults
+	cfg.StorageConfig.AWSEncryption = settingOr(secretsMap, "AWS_ENCRYPTION", cfg.StorageConfig.AWSEncryption)
+	cfg.StorageConfig.AWSKMSKeyID = settingOr(secretsMap, "AWS_KMS_KEY_ID", cfg.StorageConfig.AWSKMSKeyID)
+	cfg.StorageConfig.AWSStorageClass = settingOr(secretsMap, "AWS_STORAGE_CLASS", cfg.StorageConfig.AWSStorageClass)
+	cfg.StorageConfig.GCPKMSKeyName = settingOr(secretsMap, "GCP_KMS_KEY_NAME", cfg.StorageConfig.GCPKMSKeyName)
+	cfg.StorageConfig.GCPStorageClass = settingOr(secretsMap, "GCP_STORAGE_CLASS", cfg.StorageConfig.GCPStorageClass)
+	cfg.StorageConfig.AzureEncryptionScope = settingOr(secretsMap, "AZURE_ENCRYPTION_SCOPE", cfg.StorageConfig.AzureEncryptionScope)
+	cfg.StorageConfig.AzureAccessTier = settingOr(secretsMap, "AZURE_ACCESS_TIER", cfg.StorageConfig.AzureAccessTier)
+	cfg.StorageConfig.CacheControl = settingOr(secretsMap, "CACHE_CONTROL", cfg.StorageConfig.CacheControl)
+	cfg.StorageConfig.ContentDisposition = settingOr(secretsMap, "CONTENT_DISPOSITION", cfg.StorageConfig.ContentDisposition)
+
+	// Bucket routing, from a JSON file or an inline JSON array
+	loadJSONSetting(secretsMap, "STORAGE_ROUTES", &cfg.StorageConfig.Routes)
+	loadJSONSetting(secretsMap, "TENANT_STORAGE", &cfg.StorageConfig.Tenants)
+
+	// Compression
+	cfg.Compression.Enabled = settingOr(secretsMap, "COMPRESSION_ENABLED", strconv.FormatBool(cfg.Compression.Enabled)) == "true"
+	cfg.Compression.Algorithm = settingOr(secretsMap, "COMPRESSION_ALGORITHM", cfg.Compression.Algorithm)
+	if contentTypes := settingOr(secretsMap, "COMPRESSION_CONTENT_TYPES", ""); contentTypes != "" {
+		cfg.Compression.ContentTypes = strings.Split(contentTypes, ",")
+	}
+	if minSize := settingOr(secretsMap, "COMPRESSION_MIN_SIZE", ""); minSize != "" {
+		size, err := strconv.ParseInt(minSize, 10, 64)
+		if err != nil {
+			log.Fatalf("Error parsing COMPRESSION_MIN_SIZE: %v", err)
+		}
+		cfg.Compression.MinSize = size
+	}
+
+	// Lifecycle and retention rules
+	loadJSONSetting(secretsMap, "LIFECYCLE_RULES", &cfg.Lifecycle.Rules)
+	cfg.Lifecycle.SweepInterval = durationSetting(secretsMap, "LIFECYCLE_SWEEP_INTERVAL", cfg.Lifecycle.SweepInterval)
+
+	// Trash
+	cfg.Trash.Retention = durationSetting(secretsMap, "TRASH_RETENTION", cfg.Trash.Retention)
+	cfg.Trash.PurgeInterval = durationSetting(secretsMap, "TRASH_PURGE_INTERVAL", cfg.Trash.PurgeInterval)
+
+	// Storage quotas per server and tenant
+	loadJSONSetting(secretsMap, "QUOTAS", &cfg.Quotas)
+
+	// Orphan object garbage collection
+	cfg.GC.Interval = durationSetting(secretsMap, "GC_INTERVAL", cfg.GC.Interval)
+	cfg.GC.GracePeriod = durationSetting(secretsMap, "GC_GRACE_PERIOD", cfg.GC.GracePeriod)
+	cfg.GC.DryRun = settingOr(secretsMap, "GC_DRY_RUN", strconv.FormatBool(cfg.GC.DryRun)) == "true"
+
+	// Share links
+	cfg.Shares.BaseURL = strings.TrimSuffix(settingOr(secretsMap, "SHARE_BASE_URL", cfg.Shares.BaseURL), "/")
+	cfg.Shares.DefaultTTL = durationSetting(secretsMap, "SHARE_DEFAULT_TTL", cfg.Shares.DefaultTTL)
+	cfg.Shares.MaxTTL = durationSetting(secretsMap, "SHARE_MAX_TTL", cfg.Shares.MaxTTL)
+	cfg.Shares.MaxPasscodeAttempts = positiveIntSetting(secretsMap, "SHARE_MAX_PASSCODE_ATTEMPTS", cfg.Shares.MaxPasscodeAttempts)
+
+	// Server credentials
+	cfg.Environment = settingOr(secretsMap, "APP_ENV", cfg.Environment)
+	cfg.Auth.ServerStore = settingOr(secretsMap, "SERVER_STORE", cfg.Auth.ServerStore)
+	cfg.Auth.ServerStoreFile = settingOr(secretsMap, "SERVER_STORE_FILE", cfg.Auth.ServerStoreFile)
+	cfg.Auth.BootstrapAdminID = settingOr(secretsMap, "BOOTSTRAP_ADMIN_ID", cfg.Auth.BootstrapAdminID)
+	cfg.Auth.BootstrapAdminPIN = settingOr(secretsMap, "BOOTSTRAP_ADMIN_PIN", cfg.Auth.BootstrapAdminPIN)
+	loadJSONSetting(secretsMap, "ROLES", &cfg.Auth.Roles)
+	cfg.Auth.SignatureMaxSkew = durationSetting(secretsMap, "SIGNATURE_MAX_SKEW", cfg.Auth.SignatureMaxSkew)
+	cfg.Auth.OIDC.Issuer = settingOr(secretsMap, "OIDC_ISSUER", cfg.Auth.OIDC.Issuer)
+	cfg.Auth.OIDC.Audience = settingOr(secretsMap, "OIDC_AUDIENCE", cfg.Auth.OIDC.Audience)
+	cfg.Auth.OIDC.JWKSURL = settingOr(secretsMap, "OIDC_JWKS_URL", cfg.Auth.OIDC.JWKSURL)
+	cfg.Auth.OIDC.ServerIDClaim = settingOr(secretsMap, "OIDC_SERVER_ID_CLAIM", cfg.Auth.OIDC.ServerIDClaim)
+	cfg.Auth.OIDC.RoleClaim = settingOr(secretsMap, "OIDC_ROLE_CLAIM", cfg.Auth.OIDC.RoleClaim)
+	cfg.Auth.OIDC.TenantClaim = settingOr(secretsMap, "OIDC_TENANT_CLAIM", cfg.Auth.OIDC.TenantClaim)
+	cfg.Auth.OIDC.RefreshInterval = durationSetting(secretsMap, "OIDC_JWKS_REFRESH", cfg.Auth.OIDC.RefreshInterval)
+	cfg.Auth.Lockout.MaxServerFailures = positiveIntSetting(secretsMap, "AUTH_MAX_SERVER_FAILURES", cfg.Auth.Lockout.MaxServerFailures)
+	cfg.Auth.Lockout.MaxIPFailures = positiveIntSetting(secretsMap, "AUTH_MAX_IP_FAILURES", cfg.Auth.Lockout.MaxIPFailures)
+	cfg.Auth.Lockout.BaseDuration = durationSetting(secretsMap, "AUTH_LOCKOUT_BASE", cfg.Auth.Lockout.BaseDuration)
+	cfg.Auth.Lockout.MaxDuration = durationSetting(secretsMap, "AUTH_LOCKOUT_MAX", cfg.Auth.Lockout.MaxDuration)
+	cfg.Auth.Lockout.ResetAfter = durationSetting(secretsMap, "AUTH_LOCKOUT_RESET", cfg.Auth.Lockout.ResetAfter)
+	cfg.Auth.Lockout.PINCacheTTL = durationSetting(secretsMap, "PIN_CACHE_TTL", cfg.Auth.Lockout.PINCacheTTL)
+	cfg.TLS.CertFile = settingOr(secretsMap, "TLS_CERT_FILE", cfg.TLS.CertFile)
+	cfg.TLS.KeyFile = settingOr(secretsMap, "TLS_KEY_FILE", cfg.TLS.KeyFile)
+	cfg.TLS.ClientCAFile = settingOr(secretsMap, "TLS_CLIENT_CA_FILE", cfg.TLS.ClientCAFile)
+	cfg.TLS.ClientAuth = settingOr(secretsMap, "TLS_CLIENT_AUTH", cfg.TLS.ClientAuth)
+	cfg.TLS.ReloadInterval = durationSetting(secretsMap, "TLS_RELOAD_INTERVAL", cfg.TLS.ReloadInterval)
+
+	// Reverse proxies allowed to report the client IP
+	for _, cidr := range strings.Split(settingOr(secretsMap, "TRUSTED_PROXIES", ""), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, cidr)
+		}
+	}
+
 	return &cfg
 }
 
+// settingOr returns the value of key from the environment, then from the parsed
+// SECRETS map, falling back to the given default when neither is set.
+func settingOr(secrets map[string]string, key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if value, exists := secrets[key]; exists && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// durationSetting parses a duration setting such as "1h30m", falling back to the given default.
+func durationSetting(secrets map[string]string, key string, fallback time.Duration) time.Duration {
+	value := settingOr(secrets, key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Error parsing %s: %v", key, err)
+	}
+	return d
+}
+
+func positiveIntSetting(secrets map[string]string, key string, fallback int) int {
+	value := settingOr(secrets, key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Fatalf("Error parsing %s: must be a positive integer, got %q", key, value)
+	}
+	return n
+}
+
+// loadJSONSetting decodes a JSON setting into dst, reading it from the file named by
+// key+"_FILE" when set, or from key itself otherwise.
+func loadJSONSetting(secrets map[string]string, key string, dst any) {
+	if file := settingOr(secrets, key+"_FILE", ""); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Error reading %s_FILE: %v", key, err)
+		}
+		if err := json.Unmarshal(data, dst); err != nil {
+			log.Fatalf("Error parsing %s_FILE: %v", key, err)
+		}
+	} else if value := settingOr(secrets, key, ""); value != "" {
+		if err := json.Unmarshal([]byte(value), dst); err != nil {
+			log.Fatalf("Error parsing %s: %v", key, err)
+		}
+	}
+}
+
 func (c *AppConfig) LoadDbUri() string {
 	db := c.Database
 	databaseUri := fmt.Sprintf(
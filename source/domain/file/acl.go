@@ -0,0 +1,112 @@
+package file
+
+import (
+	"context"
+	"fmt"
+
+	"file-manager/metadata"
+)
+
+// InheritedACL returns the entries a file inherits from its enclosing folders.
+func (s *FileRepo) InheritedACL(ctx context.Context, fileMeta *metadata.FileMetadata) (metadata.ACL, error) {
+	inherited, err := s.metadataStore.InheritedACL(ctx, fileMeta.LogicalPath)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.ApplicableACL(inherited, fileMeta), nil
+}
+
+// EffectiveACL returns the ACL that applies to a file: that of its enclosing folders
+// followed by its own.
+func (s *FileRepo) EffectiveACL(ctx context.Context, fileMeta *metadata.FileMetadata) (metadata.ACL, error) {
+	inherited, err := s.InheritedACL(ctx, fileMeta)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.EffectiveACL(inherited, fileMeta), nil
+}
+
+// sharedWith reports whether a file's ACL grants access to the principal.
+func (s *FileRepo) sharedWith(ctx context.Context, fileMeta *metadata.FileMetadata, p *metadata.Principal, access string) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	acl, err := s.EffectiveACL(ctx, fileMeta)
+	if err != nil {
+		return false, err
+	}
+	return acl.Grants(*p, access), nil
+}
+
+// SetFileACL replaces a file's own ACL. Access inherited from folders is not affected.
+// Files under legal hold cannot be shared or unshared.
+func (s *FileRepo) SetFileACL(ctx context.Context, fileID string, acl metadata.ACL) (*metadata.FileMetadata, error) {
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	latest, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLegalHold(latest); err != nil {
+		return nil, err
+	}
+	acl = acl.GrantedBy("") // Only folder entries are marked
+	return s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{ACL: &acl}, 0)
+}
+
+// GetFolderACL returns a folder's own ACL and the entries it inherits from the folders
+// above it.
+func (s *FileRepo) GetFolderACL(ctx context.Context, folder string) (own, inherited metadata.ACL, err error) {
+	own, err = s.metadataStore.GetFolderACL(ctx, folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	if folder != "/" {
+		inherited, err = s.metadataStore.InheritedACL(ctx, folder[:len(folder)-1])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return own, inherited, nil
+}
+
+// SetFolderACL replaces a folder's own ACL, which then applies to every file under it,
+// including files added later, and returns the folder's new ACL. A non-empty owner
+// requires every file under the folder to belong to that server, and the entries are
+// marked as granted by it, so they never cover files other servers upload into the
+// folder. Such an owner only replaces the entries it granted itself; those of other
+// servers, such as admins, are kept.
+func (s *FileRepo) SetFolderACL(ctx context.Context, folder string, acl metadata.ACL, owner string) (metadata.ACL, error) {
+	if owner == "" {
+		s.folderACLMu.Lock()
+		defer s.folderACLMu.Unlock()
+		acl = acl.GrantedBy("")
+		return acl, s.metadataStore.SetFolderACL(ctx, folder, acl)
+	}
+
+	files, err := s.metadataStore.ListFileMetadata(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileMeta := range files {
+		if fileMeta.UploadedBy != owner {
+			return nil, fmt.Errorf("%w: %s", ErrFolderNotOwned, folder)
+		}
+	}
+
+	s.folderACLMu.Lock()
+	defer s.folderACLMu.Unlock()
+	current, err := s.metadataStore.GetFolderACL(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	var merged metadata.ACL
+	for _, entry := range current {
+		if entry.GrantedBy != owner {
+			merged = append(merged, entry)
+		}
+	}
+	merged = append(merged, acl.GrantedBy(owner)...)
+	return merged, s.metadataStore.SetFolderACL(ctx, folder, merged)
+}
@@ -0,0 +1,194 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderACLInheritance(t *testing.T) {
+	billing := metadata.ACL{{Server: "billing", Access: []string{metadata.AccessRead}}}
+	tests := []struct {
+		name     string
+		owner    string // Of the SetFolderACL call; "" for files:write:any
+		files    []*metadata.FileMetadata
+		later    *metadata.FileMetadata // Uploaded after the grant
+		wantErr  error
+		readable map[string]bool // File ID -> billing can read it
+	}{
+		{
+			name:     "owner's grant covers its later uploads",
+			owner:    "owner",
+			files:    []*metadata.FileMetadata{{ID: "a", LogicalPath: "/shared/a.pdf", UploadedBy: "owner"}},
+			later:    &metadata.FileMetadata{ID: "b", LogicalPath: "/shared/b.pdf", UploadedBy: "owner"},
+			readable: map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:     "grant on an empty folder skips other uploaders",
+			owner:    "intruder",
+			later:    &metadata.FileMetadata{ID: "b", LogicalPath: "/shared/b.pdf", UploadedBy: "victim"},
+			readable: map[string]bool{"b": false},
+		},
+		{
+			name:     "grant skips later uploads of other servers",
+			owner:    "owner",
+			files:    []*metadata.FileMetadata{{ID: "a", LogicalPath: "/shared/a.pdf", UploadedBy: "owner"}},
+			later:    &metadata.FileMetadata{ID: "b", LogicalPath: "/shared/sub/b.pdf", UploadedBy: "victim"},
+			readable: map[string]bool{"a": true, "b": false},
+		},
+		{
+			name:    "folder with files of other servers",
+			owner:   "owner",
+			files:   []*metadata.FileMetadata{{ID: "a", LogicalPath: "/shared/a.pdf", UploadedBy: "victim"}},
+			wantErr: ErrFolderNotOwned,
+		},
+		{
+			name:     "grant of a server with files:write:any covers everyone",
+			owner:    "",
+			files:    []*metadata.FileMetadata{{ID: "a", LogicalPath: "/shared/a.pdf", UploadedBy: "owner"}},
+			later:    &metadata.FileMetadata{ID: "b", LogicalPath: "/shared/b.pdf", UploadedBy: "victim"},
+			readable: map[string]bool{"a": true, "b": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, &config.AppConfig{})
+			addFiles(t, ctx, repo, tt.files...)
+
+			_, err := repo.SetFolderACL(ctx, "/shared/", billing, tt.owner)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.later != nil {
+				addFiles(t, ctx, repo, tt.later)
+			}
+
+			for id, want := range tt.readable {
+				meta, err := repo.GetFileMetadata(ctx, id)
+				require.NoError(t, err)
+				got, err := repo.sharedWith(ctx, meta, &metadata.Principal{ServerID: "billing"}, metadata.AccessRead)
+				require.NoError(t, err)
+				assert.Equal(t, want, got, id)
+
+				page, err := repo.QueryFiles(ctx, metadata.Query{UploadedBy: "billing", SharedWith: &metadata.Principal{ServerID: "billing"}})
+				require.NoError(t, err)
+				found := false
+				for _, shared := range page.Files {
+					found = found || shared.ID == id
+				}
+				assert.Equal(t, want, found, "search of %s", id)
+			}
+		})
+	}
+
+	t.Run("clients cannot forge the granter", func(t *testing.T) {
+		ctx := metadata.WithTenant(context.Background(), "clinic")
+		repo := newTestRepo(t, &config.AppConfig{})
+		forged := metadata.ACL{{Server: "billing", Access: []string{metadata.AccessRead}}}.GrantedBy("victim")
+		_, err := repo.SetFolderACL(ctx, "/shared/", forged, "intruder")
+		require.NoError(t, err)
+		own, _, err := repo.GetFolderACL(ctx, "/shared/")
+		require.NoError(t, err)
+		require.Len(t, own, 1)
+		assert.Equal(t, "intruder", own[0].GrantedBy)
+	})
+}
+
+func TestSetFolderACLKeepsOtherGrants(t *testing.T) {
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	repo := newTestRepo(t, &config.AppConfig{})
+	addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "a", LogicalPath: "/shared/a.pdf", UploadedBy: "owner"})
+	auditors := metadata.ACL{{Role: "auditor", Access: []string{metadata.AccessRead}}}
+	billing := metadata.ACL{{Server: "billing", Access: []string{metadata.AccessRead}}}
+	setBy := func(owner string, acl metadata.ACL) metadata.ACL {
+		t.Helper()
+		got, err := repo.SetFolderACL(ctx, "/shared/", acl, owner)
+		require.NoError(t, err)
+		stored, _, err := repo.GetFolderACL(ctx, "/shared/")
+		require.NoError(t, err)
+		assert.Equal(t, stored, got, "the returned ACL is the stored one")
+		return got
+	}
+
+	setBy("", auditors)
+	assert.Equal(t, append(auditors.Clone(), billing.GrantedBy("owner")...), setBy("owner", billing), "the owner adds to the admin's entries")
+	assert.Equal(t, append(auditors.Clone(), billing.GrantedBy("owner")...), setBy("owner", billing), "and replaces its own")
+	assert.Equal(t, auditors, setBy("owner", nil), "the owner removes only its own entries")
+	assert.Empty(t, setBy("", nil), "admins replace every entry")
+}
+
+func TestSetFileACL(t *testing.T) {
+	acl := metadata.ACL{{Role: "analytics", Access: []string{metadata.AccessRead}}}
+	tests := []struct {
+		name    string
+		hold    *metadata.LegalHold
+		acl     metadata.ACL
+		wantErr error
+	}{
+		{name: "set entries", acl: acl},
+		{name: "invalid entries", acl: metadata.ACL{{Role: "analytics"}}, wantErr: metadata.ErrInvalidPatch},
+		{name: "file under legal hold", hold: &metadata.LegalHold{Reason: "audit", SetAt: time.Now()}, acl: acl, wantErr: ErrLegalHold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, &config.AppConfig{})
+			addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/a.pdf", UploadedBy: "app", LegalHold: tt.hold})
+
+			updated, err := repo.SetFileACL(ctx, "f", tt.acl)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				stored, err := repo.GetFileMetadata(ctx, "f")
+				require.NoError(t, err)
+				assert.Empty(t, stored.ACL)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.acl, updated.ACL)
+		})
+	}
+}
+
+func TestFileACLAccess(t *testing.T) {
+	northApp := caller{"north-app", "calculator", "north", ownFiles}
+	analyst := caller{"analyst", "analytics", "north", ownFiles}
+	owner, repo := testRouter(t, northApp)
+	shared := routerAs(repo, analyst)
+	assert.Equal(t, http.StatusForbidden, serve(shared, http.MethodGet, "/files/n", "", nil).Code, "not shared yet")
+
+	rec := serve(owner, http.MethodPut, "/folders/acl?path=/docs", `{"acl": [{"role": "analytics", "access": ["read"]}]}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusOK, serve(shared, http.MethodGet, "/files/n", "", nil).Code, "read through the folder")
+	rec = serve(shared, http.MethodGet, "/folders?path=/docs", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listing metadata.FolderListing
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	require.Len(t, listing.Files, 1, "shared files are listed")
+	assert.Equal(t, "n", listing.Files[0].ID)
+	assert.Equal(t, http.StatusForbidden, serve(shared, http.MethodPatch, "/files/n", `{"file_name": "x.pdf"}`, nil).Code, "write was not granted")
+
+	rec = serve(owner, http.MethodPut, "/files/n/acl", `{"acl": [{"server": "analyst", "access": ["write"]}]}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusOK, serve(shared, http.MethodPatch, "/files/n", `{"file_name": "x.pdf"}`, nil).Code, "write through the file")
+	assert.Equal(t, http.StatusForbidden, serve(shared, http.MethodDelete, "/files/n", "", nil).Code, "delete was not granted")
+	assert.Equal(t, http.StatusForbidden, serve(shared, http.MethodPut, "/files/n/acl", `{"acl": []}`, nil).Code, "shared servers cannot change the ACL")
+	assert.Equal(t, http.StatusBadRequest, serve(owner, http.MethodPut, "/files/n/acl", `{"acl": [{"role": "analytics", "access": ["share"]}]}`, nil).Code)
+
+	rec = serve(owner, http.MethodGet, "/files/n/acl", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var acls struct{ ACL, Inherited metadata.ACL }
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &acls))
+	assert.Equal(t, metadata.ACL{{Server: "analyst", Access: []string{metadata.AccessWrite}}}, acls.ACL)
+	assert.Equal(t, metadata.ACL{{Role: "analytics", Access: []string{metadata.AccessRead}, GrantedBy: "north-app"}}, acls.Inherited)
+}
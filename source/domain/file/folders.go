@@ -0,0 +1,175 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"file-manager/metadata"
+)
+
+var (
+	// ErrInvalidFolder is returned for folder operations on the root or into themselves.
+	ErrInvalidFolder = errors.New("invalid folder operation")
+	// ErrFolderNotOwned is returned when a folder holds files of other servers.
+	ErrFolderNotOwned = errors.New("folder contains files of other servers")
+)
+
+// ListFolder returns the immediate subfolders and files of a folder. A non-empty owner
+// limits the files to those uploaded by that server, and to those whose ACL lets
+// sharedWith read them, and the subfolders to those holding at least one such file, so
+// the names of other servers' folders are not revealed.
+func (s *FileRepo) ListFolder(ctx context.Context, folder, owner string, sharedWith *metadata.Principal) (*metadata.FolderListing, error) {
+	listing, err := s.metadataStore.ListFolder(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" {
+		return listing, nil
+	}
+
+	files := listing.Files[:0]
+	for _, m := range listing.Files {
+		visible, err := s.visibleTo(ctx, m, owner, sharedWith)
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			files = append(files, m)
+		}
+	}
+	listing.Files = files
+
+	below, err := s.metadataStore.ListFileMetadata(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	visibleFolders := make(map[string]bool)
+	for _, m := range below {
+		rest := strings.TrimPrefix(m.LogicalPath, folder)
+		i := strings.Index(rest, "/")
+		if m.InTrash() || i < 0 || visibleFolders[folder+rest[:i+1]] {
+			continue
+		}
+		visible, err := s.visibleTo(ctx, m, owner, sharedWith)
+		if err != nil {
+			return nil, err
+		}
+		visibleFolders[folder+rest[:i+1]] = visible
+	}
+	listing.Folders = slices.DeleteFunc(listing.Folders, func(sub string) bool { return !visibleFolders[sub] })
+	return listing, nil
+}
+
+// visibleTo reports whether a file was uploaded by owner or its ACL lets sharedWith read it.
+func (s *FileRepo) visibleTo(ctx context.Context, fileMeta *metadata.FileMetadata, owner string, sharedWith *metadata.Principal) (bool, error) {
+	if fileMeta.UploadedBy == owner {
+		return true, nil
+	}
+	return s.sharedWith(ctx, fileMeta, sharedWith, metadata.AccessRead)
+}
+
+// checkFolderOwner returns ErrFolderNotOwned unless a file under a folder belongs to
+// owner or its ACL grants access to sharedWith. An empty owner allows every file.
+func (s *FileRepo) checkFolderOwner(ctx context.Context, folder string, fileMeta *metadata.FileMetadata, owner string, sharedWith *metadata.Principal, access string) error {
+	if owner == "" || fileMeta.UploadedBy == owner {
+		return nil
+	}
+	shared, err := s.sharedWith(ctx, fileMeta, sharedWith, access)
+	if err != nil {
+		return err
+	}
+	if !shared {
+		return fmt.Errorf("%w: %s", ErrFolderNotOwned, folder)
+	}
+	return nil
+}
+
+// CreateFolder creates an empty folder.
+func (s *FileRepo) CreateFolder(ctx context.Context, folder string) error {
+	if folder == "/" {
+		return fmt.Errorf("%w: the root folder always exists", ErrInvalidFolder)
+	}
+	return s.metadataStore.CreateFolder(ctx, folder)
+}
+
+// MoveFolder renames a folder with all of its files and subfolders, atomically in the
+// metadata store. Stored objects keep their keys; only logical paths change. A non-empty
+// owner requires every file under the folder to belong to that server or to be writable
+// by sharedWith through its ACL. Files under legal hold block the move, and so do files
+// whose running retention the new paths would lift.
+func (s *FileRepo) MoveFolder(ctx context.Context, from, to, owner string, sharedWith *metadata.Principal) (int, error) {
+	if from == "/" || to == "/" || strings.HasPrefix(to, from) {
+		return 0, fmt.Errorf("%w: cannot move %s to %s", ErrInvalidFolder, from, to)
+	}
+
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	files, err := s.metadataStore.ListFileMetadata(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for _, fileMeta := range files {
+		if err := s.checkFolderOwner(ctx, from, fileMeta, owner, sharedWith, metadata.AccessWrite); err != nil {
+			return 0, err
+		}
+		if err := checkLegalHold(fileMeta); err != nil {
+			return 0, fmt.Errorf("%s: %w", fileMeta.LogicalPath, err)
+		}
+		moved := *fileMeta
+		moved.LogicalPath = to + strings.TrimPrefix(fileMeta.LogicalPath, from)
+		if err := s.lifecycle.CheckChange(fileMeta, &moved, now); err != nil {
+			return 0, fmt.Errorf("%s: %w", fileMeta.LogicalPath, err)
+		}
+	}
+
+	return s.metadataStore.MoveFolder(ctx, from, to)
+}
+
+// DeleteFolder moves every file under a folder to the trash and removes its empty
+// folders. Nothing is deleted if any file is under legal hold or retention, or, with a
+// non-empty owner, belongs to another server and its ACL does not let sharedWith delete
+// it. It returns the number of files deleted.
+func (s *FileRepo) DeleteFolder(ctx context.Context, folder, owner string, sharedWith *metadata.Principal, deletedBy string) (int, error) {
+	if folder == "/" {
+		return 0, fmt.Errorf("%w: cannot delete the root folder", ErrInvalidFolder)
+	}
+
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	files, err := s.metadataStore.ListFileMetadata(ctx, folder)
+	if err != nil {
+		return 0, err
+	}
+	files = slices.DeleteFunc(files, (*metadata.FileMetadata).InTrash)
+
+	now := time.Now()
+	for _, fileMeta := range files {
+		if err := s.checkFolderOwner(ctx, folder, fileMeta, owner, sharedWith, metadata.AccessDelete); err != nil {
+			return 0, err
+		}
+		if err := checkLegalHold(fileMeta); err != nil {
+			return 0, fmt.Errorf("%s: %w", fileMeta.LogicalPath, err)
+		}
+		if err := s.lifecycle.CheckDelete(fileMeta, now); err != nil {
+			return 0, fmt.Errorf("%s: %w", fileMeta.LogicalPath, err)
+		}
+	}
+
+	for i, fileMeta := range files {
+		_, err := s.metadataStore.UpdateFileMetadata(ctx, fileMeta.ID, metadata.Patch{DeletedAt: &now, DeletedBy: &deletedBy}, 0)
+		if err != nil {
+			return i, fmt.Errorf("failed to move %s to the trash: %w", fileMeta.LogicalPath, err)
+		}
+	}
+	if err := s.metadataStore.DeleteFolder(ctx, folder); err != nil {
+		return len(files), err
+	}
+	return len(files), nil
+}
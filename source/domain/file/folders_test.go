@@ -0,0 +1,100 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFolder(t *testing.T) {
+	deleted := time.Now()
+	tests := []struct {
+		name        string
+		as          caller
+		wantFolders []string
+		wantFiles   []string
+	}{
+		{
+			name:        "own and shared files",
+			as:          caller{"north-app", "calculator", "north", ownFiles},
+			wantFolders: []string{"/docs/mine/", "/docs/shared/"},
+			wantFiles:   []string{"n"},
+		},
+		{
+			name:        "files:read:any",
+			as:          caller{"north-admin", "admin", "north", []string{"*"}},
+			wantFolders: []string{"/docs/empty/", "/docs/mine/", "/docs/shared/", "/docs/theirs/"},
+			wantFiles:   []string{"n"},
+		},
+		{
+			name:        "nothing visible",
+			as:          caller{"stranger", "calculator", "north", ownFiles},
+			wantFolders: []string{},
+			wantFiles:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo := testRouter(t, tt.as)
+			ctx := metadata.WithTenant(context.Background(), "north")
+			addFiles(t, ctx, repo,
+				&metadata.FileMetadata{ID: "mine", LogicalPath: "/docs/mine/b.pdf", UploadedBy: "north-app"},
+				&metadata.FileMetadata{ID: "theirs", LogicalPath: "/docs/theirs/c.pdf", UploadedBy: "billing"},
+				&metadata.FileMetadata{ID: "shared", LogicalPath: "/docs/shared/d.pdf", UploadedBy: "billing",
+					ACL: metadata.ACL{{Server: "north-app", Access: []string{metadata.AccessRead}}}},
+				&metadata.FileMetadata{ID: "trashed", LogicalPath: "/docs/trashed/e.pdf", UploadedBy: "north-app", DeletedAt: &deleted},
+			)
+			require.NoError(t, repo.CreateFolder(ctx, "/docs/empty/"))
+
+			rec := serve(routerAs(repo, tt.as), http.MethodGet, "/folders?path=/docs", "", nil)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var listing metadata.FolderListing
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+			assert.Equal(t, tt.wantFolders, listing.Folders)
+			ids := []string{}
+			for _, file := range listing.Files {
+				ids = append(ids, file.ID)
+			}
+			assert.Equal(t, tt.wantFiles, ids)
+		})
+	}
+}
+
+func TestFolderLifecycle(t *testing.T) {
+	e, repo := testRouter(t, caller{"north-app", "calculator", "north", ownFiles})
+	ctx := metadata.WithTenant(context.Background(), "north")
+	addFiles(t, ctx, repo,
+		&metadata.FileMetadata{ID: "b", LogicalPath: "/docs/reports/b.pdf", UploadedBy: "north-app"},
+		&metadata.FileMetadata{ID: "c", LogicalPath: "/docs/reports/2025/c.pdf", UploadedBy: "north-app"},
+	)
+
+	rec := serve(e, http.MethodPost, "/folders", `{"path": "/archive"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"path": "/archive/"}`, rec.Body.String())
+
+	rec = serve(e, http.MethodPost, "/folders/move", `{"from": "/docs/reports/", "to": "/archive/reports/"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"from": "/docs/reports/", "to": "/archive/reports/", "moved_files": 2}`, rec.Body.String())
+	moved, err := repo.GetFileMetadata(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "/archive/reports/2025/c.pdf", moved.LogicalPath)
+
+	rec = serve(e, http.MethodPost, "/folders/move", `{"from": "/archive/", "to": "/archive/inner/"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a folder cannot move into itself")
+
+	rec = serve(e, http.MethodDelete, "/folders?path=/archive/", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"path": "/archive/", "deleted_files": 2}`, rec.Body.String())
+	rec = serve(e, http.MethodGet, "/folders?path=/", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listing metadata.FolderListing
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	assert.Equal(t, []string{"/docs/"}, listing.Folders, "deleted folders are gone")
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"file-manager/metadata"
+
+	"github.com/google/uuid"
+)
+
+// OrphanObject is a stored object that no file metadata refers to.
+type OrphanObject struct {
+	Provider     string    `json:"provider"`
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Deleted      bool      `json:"deleted"`
+}
+
+// GCReport is the result of one garbage collection run.
+type GCReport struct {
+	DryRun         bool           `json:"dry_run"`
+	Scanned        int            `json:"scanned"`
+	Orphans        []OrphanObject `json:"orphans"`
+	Deleted        int            `json:"deleted"`
+	Failed         int            `json:"failed"`
+	BytesReclaimed int64          `json:"bytes_reclaimed"`
+}
+
+// CollectOrphans lists the buckets of every cloud and deletes the objects written by
+// uploads (keys under a "{uuid}/" prefix) that no file metadata refers to and that are
+// older than the grace period. With dryRun set it only reports them. Objects outside
+// "{uuid}/" prefixes are never touched.
+//
+// A context made with metadata.AllTenants covers every known bucket. A context of a
+// single tenant only covers the buckets no other tenant can be routed to, so a run never
+// reports or deletes objects of other tenants. Objects are referenced by the files of
+// every tenant, so it reads them all either way but only reports object keys.
+func (s *FileRepo) CollectOrphans(ctx context.Context, dryRun bool, now time.Time) (*GCReport, error) {
+	tenant, all, err := metadata.TenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &GCReport{DryRun: dryRun, Orphans: []OrphanObject{}}
+	ctx = metadata.AllTenants(ctx)
+
+	// Collect the referenced objects first: an object written after this point is
+	// younger than the grace period and therefore skipped below.
+	files, err := s.metadataStore.ListFileMetadata(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	buckets := make(map[string]map[string]bool) // provider -> bucket set
+	for provider := range s.storageManager.GetAllAdapters() {
+		buckets[provider] = make(map[string]bool)
+		known := s.storageManager.Buckets(provider)
+		if !all {
+			known = s.storageManager.ExclusiveBuckets(tenant, provider)
+		}
+		for _, bucket := range known {
+			buckets[provider][bucket] = true
+		}
+	}
+	for _, fileMeta := range files {
+		for _, info := range fileMeta.CloudCopies {
+			referenced[objectRef(info.CloudProvider, info.Bucket, info.Name)] = true
+			if all && buckets[info.CloudProvider] != nil {
+				buckets[info.CloudProvider][info.Bucket] = true
+			}
+		}
+	}
+
+	cutoff := now.Add(-s.appConfig.GC.GracePeriod)
+	for _, provider := range slices.Sorted(maps.Keys(buckets)) {
+		adapter, err := s.storageManager.GetAdapter(provider)
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range slices.Sorted(maps.Keys(buckets[provider])) {
+			objects, err := adapter.List(ctx, bucket, "")
+			if err != nil {
+				log.Printf("GC: failed to list %s bucket %s: %v", provider, bucket, err)
+				report.Failed++
+				continue
+			}
+
+			for _, obj := range objects {
+				report.Scanned++
+				if referenced[objectRef(provider, bucket, obj.Name)] || !isUploadKey(obj.Name) || obj.LastModified.After(cutoff) {
+					continue
+				}
+
+				orphan := OrphanObject{
+					Provider:     provider,
+					Bucket:       bucket,
+					Key:          obj.Name,
+					Size:         obj.Size,
+					LastModified: obj.LastModified,
+				}
+				if !dryRun {
+					if err := adapter.Delete(ctx, bucket, obj.Name); err != nil {
+						log.Printf("GC: failed to delete orphan %s/%s on %s: %v", bucket, obj.Name, provider, err)
+						report.Failed++
+					} else {
+						orphan.Deleted = true
+						report.Deleted++
+						report.BytesReclaimed += obj.Size
+					}
+				}
+				report.Orphans = append(report.Orphans, orphan)
+			}
+		}
+	}
+	return report, nil
+}
+
+// RunGarbageCollector collects orphaned objects every interval until ctx is done.
+func (s *FileRepo) RunGarbageCollector(ctx context.Context, interval time.Duration, dryRun bool) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.CollectOrphans(metadata.AllTenants(ctx), dryRun, time.Now())
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("GC failed: %v", err)
+			}
+			continue
+		}
+		log.Printf("GC (dry run: %t): scanned %d objects, found %d orphans, deleted %d (%d bytes), failed %d",
+			report.DryRun, report.Scanned, len(report.Orphans), report.Deleted, report.BytesReclaimed, report.Failed)
+	}
+}
+
+func objectRef(provider, bucket, key string) string {
+	return provider + "\x00" + bucket + "\x00" + key
+}
+
+// isUploadKey reports whether a key was written by UploadFile, which stores objects
+// under "{uuid}/{filename}".
+func isUploadKey(key string) bool {
+	id, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return false
+	}
+	return uuid.Validate(id) == nil
+}
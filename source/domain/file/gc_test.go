@@ -0,0 +1,61 @@
+package file
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+	"file-manager/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectOrphans(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.GC.GracePeriod = time.Hour
+	repo, clouds := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	kept := uploadFile(t, ctx, repo, "/archive/a.bin", "application/octet-stream", "archived")
+	orphanKey := uuid.NewString() + "/orphan.bin"
+	for _, key := range []string{orphanKey, "manual/notes.txt"} {
+		_, err := clouds["aws"].Upload(ctx, "files", key, strings.NewReader("patient record\n"), 15, nil, storage.UploadOptions{})
+		require.NoError(t, err)
+	}
+	sweep := metadata.AllTenants(context.Background())
+
+	// Objects younger than the grace period may belong to uploads in flight
+	report, err := repo.CollectOrphans(sweep, false, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, report.Orphans)
+
+	later := time.Now().Add(2 * time.Hour)
+	report, err = repo.CollectOrphans(sweep, true, later)
+	require.NoError(t, err)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, orphanKey, report.Orphans[0].Key)
+	assert.Equal(t, int64(15), report.Orphans[0].Size)
+	assert.False(t, report.Orphans[0].Deleted)
+	_, stored := clouds["aws"].Content("files", orphanKey)
+	assert.True(t, stored, "a dry run deletes nothing")
+
+	report, err = repo.CollectOrphans(sweep, false, later)
+	require.NoError(t, err)
+	require.Len(t, report.Orphans, 1)
+	assert.True(t, report.Orphans[0].Deleted)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Equal(t, int64(15), report.BytesReclaimed)
+	_, stored = clouds["aws"].Content("files", orphanKey)
+	assert.False(t, stored)
+
+	_, stored = clouds["aws"].Content("files", "manual/notes.txt")
+	assert.True(t, stored, "objects not written by uploads are left alone")
+	src := kept.CloudCopies["aws"]
+	content, stored := clouds["aws"].Content(src.Bucket, src.Name)
+	assert.True(t, stored)
+	assert.Equal(t, "archived", string(content))
+}
@@ -2,13 +2,19 @@ package file
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"file-manager/auth"
+	"file-manager/lifecycle"
+	"file-manager/metadata"
+	"file-manager/storage"
 	"file-manager/telemetry"
 	"file-manager/utils"
 
@@ -26,10 +32,10 @@ func NewFileHandler(fr *FileRepo) *FileHandler {
 
 // UploadFile handles file upload via POST request.
 func (h *FileHandler) UploadFile(c echo.Context) error {
-	// serverID, err := auth.GetServerIDFromContext(c)
-	// if err != nil {
-	// 	return echo.NewHTTPError(http.StatusUnauthorized, "Authentication required: Server ID not found in context")
-	// }
+	serverID, err := auth.GetServerIDFromContext(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Authentication required: Server ID not found in context")
+	}
 
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -43,7 +49,36 @@ func (h *FileHandler) UploadFile(c echo.Context) error {
 
 	targetCloud := c.FormValue("target_cloud") // Optional: specify a single cloud for upload
 
-	fileMeta, err := h.fileRepo.UploadFile(c.Request().Context(), file, logicalPath, targetCloud)
+	// Optional: override the configured encryption, storage class and HTTP headers
+	uploadOptions := storage.UploadOptions{
+		Encryption:         c.FormValue("encryption"),
+		KMSKeyID:           c.FormValue("kms_key_id"),
+		StorageClass:       c.FormValue("storage_class"),
+		CacheControl:       c.FormValue("cache_control"),
+		ContentDisposition: c.FormValue("content_disposition"),
+	}
+	switch uploadOptions.Encryption {
+	case "", storage.EncryptionManaged, storage.EncryptionKMS:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid encryption %q: must be %q or %q", uploadOptions.Encryption, storage.EncryptionManaged, storage.EncryptionKMS))
+	}
+
+	fileMeta, err := h.fileRepo.UploadFile(c.Request().Context(), UploadRequest{
+		File:        file,
+		LogicalPath: logicalPath,
+		TargetCloud: targetCloud,
+		UploadedBy:  serverID,
+		Options:     uploadOptions,
+	})
+	if errors.Is(err, ErrFileTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		return echo.NewHTTPError(http.StatusInsufficientStorage, err.Error())
+	}
+	if errors.Is(err, ErrInvalidUpload) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		log.Printf("Error uploading file: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to upload file: %v", err))
@@ -54,28 +89,879 @@ func (h *FileHandler) UploadFile(c echo.Context) error {
 
 // GetFileMetadata handles retrieving file metadata via GET request.
 func (h *FileHandler) GetFileMetadata(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", revisionETag(fileMeta))
+	return c.JSON(http.StatusOK, fileMeta)
+}
+
+// UpdateFileMetadata applies a JSON Merge Patch of logical_path, file_name, content_type
+// and custom_tags. Sending the ETag of a previous read in If-Match makes the update
+// conditional: it fails with 412 if the file has changed since.
+func (h *FileHandler) UpdateFileMetadata(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+
+	ifRevision, err := parseIfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	patch, err := metadata.ParseMergePatch(body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	updated, err := h.fileRepo.UpdateFile(c.Request().Context(), fileMeta.ID, patch, ifRevision)
+	switch {
+	case errors.Is(err, metadata.ErrInvalidPatch):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, metadata.ErrRevisionMismatch):
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, metadata.ErrPathExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, ErrLegalHold), errors.Is(err, lifecycle.ErrRetentionActive):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case err != nil:
+		log.Printf("Error updating metadata of file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update file metadata")
+	}
+
+	c.Response().Header().Set("ETag", revisionETag(updated))
+	return c.JSON(http.StatusOK, updated)
+}
+
+// FileHistory returns the metadata change history of a file, oldest first. Files in the
+// trash keep their history readable; that of purged files is only visible to servers
+// that may read every file.
+func (h *FileHandler) FileHistory(c echo.Context) error {
+	_, err := h.loadFileForServer(c, auth.PermFilesRead)
+	purged := false
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound || auth.Authorize(c, auth.PermFilesRead, "") != nil {
+			return err
+		}
+		purged = true
+	}
+
+	changes, err := h.fileRepo.FileHistory(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error reading history of file %s: %v", c.Param("id"), err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read file history")
+	}
+	if purged && len(changes) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "File metadata not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"file_id": c.Param("id"), "changes": changes})
+}
+
+// revisionETag returns the strong ETag of a metadata revision, e.g. "3".
+func revisionETag(fileMeta *metadata.FileMetadata) string {
+	return strconv.Quote(strconv.FormatInt(fileMeta.Revision, 10))
+}
+
+// parseIfMatch returns the revision required by an If-Match header, or 0 when the header
+// is absent or "*".
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	revision, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("If-Match must be a single ETag returned by this API, got %s", header)
+	}
+	return revision, nil
+}
+
+// DownloadFile streams a file's content. Compressed files are sent compressed when the
+// client's Accept-Encoding allows it, and decompressed on the fly otherwise.
+func (h *FileHandler) DownloadFile(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+
+	return h.streamFile(c, fileMeta)
+}
+
+// streamFile sends a file's content as an attachment, compressed when the client accepts
+// the file's encoding.
+func (h *FileHandler) streamFile(c echo.Context, fileMeta *metadata.FileMetadata) error {
+	download, err := h.fileRepo.DownloadFile(c.Request().Context(), fileMeta, c.Request().Header.Get(echo.HeaderAcceptEncoding))
+	if err != nil {
+		log.Printf("Error downloading file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to download file from storage")
+	}
+	defer download.Body.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", download.FileName))
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	if download.ContentEncoding != "" {
+		header.Set(echo.HeaderContentEncoding, download.ContentEncoding)
+	}
+	if download.Size >= 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(download.Size, 10))
+	}
+
+	return c.Stream(http.StatusOK, download.ContentType, download.Body)
+}
+
+// PresignDownload returns a time-limited URL for downloading a file directly from cloud storage.
+// The optional expires_in query parameter sets the lifetime in seconds (default 15 minutes, max 7 days).
+func (h *FileHandler) PresignDownload(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+
+	expiry := 15 * time.Minute
+	if expiresIn := c.QueryParam("expires_in"); expiresIn != "" {
+		seconds, err := strconv.Atoi(expiresIn)
+		if err != nil || seconds <= 0 || seconds > 7*24*60*60 {
+			return echo.NewHTTPError(http.StatusBadRequest, "expires_in must be between 1 and 604800 seconds")
+		}
+		expiry = time.Duration(seconds) * time.Second
+	}
+
+	url, err := h.fileRepo.PresignDownload(c.Request().Context(), fileMeta, expiry)
+	if err != nil {
+		log.Printf("Error presigning file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Failed to create download URL: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"url":              url,
+		"expires_at":       time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		"content_encoding": fileMeta.ContentEncoding,
+	})
+}
+
+// copyFileRequest is the JSON body of the copy and move endpoints.
+type copyFileRequest struct {
+	CopyRequest
+	Encryption   string `json:"encryption"`
+	KMSKeyID     string `json:"kms_key_id"`
+	StorageClass string `json:"storage_class"`
+}
+
+// CopyFile copies a file's stored bytes to another bucket or cloud.
+func (h *FileHandler) CopyFile(c echo.Context) error {
+	return h.transferFile(c, false)
+}
+
+// MoveFile moves a file's stored bytes to another bucket or cloud.
+func (h *FileHandler) MoveFile(c echo.Context) error {
+	return h.transferFile(c, true)
+}
+
+func (h *FileHandler) transferFile(c echo.Context, move bool) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+
+	var body copyFileRequest
+	if err := c.Bind(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	req := body.CopyRequest
+	req.Options = storage.UploadOptions{
+		Encryption:   body.Encryption,
+		KMSKeyID:     body.KMSKeyID,
+		StorageClass: body.StorageClass,
+	}
+
+	var updated *metadata.FileMetadata
+	if move {
+		updated, err = h.fileRepo.MoveFile(c.Request().Context(), fileMeta.ID, req)
+	} else {
+		updated, err = h.fileRepo.CopyFile(c.Request().Context(), fileMeta.ID, req)
+	}
+	if errors.Is(err, ErrInvalidTransfer) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, ErrCopyExists) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, ErrLegalHold) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error transferring file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Failed to transfer file: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteFile moves a file to the trash.
+func (h *FileHandler) DeleteFile(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesDelete)
+	if err != nil {
+		return err
+	}
+
+	serverID, _ := auth.GetServerIDFromContext(c)
+	err = h.fileRepo.DeleteFile(c.Request().Context(), fileMeta, serverID)
+	if errors.Is(err, lifecycle.ErrRetentionActive) || errors.Is(err, ErrLegalHold) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error deleting file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete file")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type legalHoldRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SetLegalHold places a legal hold on a file, including files in the trash, which the hold
+// keeps from being purged.
+func (h *FileHandler) SetLegalHold(c echo.Context) error {
+	fileMeta, err := h.loadFileForServer(c, auth.PermFilesHold)
+	if err != nil {
+		return err
+	}
+
+	var req legalHoldRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "A reason is required for a legal hold")
+	}
+	serverID, _ := auth.GetServerIDFromContext(c)
+
+	updated, err := h.fileRepo.SetLegalHold(c.Request().Context(), fileMeta.ID, req.Reason, serverID)
+	if err != nil {
+		log.Printf("Error placing legal hold on file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to place legal hold")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// ReleaseLegalHold lifts the legal hold of a file, including files in the trash.
+func (h *FileHandler) ReleaseLegalHold(c echo.Context) error {
+	fileMeta, err := h.loadFileForServer(c, auth.PermFilesHold)
+	if err != nil {
+		return err
+	}
+
+	updated, err := h.fileRepo.ReleaseLegalHold(c.Request().Context(), fileMeta.ID)
+	if err != nil {
+		log.Printf("Error releasing legal hold of file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Failed to release legal hold: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+type aclRequest struct {
+	ACL metadata.ACL `json:"acl"`
+}
+
+// GetFileACL returns a file's own ACL and the entries it inherits from its folders.
+func (h *FileHandler) GetFileACL(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+
+	inherited, err := h.fileRepo.InheritedACL(c.Request().Context(), fileMeta)
+	if err != nil {
+		log.Printf("Error reading the ACL of file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read ACL")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"file_id": fileMeta.ID, "acl": nonNilACL(fileMeta.ACL), "inherited": nonNilACL(inherited)})
+}
+
+// SetFileACL replaces a file's own ACL. Only servers holding files:write for the file's
+// owner can share it; access granted by an ACL does not extend to changing it.
+func (h *FileHandler) SetFileACL(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+	if err := auth.Authorize(c, auth.PermFilesWrite, fileMeta.UploadedBy); err != nil {
+		return err
+	}
+
+	var req aclRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	updated, err := h.fileRepo.SetFileACL(c.Request().Context(), fileMeta.ID, req.ACL)
+	if errors.Is(err, metadata.ErrInvalidPatch) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, ErrLegalHold) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error setting the ACL of file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to set ACL")
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// GetFolderACL returns the own ACL of the folder given by path and the entries it
+// inherits from the folders above it.
+func (h *FileHandler) GetFolderACL(c echo.Context) error {
+	folder, err := metadata.NormalizeFolder(c.QueryParam("path"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	own, inherited, err := h.fileRepo.GetFolderACL(c.Request().Context(), folder)
+	if err != nil {
+		return folderError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"path": folder, "acl": nonNilACL(own), "inherited": nonNilACL(inherited)})
+}
+
+// SetFolderACL replaces the own ACL of the folder given by path. It applies to every
+// file under the folder, so without files:write:any every such file must be the caller's,
+// the entries only cover the caller's files and only the caller's earlier entries are
+// replaced. The response holds the folder's whole new ACL.
+func (h *FileHandler) SetFolderACL(c echo.Context) error {
+	owner, err := listingOwner(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+	folder, err := metadata.NormalizeFolder(c.QueryParam("path"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var req aclRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	acl, err := h.fileRepo.SetFolderACL(c.Request().Context(), folder, req.ACL, owner)
+	if err != nil {
+		return folderError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"path": folder, "acl": nonNilACL(acl)})
+}
+
+// nonNilACL returns acl, or an empty ACL so that JSON shows [] rather than null.
+func nonNilACL(acl metadata.ACL) metadata.ACL {
+	if acl == nil {
+		return metadata.ACL{}
+	}
+	return acl
+}
+
+type createShareRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ExpiresIn    int        `json:"expires_in"` // Seconds; ignored when expires_at is set
+	MaxDownloads int        `json:"max_downloads"`
+	Passcode     string     `json:"passcode"`
+}
+
+// CreateShare creates a share link that lets anyone holding it download the file without
+// credentials. The response holds the link's token and URL, which cannot be retrieved
+// again. Access granted by an ACL does not extend to sharing a file.
+func (h *FileHandler) CreateShare(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesShare)
+	if err != nil {
+		return err
+	}
+	serverID, _ := auth.GetServerIDFromContext(c)
+
+	var req createShareRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	shareReq := ShareRequest{MaxDownloads: req.MaxDownloads, Passcode: req.Passcode, CreatedBy: serverID}
+	switch {
+	case req.ExpiresAt != nil:
+		shareReq.ExpiresAt = *req.ExpiresAt
+	case req.ExpiresIn < 0:
+		return echo.NewHTTPError(http.StatusBadRequest, "expires_in must be positive")
+	case req.ExpiresIn > 0:
+		shareReq.ExpiresAt = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+
+	link, token, err := h.fileRepo.CreateShare(c.Request().Context(), fileMeta, shareReq)
+	if err != nil {
+		return shareError(err)
+	}
+	base := h.fileRepo.appConfig.Shares.BaseURL
+	if base == "" {
+		base = c.Scheme() + "://" + c.Request().Host
+	}
+	return c.JSON(http.StatusCreated, struct {
+		*ShareLink
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}{link, token, base + "/s/" + token})
+}
+
+// ListShares returns the share links of a file, including revoked and expired ones.
+func (h *FileHandler) ListShares(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesShare)
+	if err != nil {
+		return err
+	}
+
+	links, err := h.fileRepo.ListShares(c.Request().Context(), fileMeta.ID)
+	if err != nil {
+		return shareError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"file_id": fileMeta.ID, "shares": links})
+}
+
+// GetShare returns a share link of a file with its access log.
+func (h *FileHandler) GetShare(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesShare)
+	if err != nil {
+		return err
+	}
+
+	link, accesses, err := h.fileRepo.GetShare(c.Request().Context(), fileMeta.ID, c.Param("share_id"))
+	if err != nil {
+		return shareError(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		*ShareLink
+		Accesses []ShareAccess `json:"accesses"`
+	}{link, accesses})
+}
+
+// RevokeShare stops a share link of a file from working.
+func (h *FileHandler) RevokeShare(c echo.Context) error {
+	fileMeta, err := h.loadAuthorizedFile(c, auth.PermFilesShare)
+	if err != nil {
+		return err
+	}
+
+	link, err := h.fileRepo.RevokeShare(c.Request().Context(), fileMeta.ID, c.Param("share_id"))
+	if err != nil {
+		return shareError(err)
+	}
+	return c.JSON(http.StatusOK, link)
+}
+
+// sharePasscodeForm is shown to browsers opening a share link that needs a passcode.
+const sharePasscodeForm = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Shared file</title></head>
+<body><form method="post"><p>%s</p>
+<input type="password" name="passcode" autofocus> <button type="submit">Download</button>
+</form></body></html>
+`
+
+// DownloadShare streams the file of the share link given by the :token path parameter.
+// It is served without authentication. The passcode of a protected link is read from the
+// X-Share-Passcode header or the passcode form field; browsers are shown a form for it.
+func (h *FileHandler) DownloadShare(c echo.Context) error {
+	passcode := c.Request().Header.Get("X-Share-Passcode")
+	if passcode == "" {
+		passcode = c.FormValue("passcode")
+	}
+	access := ShareAccess{IP: c.RealIP(), UserAgent: c.Request().UserAgent()}
+
+	fileMeta, err := h.fileRepo.RedeemShare(c.Request().Context(), c.Param("token"), passcode, access)
+	if err != nil {
+		browser := strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+		switch {
+		case browser && errors.Is(err, ErrPasscodeRequired):
+			return c.HTML(http.StatusUnauthorized, fmt.Sprintf(sharePasscodeForm, "This file is protected by a passcode."))
+		case browser && errors.Is(err, ErrWrongPasscode):
+			return c.HTML(http.StatusForbidden, fmt.Sprintf(sharePasscodeForm, "Wrong passcode, please try again."))
+		}
+		return shareError(err)
+	}
+	return h.streamFile(c, fileMeta)
+}
+
+// shareError maps share link errors to HTTP errors.
+func shareError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidShare):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrShareNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrShareUnavailable):
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	case errors.Is(err, ErrPasscodeRequired):
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, ErrWrongPasscode):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	default:
+		log.Printf("Error in share link operation: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Share link operation failed")
+	}
+}
+
+// ListFiles searches the calling server's files, see parseFileQuery for the filters.
+// Servers that may read every file see all files, or those of the server given by
+// server_id.
+func (h *FileHandler) ListFiles(c echo.Context) error {
+	return h.queryFiles(c, metadata.TrashExclude, "uploaded_at")
+}
+
+// ListTrash searches the calling server's deleted files, most recently deleted first by
+// default. Servers that may read every file see the whole trash, or that of the server
+// given by server_id.
+func (h *FileHandler) ListTrash(c echo.Context) error {
+	return h.queryFiles(c, metadata.TrashOnly, "-deleted_at")
+}
+
+func (h *FileHandler) queryFiles(c echo.Context, trash metadata.TrashFilter, defaultSort string) error {
+	uploadedBy, err := listingOwner(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+	q, err := parseFileQuery(c, defaultSort)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	q.UploadedBy = uploadedBy
+	q.SharedWith = sharedWith(c, uploadedBy)
+	q.Trash = trash
+
+	page, err := h.fileRepo.QueryFiles(c.Request().Context(), q)
+	if errors.Is(err, metadata.ErrInvalidQuery) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error querying files: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list files")
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// parseFileQuery reads metadata filters from the query string: prefix, content_type
+// ("image/*" allowed), name (substring), tag (repeatable "key:value"), min_size, max_size,
+// uploaded_after and uploaded_before (RFC 3339), sort (field, "-" prefix for descending),
+// limit and cursor.
+func parseFileQuery(c echo.Context, defaultSort string) (metadata.Query, error) {
+	q := metadata.Query{
+		PathPrefix:   c.QueryParam("prefix"),
+		ContentType:  c.QueryParam("content_type"),
+		NameContains: c.QueryParam("name"),
+		Cursor:       c.QueryParam("cursor"),
+	}
+
+	for _, tag := range c.QueryParams()["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			return q, fmt.Errorf("invalid tag filter %q: expected key:value", tag)
+		}
+		if q.Tags == nil {
+			q.Tags = make(map[string]string)
+		}
+		q.Tags[key] = value
+	}
+
+	for param, dst := range map[string]*int64{"min_size": &q.MinSize, "max_size": &q.MaxSize} {
+		if value := c.QueryParam(param); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s %q", param, value)
+			}
+			*dst = n
+		}
+	}
+	for param, dst := range map[string]*time.Time{"uploaded_after": &q.UploadedAfter, "uploaded_before": &q.UploadedBefore} {
+		if value := c.QueryParam(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s %q: expected RFC 3339", param, value)
+			}
+			*dst = t
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("invalid limit %q", value)
+		}
+		q.Limit = n
+	}
+
+	sort := c.QueryParam("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	q.SortBy, q.Descending = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	return q, nil
+}
+
+// RestoreFile moves a file out of the trash.
+func (h *FileHandler) RestoreFile(c echo.Context) error {
+	fileMeta, err := h.loadFileForServer(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+
+	restored, err := h.fileRepo.RestoreFile(c.Request().Context(), fileMeta.ID)
+	if errors.Is(err, ErrNotInTrash) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error restoring file %s: %v", fileMeta.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to restore file")
+	}
+	return c.JSON(http.StatusOK, restored)
+}
+
+type folderRequest struct {
+	Path string `json:"path"`
+}
+
+type moveFolderRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ListFolder lists the immediate subfolders and files of the folder given by path.
+func (h *FileHandler) ListFolder(c echo.Context) error {
+	owner, err := listingOwner(c, auth.PermFilesRead)
+	if err != nil {
+		return err
+	}
+	folder, err := metadata.NormalizeFolder(c.QueryParam("path"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	listing, err := h.fileRepo.ListFolder(c.Request().Context(), folder, owner, sharedWith(c, owner))
+	if err != nil {
+		log.Printf("Error listing folder %s: %v", folder, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list folder")
+	}
+	return c.JSON(http.StatusOK, listing)
+}
+
+// CreateFolder creates an empty folder.
+func (h *FileHandler) CreateFolder(c echo.Context) error {
+	var req folderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	folder, err := metadata.NormalizeFolder(req.Path)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.fileRepo.CreateFolder(c.Request().Context(), folder); err != nil {
+		return folderError(err)
+	}
+	return c.JSON(http.StatusCreated, folderRequest{Path: folder})
+}
+
+// MoveFolder renames a folder with everything under it.
+func (h *FileHandler) MoveFolder(c echo.Context) error {
+	owner, err := listingOwner(c, auth.PermFilesWrite)
+	if err != nil {
+		return err
+	}
+	var req moveFolderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	from, err := metadata.NormalizeFolder(req.From)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	to, err := metadata.NormalizeFolder(req.To)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	moved, err := h.fileRepo.MoveFolder(c.Request().Context(), from, to, owner, sharedWith(c, owner))
+	if err != nil {
+		return folderError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"from": from, "to": to, "moved_files": moved})
+}
+
+// DeleteFolder moves every file under the folder given by path to the trash.
+func (h *FileHandler) DeleteFolder(c echo.Context) error {
+	owner, err := listingOwner(c, auth.PermFilesDelete)
+	if err != nil {
+		return err
+	}
+	folder, err := metadata.NormalizeFolder(c.QueryParam("path"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	serverID, _ := auth.GetServerIDFromContext(c)
+
+	deleted, err := h.fileRepo.DeleteFolder(c.Request().Context(), folder, owner, sharedWith(c, owner), serverID)
+	if err != nil {
+		return folderError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"path": folder, "deleted_files": deleted})
+}
+
+// folderError maps folder operation errors to HTTP errors.
+func folderError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidFolder), errors.Is(err, metadata.ErrInvalidACL):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrFolderNotOwned), errors.Is(err, ErrLegalHold), errors.Is(err, lifecycle.ErrRetentionActive):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, metadata.ErrFolderExists), errors.Is(err, metadata.ErrPathExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		log.Printf("Error in folder operation: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Folder operation failed: %v", err))
+	}
+}
+
+// listingOwner returns the server whose files an operation on many files covers: the one
+// given by the server_id query parameter, or without it the caller itself, unless the
+// caller holds permission for every server's files ("" for all servers).
+func listingOwner(c echo.Context, permission string) (string, error) {
+	serverID, err := auth.GetServerIDFromContext(c)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "Authentication required: Server ID not found in context")
+	}
+	owner := c.QueryParam("server_id")
+	if owner == "" && auth.Authorize(c, permission, "") != nil {
+		owner = serverID
+	}
+	if err := auth.Authorize(c, permission, owner); err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
+// sharedWith returns the caller as an ACL principal when an operation is limited to its
+// own files, so that files shared with it are included too.
+func sharedWith(c echo.Context, owner string) *metadata.Principal {
+	serverID, _ := auth.GetServerIDFromContext(c)
+	if owner == "" || owner != serverID {
+		return nil
+	}
+	role, _ := c.Get("serverRole").(string)
+	return &metadata.Principal{ServerID: serverID, Role: role}
+}
+
+// GetUsage returns the storage used by the calling server and its tenant along with their
+// quotas. Servers that may read every file can query another server of their tenant with
+// server_id. The usage of other tenants is never visible.
+func (h *FileHandler) GetUsage(c echo.Context) error {
 	serverID, err := auth.GetServerIDFromContext(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, "Authentication required: Server ID not found in context")
 	}
+	tenant, _ := auth.GetTenantFromContext(c)
+	if id := c.QueryParam("server_id"); id != "" && id != serverID {
+		if err := auth.Authorize(c, auth.PermFilesRead, id); err != nil {
+			return err
+		}
+		serverID = id
+	}
+	if t := c.QueryParam("tenant"); t != "" && t != tenant {
+		return echo.NewHTTPError(http.StatusForbidden, "The usage of other tenants is not visible")
+	}
+
+	report, err := h.fileRepo.GetUsage(c.Request().Context(), serverID, tenant)
+	if err != nil {
+		log.Printf("Error getting usage of server %s: %v", serverID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get usage")
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// CollectOrphans runs the orphan object garbage collector. It only reports orphans unless
+// dry_run=false is given. Runs cover the buckets of the caller's tenant, and every bucket
+// for platform admins.
+func (h *FileHandler) CollectOrphans(c echo.Context) error {
+	dryRun := c.QueryParam("dry_run") != "false"
 
+	ctx := c.Request().Context()
+	if auth.Authorize(c, auth.PermPlatformAdmin, "") == nil {
+		ctx = metadata.AllTenants(ctx)
+	}
+	report, err := h.fileRepo.CollectOrphans(ctx, dryRun, time.Now())
+	if err != nil {
+		log.Printf("Error collecting orphans: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to collect orphans: %v", err))
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// loadAuthorizedFile loads the file named by the :id path parameter and checks that the
+// calling server holds permission on it. Files in the trash are reported as not found.
+func (h *FileHandler) loadAuthorizedFile(c echo.Context, permission string) (*metadata.FileMetadata, error) {
+	fileMeta, err := h.loadFileForServer(c, permission)
+	if err != nil {
+		return nil, err
+	}
+	if fileMeta.InTrash() {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "File metadata not found")
+	}
+	return fileMeta, nil
+}
+
+// loadFileForServer is loadAuthorizedFile without hiding files in the trash.
+func (h *FileHandler) loadFileForServer(c echo.Context, permission string) (*metadata.FileMetadata, error) {
 	fileID := c.Param("id")
 	if fileID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "File ID is required")
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "File ID is required")
 	}
 
 	fileMeta, err := h.fileRepo.GetFileMetadata(c.Request().Context(), fileID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "File metadata not found")
+		return nil, echo.NewHTTPError(http.StatusNotFound, "File metadata not found")
 	}
 
-	// Authorization check
-	serverRole, ok := c.Get("serverRole").(string)
-	if !ok || (serverRole != "admin" && serverID != fileMeta.UploadedBy) {
-		return echo.NewHTTPError(http.StatusForbidden, "Access denied. You are not authorized to view this file's metadata.")
+	if err := h.authorizeFile(c, fileMeta, permission); err != nil {
+		return nil, err
 	}
+	return fileMeta, nil
+}
 
-	return c.JSON(http.StatusOK, fileMeta)
+// aclAccess maps the files permissions to the ACL access granting them.
+var aclAccess = map[string]string{
+	auth.PermFilesRead:   metadata.AccessRead,
+	auth.PermFilesWrite:  metadata.AccessWrite,
+	auth.PermFilesDelete: metadata.AccessDelete,
+}
+
+// authorizeFile checks that the caller holds permission on a file: through its role for
+// the file's owner, or through the file's ACL. ACL entries make a file count as the
+// caller's own, so the role still needs the permission for its own files.
+func (h *FileHandler) authorizeFile(c echo.Context, fileMeta *metadata.FileMetadata, permission string) error {
+	err := auth.Authorize(c, permission, fileMeta.UploadedBy)
+	if err == nil {
+		return nil
+	}
+	access, ok := aclAccess[permission]
+	if !ok {
+		return err
+	}
+	serverID, _ := auth.GetServerIDFromContext(c)
+	shared, aclErr := h.fileRepo.sharedWith(c.Request().Context(), fileMeta, sharedWith(c, serverID), access)
+	if aclErr != nil {
+		log.Printf("Error reading the ACL of file %s: %v", fileMeta.ID, aclErr)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check file access")
+	}
+	if !shared {
+		return err
+	}
+	return auth.Authorize(c, permission, serverID)
 }
 
 // Handler to render HTML template from uploaded file and data and then upload to the s3 bucket
@@ -0,0 +1,344 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"file-manager/auth"
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ownFiles are the permissions of the built-in non-admin roles on files.
+var ownFiles = []string{"files:read:own", "files:write:own", "files:delete:own", "files:share:own"}
+
+// caller identifies the authenticated server of a test request, as ServerAuthMiddleware
+// would.
+type caller struct {
+	id, role, tenant string
+	permissions      []string
+}
+
+// testRouter serves the file routes as caller, on a repo holding north's file "n" of
+// north-app and south's file "s" of south-app, both at /docs/a.pdf.
+func testRouter(t *testing.T, as caller) (*echo.Echo, *FileRepo) {
+	t.Helper()
+	repo := newTestRepo(t, &config.AppConfig{})
+	addFiles(t, metadata.WithTenant(context.Background(), "north"), repo,
+		&metadata.FileMetadata{ID: "n", LogicalPath: "/docs/a.pdf", FileName: "a.pdf", ContentType: "application/pdf", UploadedBy: "north-app"})
+	addFiles(t, metadata.WithTenant(context.Background(), "south"), repo,
+		&metadata.FileMetadata{ID: "s", LogicalPath: "/docs/a.pdf", FileName: "a.pdf", UploadedBy: "south-app"})
+	return routerAs(repo, as), repo
+}
+
+// routerAs serves the file and folder routes of repo as caller.
+func routerAs(repo *FileRepo, as caller) *echo.Echo {
+	h := NewFileHandler(repo)
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("serverID", as.id)
+			c.Set("serverRole", as.role)
+			c.Set("serverTenant", as.tenant)
+			c.Set("permissions", as.permissions)
+			ctx := metadata.WithActor(metadata.WithTenant(c.Request().Context(), as.tenant), as.id)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+	read, write := auth.RequirePermission(auth.PermFilesRead), auth.RequirePermission(auth.PermFilesWrite)
+
+	g := e.Group("/files")
+	g.POST("", h.UploadFile, write)
+	g.GET("", h.ListFiles, read)
+	g.GET("/trash", h.ListTrash, read)
+	g.GET("/usage", h.GetUsage, read)
+	g.GET("/:id", h.GetFileMetadata, read)
+	g.PATCH("/:id", h.UpdateFileMetadata, write)
+	g.GET("/:id/history", h.FileHistory, read)
+	g.DELETE("/:id", h.DeleteFile, auth.RequirePermission(auth.PermFilesDelete))
+	g.GET("/:id/download", h.DownloadFile, read)
+	g.POST("/:id/restore", h.RestoreFile, write)
+	share := auth.RequirePermission(auth.PermFilesShare)
+	g.POST("/:id/shares", h.CreateShare, share)
+	g.GET("/:id/shares", h.ListShares, share)
+	g.GET("/:id/shares/:share_id", h.GetShare, share)
+	g.DELETE("/:id/shares/:share_id", h.RevokeShare, share)
+	g.GET("/:id/acl", h.GetFileACL, read)
+	g.PUT("/:id/acl", h.SetFileACL, write)
+	g.PUT("/:id/legal-hold", h.SetLegalHold, auth.RequirePermission(auth.PermFilesHold))
+	g.DELETE("/:id/legal-hold", h.ReleaseLegalHold, auth.RequirePermission(auth.PermFilesHold))
+
+	e.GET("/s/:token", h.DownloadShare)
+	e.POST("/s/:token", h.DownloadShare)
+
+	folders := e.Group("/folders")
+	folders.GET("", h.ListFolder, read)
+	folders.POST("", h.CreateFolder, write)
+	folders.POST("/move", h.MoveFolder, write)
+	folders.DELETE("", h.DeleteFolder, auth.RequirePermission(auth.PermFilesDelete))
+	folders.GET("/acl", h.GetFolderACL, read)
+	folders.PUT("/acl", h.SetFolderACL, write)
+	return e
+}
+
+func serve(e *echo.Echo, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUpdateFileMetadataMergePatch(t *testing.T) {
+	northApp := caller{"north-app", "calculator", "north", ownFiles}
+	tests := []struct {
+		name       string
+		body       string
+		ifMatch    string
+		wantStatus int
+		wantETag   string
+		check      func(t *testing.T, meta *metadata.FileMetadata)
+	}{
+		{
+			name: "rename and tag", body: `{"file_name": "b.pdf", "custom_tags": {"dept": "x"}}`,
+			wantStatus: http.StatusOK, wantETag: `"2"`,
+			check: func(t *testing.T, meta *metadata.FileMetadata) {
+				assert.Equal(t, "b.pdf", meta.FileName)
+				assert.Equal(t, map[string]string{"dept": "x"}, meta.CustomTags)
+				assert.Equal(t, "application/pdf", meta.ContentType, "omitted fields are kept")
+			},
+		},
+		{
+			name: "move", body: `{"logical_path": "/docs/final/b.pdf"}`, ifMatch: `"1"`,
+			wantStatus: http.StatusOK, wantETag: `"2"`,
+			check: func(t *testing.T, meta *metadata.FileMetadata) {
+				assert.Equal(t, "/docs/final/b.pdf", meta.LogicalPath)
+				assert.Equal(t, int64(2), meta.Revision)
+			},
+		},
+		{name: "current revision", body: `{"file_name": "b.pdf"}`, ifMatch: `"1"`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "weak ETag", body: `{"file_name": "b.pdf"}`, ifMatch: `W/"1"`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "any revision", body: `{"file_name": "b.pdf"}`, ifMatch: `*`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "stale revision", body: `{"file_name": "b.pdf"}`, ifMatch: `"5"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "malformed If-Match", body: `{"file_name": "b.pdf"}`, ifMatch: `"abc"`, wantStatus: http.StatusBadRequest},
+		{name: "read-only field", body: `{"size": 1}`, wantStatus: http.StatusBadRequest},
+		{name: "removing a required field", body: `{"content_type": null}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid value", body: `{"logical_path": "docs/b.pdf"}`, wantStatus: http.StatusBadRequest},
+		{name: "not JSON", body: `file_name=b.pdf`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, repo := testRouter(t, northApp)
+			header := http.Header{}
+			if tt.ifMatch != "" {
+				header.Set("If-Match", tt.ifMatch)
+			}
+			rec := serve(e, http.MethodPatch, "/files/n", tt.body, header)
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+
+			stored, err := repo.GetFileMetadata(metadata.WithTenant(context.Background(), "north"), "n")
+			require.NoError(t, err)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, int64(1), stored.Revision, "refused patches change nothing")
+				return
+			}
+			assert.Equal(t, tt.wantETag, rec.Header().Get("ETag"))
+			if tt.check != nil {
+				var meta metadata.FileMetadata
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &meta))
+				tt.check(t, &meta)
+			}
+		})
+	}
+
+	t.Run("lost update", func(t *testing.T) {
+		e, _ := testRouter(t, northApp)
+		rec := serve(e, http.MethodGet, "/files/n", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		etag := rec.Header().Get("ETag")
+
+		first := serve(e, http.MethodPatch, "/files/n", `{"file_name": "first.pdf"}`, http.Header{"If-Match": {etag}})
+		require.Equal(t, http.StatusOK, first.Code)
+		second := serve(e, http.MethodPatch, "/files/n", `{"file_name": "second.pdf"}`, http.Header{"If-Match": {etag}})
+		assert.Equal(t, http.StatusPreconditionFailed, second.Code)
+	})
+}
+
+func TestUploadFile(t *testing.T) {
+	repo, clouds := newStorageRepo(t, &config.AppConfig{})
+	e := routerAs(repo, caller{"app", "calculator", "north", ownFiles})
+	content := make([]byte, 65536)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "random.bin")
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, form.WriteField("logical_path", "/it/random.bin"))
+	require.NoError(t, form.WriteField("cache_control", "no-cache"))
+	require.NoError(t, form.Close())
+	req := httptest.NewRequest(http.MethodPost, "/files", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var uploaded metadata.FileMetadata
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &uploaded))
+	assert.Equal(t, "/it/random.bin", uploaded.LogicalPath)
+	assert.Equal(t, "app", uploaded.UploadedBy)
+	src := uploaded.CloudCopies["aws"]
+	require.NotNil(t, src)
+	assert.Equal(t, "no-cache", src.CacheControl)
+	stored, ok := clouds["aws"].Content(src.Bucket, src.Name)
+	require.True(t, ok)
+	assert.Equal(t, content, stored)
+
+	rec = serve(e, http.MethodGet, "/files/"+uploaded.ID, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(e, http.MethodGet, "/files/"+uploaded.ID+"/download", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, content, rec.Body.Bytes())
+}
+
+func TestDownloadCompressed(t *testing.T) {
+	repo, clouds := newStorageRepo(t, &config.AppConfig{Compression: config.CompressionConfig{
+		Enabled: true, Algorithm: "gzip", ContentTypes: []string{"application/json"}, MinSize: 1024,
+	}})
+	ctx := metadata.WithTenant(context.Background(), "north")
+	content := strings.Repeat(`{"invoice":"INV-001","amount":125.5},`, 100)
+	meta := uploadFile(t, ctx, repo, "/docs/data.json", "application/json", content)
+	require.Equal(t, "gzip", meta.ContentEncoding)
+	src := meta.CloudCopies["aws"]
+	stored, ok := clouds["aws"].Content(src.Bucket, src.Name)
+	require.True(t, ok)
+	assert.Less(t, len(stored), len(content))
+
+	e := routerAs(repo, caller{"app", "calculator", "north", ownFiles})
+	rec := serve(e, http.MethodGet, "/files/"+meta.ID+"/download", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, content, rec.Body.String())
+
+	rec = serve(e, http.MethodGet, "/files/"+meta.ID+"/download", "", http.Header{echo.HeaderAcceptEncoding: {"gzip, deflate"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, stored, rec.Body.Bytes())
+}
+
+func TestListFilesQuery(t *testing.T) {
+	repo, _ := newStorageRepo(t, &config.AppConfig{})
+	ctx := metadata.WithTenant(context.Background(), "north")
+	for _, size := range []int{10, 20, 30} {
+		path := fmt.Sprintf("/search/report-%d.bin", size)
+		uploadFile(t, ctx, repo, path, "application/octet-stream", strings.Repeat("x", size))
+	}
+	uploadFile(t, ctx, repo, "/search/notes.txt", "text/plain", strings.Repeat("x", 40))
+	e := routerAs(repo, caller{"app", "calculator", "north", ownFiles})
+
+	list := func(query string) (int, metadata.Page) {
+		rec := serve(e, http.MethodGet, "/files?"+query, "", nil)
+		var page metadata.Page
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		}
+		return rec.Code, page
+	}
+	names := func(page metadata.Page) []string {
+		var names []string
+		for _, meta := range page.Files {
+			names = append(names, meta.FileName)
+		}
+		return names
+	}
+
+	search := "prefix=/search/&name=REPORT&content_type=application/*&min_size=15&sort=-size&limit=1"
+	code, page := list(search)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"report-30.bin"}, names(page))
+	require.NotEmpty(t, page.NextCursor)
+	code, page = list(search + "&cursor=" + page.NextCursor)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"report-20.bin"}, names(page))
+	assert.Empty(t, page.NextCursor)
+
+	code, page = list("tag=original_filename:report-10.bin")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"report-10.bin"}, names(page))
+
+	for _, query := range []string{"sort=owner", "tag=dept", "min_size=-1", "limit=0", "uploaded_after=yesterday", "cursor=abc"} {
+		code, _ := list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	repo, _ := newStorageRepo(t, &config.AppConfig{})
+	ctx := metadata.WithActor(metadata.WithTenant(context.Background(), "north"), "app")
+	fileMeta := uploadFile(t, ctx, repo, "/patch/draft.txt", "text/plain", "patch me")
+	e := routerAs(repo, caller{"app", "calculator", "north", ownFiles})
+	files := "/files/" + fileMeta.ID
+
+	rec := serve(e, http.MethodPatch, files, `{"logical_path": "/patch/final.txt"}`, http.Header{"If-Match": {`"1"`}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = serve(e, http.MethodPatch, files, `{"file_name": "stale.txt"}`, http.Header{"If-Match": {`"1"`}})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	history := func(e *echo.Echo) (int, []metadata.Change) {
+		rec := serve(e, http.MethodGet, files+"/history", "", nil)
+		var resp struct {
+			Changes []metadata.Change `json:"changes"`
+		}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp.Changes
+	}
+	code, changes := history(e)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, changes, 2, "refused patches are not recorded")
+	assert.Equal(t, metadata.ChangeCreated, changes[0].Action)
+	assert.Equal(t, "app", changes[0].Actor)
+	assert.Equal(t, int64(1), changes[0].Revision)
+	assert.Equal(t, metadata.ChangeUpdated, changes[1].Action)
+	assert.Equal(t, "app", changes[1].Actor)
+	assert.Equal(t, int64(2), changes[1].Revision)
+	assert.Equal(t, map[string]metadata.FieldChange{
+		"logical_path": {Before: json.RawMessage(`"/patch/draft.txt"`), After: json.RawMessage(`"/patch/final.txt"`)},
+	}, changes[1].Diff)
+
+	// The history of purged files stays readable for servers that may read every file
+	rec = serve(e, http.MethodDelete, files, "", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	_, err := repo.PurgeTrash(metadata.AllTenants(metadata.WithActor(context.Background(), "system:trash-purger")), time.Now().Add(365*24*time.Hour))
+	require.NoError(t, err)
+	code, _ = history(e)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, changes = history(routerAs(repo, caller{"north-admin", "admin", "north", []string{"*"}}))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, changes, 4)
+	assert.Equal(t, metadata.ChangeDeleted, changes[3].Action)
+	assert.Equal(t, "system:trash-purger", changes[3].Actor)
+	code, _ = history(routerAs(repo, caller{"south-admin", "admin", "south", []string{"*"}}))
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,106 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	"file-manager/metadata"
+	"file-manager/storage"
+)
+
+// ErrLegalHold is returned when a file under legal hold would be deleted or modified.
+var ErrLegalHold = errors.New("file is under legal hold")
+
+// checkLegalHold returns ErrLegalHold when the file is frozen. Every FileRepo path that
+// deletes, moves or modifies a file must call it, whatever the caller's role.
+func checkLegalHold(fileMeta *metadata.FileMetadata) error {
+	if fileMeta.LegalHold != nil {
+		return fmt.Errorf("%w since %s: %s", ErrLegalHold, fileMeta.LegalHold.SetAt.Format(time.RFC3339), fileMeta.LegalHold.Reason)
+	}
+	return nil
+}
+
+// SetLegalHold freezes a file. The hold is recorded in the metadata first, then mirrored
+// to each cloud copy whose bucket supports it (S3 Object Lock, GCS temporary holds, Azure
+// legal holds); copies in buckets without support are protected by the service alone.
+func (s *FileRepo) SetLegalHold(ctx context.Context, fileID, reason, setBy string) (*metadata.FileMetadata, error) {
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	fileMeta, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if fileMeta.LegalHold == nil {
+		hold := &metadata.LegalHold{Reason: reason, SetBy: setBy, SetAt: time.Now()}
+		if _, err := s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{LegalHold: hold}, 0); err != nil {
+			return nil, fmt.Errorf("failed to record legal hold: %w", err)
+		}
+	}
+
+	copies := maps.Clone(fileMeta.CloudCopies)
+	for key, info := range copies {
+		if info.LegalHold {
+			continue
+		}
+		if err := s.setCloudLegalHold(ctx, info, true); err != nil {
+			log.Printf("Legal hold of file %s is enforced by the service only for copy %s: %v", fileID, key, err)
+			continue
+		}
+		held := *info
+		held.LegalHold = true
+		copies[key] = &held
+	}
+	fileMeta, err = s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{CloudCopies: copies}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record cloud legal holds: %w", err)
+	}
+	return fileMeta, nil
+}
+
+// ReleaseLegalHold lifts a file's legal hold. Cloud-side holds are released first so the
+// file stays frozen if any of them cannot be lifted.
+func (s *FileRepo) ReleaseLegalHold(ctx context.Context, fileID string) (*metadata.FileMetadata, error) {
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	fileMeta, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := maps.Clone(fileMeta.CloudCopies)
+	for key, info := range copies {
+		if !info.LegalHold {
+			continue
+		}
+		if err := s.setCloudLegalHold(ctx, info, false); err != nil {
+			return nil, fmt.Errorf("failed to release legal hold of copy %s: %w", key, err)
+		}
+		released := *info
+		released.LegalHold = false
+		copies[key] = &released
+	}
+
+	fileMeta, err = s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{CloudCopies: copies, ReleaseLegalHold: true}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release legal hold: %w", err)
+	}
+	return fileMeta, nil
+}
+
+func (s *FileRepo) setCloudLegalHold(ctx context.Context, info *storage.FileInfo, hold bool) error {
+	adapter, err := s.storageManager.GetAdapter(info.CloudProvider)
+	if err != nil {
+		return err
+	}
+	holder, ok := adapter.(storage.LegalHolder)
+	if !ok {
+		return fmt.Errorf("cloud provider %s does not support legal holds", info.CloudProvider)
+	}
+	return holder.SetLegalHold(ctx, info.Bucket, info.Name, hold)
+}
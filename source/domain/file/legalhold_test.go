@@ -0,0 +1,77 @@
+package file
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+	"file-manager/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegalHoldAccess(t *testing.T) {
+	northAdmin := caller{"north-admin", "admin", "north", []string{"*"}}
+	northApp := caller{"north-app", "calculator", "north", ownFiles}
+	e, repo := testRouter(t, northAdmin)
+	rec := serve(e, http.MethodPut, "/files/n/legal-hold", `{}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a reason is required")
+	rec = serve(e, http.MethodPut, "/files/n/legal-hold", `{"reason": "Litigation 2025-114"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, serve(e, http.MethodDelete, "/files/n", "", nil).Code, "not even admins delete held files")
+	owner := routerAs(repo, northApp)
+	assert.Equal(t, http.StatusForbidden, serve(owner, http.MethodDelete, "/files/n/legal-hold", "", nil).Code, "owners cannot release holds")
+
+	require.Equal(t, http.StatusOK, serve(e, http.MethodDelete, "/files/n/legal-hold", "", nil).Code)
+	assert.Equal(t, http.StatusNoContent, serve(e, http.MethodDelete, "/files/n", "", nil).Code)
+}
+
+func TestLegalHoldInTrash(t *testing.T) {
+	northAdmin := caller{"north-admin", "admin", "north", []string{"*"}}
+	e, repo := testRouter(t, northAdmin)
+	ctx := metadata.WithTenant(context.Background(), "north")
+	fileMeta, err := repo.GetFileMetadata(ctx, "n")
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteFile(ctx, fileMeta, "north-app"))
+	later := time.Now().Add(time.Hour)
+
+	rec := serve(e, http.MethodPut, "/files/n/legal-hold", `{"reason": "Litigation 2025-114"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	purged, err := repo.PurgeTrash(ctx, later)
+	require.NoError(t, err)
+	assert.Zero(t, purged, "held files stay in the trash")
+	held, err := repo.GetFileMetadata(ctx, "n")
+	require.NoError(t, err)
+	require.NotNil(t, held.LegalHold)
+	assert.True(t, held.InTrash())
+
+	rec = serve(e, http.MethodDelete, "/files/n/legal-hold", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	purged, err = repo.PurgeTrash(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged, "released files are purged")
+}
+
+func TestTransferHeldFile(t *testing.T) {
+	repo, clouds := newStorageRepo(t, &config.AppConfig{})
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	file := uploadFile(t, ctx, repo, "/records/a.txt", "text/plain", "patient record")
+	_, err := repo.SetLegalHold(ctx, file.ID, "Litigation 2025-114", "admin")
+	require.NoError(t, err)
+
+	_, err = repo.MoveFile(ctx, file.ID, CopyRequest{TargetCloud: "gcp"})
+	require.ErrorIs(t, err, ErrLegalHold)
+
+	updated, err := repo.CopyFile(ctx, file.ID, CopyRequest{TargetCloud: "gcp"})
+	require.NoError(t, err)
+	copied := updated.CloudCopies["gcp:files"]
+	require.NotNil(t, copied, "copies: %v", updated.CloudCopies)
+	assert.True(t, copied.LegalHold, "new copies are held like the others")
+	assert.ErrorIs(t, clouds["gcp"].Delete(ctx, copied.Bucket, copied.Name), storage.ErrObjectLocked)
+	assert.True(t, updated.CloudCopies["aws"].LegalHold)
+}
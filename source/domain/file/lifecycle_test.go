@@ -0,0 +1,86 @@
+package file
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyLifecycle(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Trash.Retention = 30 * 24 * time.Hour
+	cfg.Lifecycle.Rules = []config.LifecycleRule{
+		{Name: "previews", PathPrefix: "/previews/", ExpireAfterDays: 1},
+		{Name: "records", PathPrefix: "/records/", MinRetentionDays: 3650,
+			Transitions: []config.LifecycleTransition{{AfterDays: 30, Provider: "aws", StorageClass: "GLACIER_IR"}}},
+	}
+	repo, clouds := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	preview := uploadFile(t, ctx, repo, "/previews/a.pdf", "application/pdf", "preview")
+	held := uploadFile(t, ctx, repo, "/previews/held.pdf", "application/pdf", "evidence")
+	record := uploadFile(t, ctx, repo, "/records/a.txt", "text/plain", "patient record")
+	_, err := repo.SetLegalHold(ctx, held.ID, "Litigation 2025-114", "admin")
+	require.NoError(t, err)
+
+	sweep := metadata.AllTenants(metadata.WithActor(context.Background(), "system:lifecycle"))
+	now := time.Now().Add(40 * 24 * time.Hour)
+	report, err := repo.ApplyLifecycle(sweep, now)
+	require.NoError(t, err)
+	assert.Equal(t, &LifecycleReport{Scanned: 3, Expired: 1, Transitioned: 1}, report)
+
+	// Expired files go to the trash rather than being deleted outright
+	expired, err := repo.GetFileMetadata(ctx, preview.ID)
+	require.NoError(t, err)
+	require.True(t, expired.InTrash())
+	assert.Equal(t, now, *expired.DeletedAt)
+	assert.Equal(t, "system:lifecycle", expired.DeletedBy)
+	src := preview.CloudCopies["aws"]
+	_, stored := clouds["aws"].Content(src.Bucket, src.Name)
+	assert.True(t, stored, "the trash keeps the object")
+
+	kept, err := repo.GetFileMetadata(ctx, held.ID)
+	require.NoError(t, err)
+	assert.False(t, kept.InTrash(), "held files do not expire")
+	transitioned, err := repo.GetFileMetadata(ctx, record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "GLACIER_IR", transitioned.CloudCopies["aws"].StorageClass)
+
+	// Expired files stay in the trash for its retention, then go with the rest of it
+	purged, err := repo.PurgeTrash(sweep, now.Add(cfg.Trash.Retention-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = repo.PurgeTrash(sweep, now.Add(cfg.Trash.Retention+time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = repo.GetFileMetadata(ctx, preview.ID)
+	assert.Error(t, err)
+	_, stored = clouds["aws"].Content(src.Bucket, src.Name)
+	assert.False(t, stored, "the purge deletes the object")
+}
+
+func TestDeleteFileRetention(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Lifecycle.Rules = []config.LifecycleRule{{Name: "records", PathPrefix: "/records/", MinRetentionDays: 30}}
+	repo, _ := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	record := uploadFile(t, ctx, repo, "/records/a.txt", "text/plain", "patient record")
+	draft := uploadFile(t, ctx, repo, "/drafts/a.txt", "text/plain", "draft")
+	e := routerAs(repo, caller{"app", "calculator", "clinic", ownFiles})
+
+	rec := serve(e, http.MethodDelete, "/files/"+record.ID, "", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = serve(e, http.MethodGet, "/files/"+record.ID, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(e, http.MethodDelete, "/files/"+draft.ID, "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = serve(e, http.MethodGet, "/files/"+draft.ID, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"file-manager/config"
+	"file-manager/metadata"
+)
+
+var (
+	// ErrQuotaExceeded is returned when an upload does not fit the remaining quota.
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrFileTooLarge is returned when a single file is larger than the whole byte quota.
+	ErrFileTooLarge = errors.New("file is larger than the storage quota")
+)
+
+// quotaReservations counts uploads that passed the quota check but are not recorded in
+// the metadata store yet, so concurrent uploads cannot overshoot a quota together.
+type quotaReservations struct {
+	mu      sync.Mutex
+	servers map[string]metadata.Usage
+	tenants map[string]metadata.Usage
+}
+
+// ScopeUsage is the usage and quota of a server or tenant.
+type ScopeUsage struct {
+	ID string `json:"id"`
+	metadata.Usage
+	config.QuotaLimit
+}
+
+// UsageReport is the usage and quota of a server and of its tenant.
+type UsageReport struct {
+	Server ScopeUsage `json:"server"`
+	Tenant ScopeUsage `json:"tenant"`
+}
+
+// GetUsage returns the storage used by a server and a tenant along with their quotas.
+func (s *FileRepo) GetUsage(ctx context.Context, serverID, tenant string) (*UsageReport, error) {
+	serverUsage, err := s.metadataStore.GetServerUsage(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	tenantUsage, err := s.metadataStore.GetTenantUsage(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	quotas := s.appConfig.Quotas
+	return &UsageReport{
+		Server: ScopeUsage{ID: serverID, Usage: serverUsage, QuotaLimit: quotas.ServerLimit(serverID)},
+		Tenant: ScopeUsage{ID: tenant, Usage: tenantUsage, QuotaLimit: quotas.TenantLimit(tenant)},
+	}, nil
+}
+
+// reserveQuota checks that a file of size stored bytes fits the quotas of the uploading
+// server and its tenant, counting uploads still in flight, and reserves room for it. The
+// returned function releases the reservation once the file is recorded or the upload failed.
+func (s *FileRepo) reserveQuota(ctx context.Context, serverID, tenant string, size int64) (func(), error) {
+	s.reservations.mu.Lock()
+	defer s.reservations.mu.Unlock()
+
+	serverUsage, err := s.metadataStore.GetServerUsage(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota("server "+serverID, s.appConfig.Quotas.ServerLimit(serverID), serverUsage, s.reservations.servers[serverID], size); err != nil {
+		return nil, err
+	}
+	if tenant != "" {
+		tenantUsage, err := s.metadataStore.GetTenantUsage(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkQuota("tenant "+tenant, s.appConfig.Quotas.TenantLimit(tenant), tenantUsage, s.reservations.tenants[tenant], size); err != nil {
+			return nil, err
+		}
+	}
+
+	s.reservations.servers[serverID] = addUsage(s.reservations.servers[serverID], 1, size)
+	s.reservations.tenants[tenant] = addUsage(s.reservations.tenants[tenant], 1, size)
+	return func() {
+		s.reservations.mu.Lock()
+		defer s.reservations.mu.Unlock()
+		s.reservations.servers[serverID] = addUsage(s.reservations.servers[serverID], -1, -size)
+		s.reservations.tenants[tenant] = addUsage(s.reservations.tenants[tenant], -1, -size)
+	}, nil
+}
+
+func checkQuota(scope string, limit config.QuotaLimit, used, reserved metadata.Usage, size int64) error {
+	if limit.MaxBytes > 0 && size > limit.MaxBytes {
+		return fmt.Errorf("%w: %d bytes exceed the %d byte quota of %s", ErrFileTooLarge, size, limit.MaxBytes, scope)
+	}
+	if limit.MaxBytes > 0 && used.Bytes+reserved.Bytes+size > limit.MaxBytes {
+		return fmt.Errorf("%w: %s uses %d of %d bytes", ErrQuotaExceeded, scope, used.Bytes+reserved.Bytes, limit.MaxBytes)
+	}
+	if limit.MaxFiles > 0 && used.Files+reserved.Files+1 > limit.MaxFiles {
+		return fmt.Errorf("%w: %s has %d of %d files", ErrQuotaExceeded, scope, used.Files+reserved.Files, limit.MaxFiles)
+	}
+	return nil
+}
+
+func addUsage(u metadata.Usage, files, bytes int64) metadata.Usage {
+	u.Files += files
+	u.Bytes += bytes
+	return u
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadQuota(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Quotas.Servers = map[string]config.QuotaLimit{"app": {MaxBytes: 1000, MaxFiles: 2}}
+	repo, _ := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+
+	_, err := repo.UploadFile(ctx, uploadRequest(t, "/quota/big.bin", "application/octet-stream", strings.Repeat("x", 2000)))
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	uploadFile(t, ctx, repo, "/quota/1.txt", "text/plain", "patient record")
+	uploadFile(t, ctx, repo, "/quota/2.txt", "text/plain", "patient record")
+	_, err = repo.UploadFile(ctx, uploadRequest(t, "/quota/3.txt", "text/plain", "patient record"))
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	e := routerAs(repo, caller{"app", "calculator", "clinic", ownFiles})
+	rec := serve(e, http.MethodGet, "/files/usage", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, ScopeUsage{ID: "app", Usage: metadata.Usage{Files: 2, Bytes: 28}, QuotaLimit: config.QuotaLimit{MaxBytes: 1000, MaxFiles: 2}}, report.Server)
+	assert.Equal(t, ScopeUsage{ID: "clinic", Usage: metadata.Usage{Files: 2, Bytes: 28}}, report.Tenant)
+
+	rec = serve(e, http.MethodGet, "/files/usage?tenant=other", "", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestUploadQuotaConcurrent(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Quotas.DefaultTenant = config.QuotaLimit{MaxFiles: 3}
+	repo, _ := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		req := uploadRequest(t, fmt.Sprintf("/quota/%d.txt", i), "text/plain", "patient record")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.UploadFile(ctx, req)
+		}()
+	}
+	wg.Wait()
+
+	uploaded := 0
+	for _, err := range errs {
+		if err == nil {
+			uploaded++
+		} else {
+			assert.ErrorIs(t, err, ErrQuotaExceeded)
+		}
+	}
+	assert.Equal(t, 3, uploaded)
+}
@@ -3,16 +3,20 @@ package file
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"mime/multipart"
 	"path/filepath"
 	"slices"
 	"sync"
 	"time"
 
+	"file-manager/compression"
 	"file-manager/config"
+	"file-manager/lifecycle"
 	"file-manager/metadata"
 	"file-manager/storage"
 
@@ -23,20 +27,65 @@ import (
 type FileRepo struct {
 	storageManager *storage.StorageManager
 	metadataStore  metadata.MetadataStore
+	history        metadata.HistoryStore
+	shares         ShareStore
 	appConfig      *config.AppConfig
+	compression    *compression.Policy
+	lifecycle      *lifecycle.Policy
+	reservations   quotaReservations
+	copiesMu       sync.Mutex // Serializes read-modify-write updates of file metadata
+	folderACLMu    sync.Mutex // Serializes read-modify-write updates of folder ACLs
 }
 
-func NewFileRepo(sm *storage.StorageManager, ms metadata.MetadataStore, cfg *config.AppConfig) (*FileRepo, error) {
+func NewFileRepo(sm *storage.StorageManager, ms metadata.MetadataStore, history metadata.HistoryStore, shares ShareStore, cfg *config.AppConfig) (*FileRepo, error) {
+	compressionPolicy, err := compression.NewPolicy(cfg.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression configuration: %w", err)
+	}
+	lifecyclePolicy, err := lifecycle.NewPolicy(cfg.Lifecycle.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifecycle configuration: %w", err)
+	}
 
 	return &FileRepo{
 		storageManager: sm,
 		metadataStore:  ms,
+		history:        history,
+		shares:         shares,
 		appConfig:      cfg,
+		compression:    compressionPolicy,
+		lifecycle:      lifecyclePolicy,
+		reservations: quotaReservations{
+			servers: make(map[string]metadata.Usage),
+			tenants: make(map[string]metadata.Usage),
+		},
 	}, nil
 }
 
-// UploadFile handles file upload, optional encryption, and multi-cloud replication.
-func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader, logicalPath string, targetCloud string) (*metadata.FileMetadata, error) {
+// ErrInvalidUpload is returned for upload options that cannot apply to every cloud the
+// file is uploaded to.
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// UploadRequest describes a single file upload.
+type UploadRequest struct {
+	File        *multipart.FileHeader
+	LogicalPath string
+	TargetCloud string                // Optional: upload to a single cloud instead of the default
+	UploadedBy  string                // Server ID of the uploader
+	Options     storage.UploadOptions // Per-request overrides of the configured upload defaults
+}
+
+// UploadFile handles file upload, optional encryption, and multi-cloud replication. The
+// file belongs to the tenant of ctx.
+func (s *FileRepo) UploadFile(ctx context.Context, req UploadRequest) (*metadata.FileMetadata, error) {
+	tenant, err := metadata.SingleTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fileHeader := req.File
+	logicalPath := req.LogicalPath
+	targetCloud := req.TargetCloud
+
 	src, err := fileHeader.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
@@ -54,6 +103,28 @@ func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHea
 		contentType = "application/octet-stream"
 	}
 
+	// Compress before upload when the content type is configured for it
+	storedBytes := fileBytes
+	contentEncoding := ""
+	if codec := s.compression.Select(contentType, originalSize); codec != nil {
+		compressed, err := codec.Compress(fileBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress file content: %w", err)
+		}
+		// Only keep the compressed form if it actually saves space
+		if len(compressed) < len(fileBytes) {
+			storedBytes = compressed
+			contentEncoding = codec.Encoding()
+		}
+	}
+
+	// Check the quotas before any bytes are written
+	releaseQuota, err := s.reserveQuota(ctx, req.UploadedBy, tenant, int64(len(storedBytes)))
+	if err != nil {
+		return nil, err
+	}
+	defer releaseQuota()
+
 	fileUUID := uuid.New().String()
 	fileName := filepath.Base(logicalPath)
 	if fileName == "." || fileName == "/" { // Handle cases where logicalPath might be a directory
@@ -61,18 +132,25 @@ func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHea
 	}
 
 	fileMeta := &metadata.FileMetadata{
-		ID:          fileUUID,
-		LogicalPath: logicalPath,
-		FileName:    fileName,
-		Size:        originalSize, // Store original size
-		ContentType: contentType,
-		UploadedAt:  time.Now(),
-		CloudCopies: make(map[string]*storage.FileInfo),
-		CustomTags:  map[string]string{"original_filename": fileHeader.Filename},
+		ID:              fileUUID,
+		LogicalPath:     logicalPath,
+		FileName:        fileName,
+		Size:            originalSize, // Store original size
+		ContentType:     contentType,
+		ContentEncoding: contentEncoding,
+		StoredSize:      int64(len(storedBytes)),
+		UploadedAt:      time.Now(),
+		UploadedBy:      req.UploadedBy,
+		Tenant:          tenant,
+		CloudCopies:     make(map[string]*storage.FileInfo),
+		CustomTags:      map[string]string{"original_filename": fileHeader.Filename},
 	}
 
+	// Pick the primary cloud and bucket from the storage routes
+	route := s.routeFor(fileMeta)
+
 	// Determine target clouds for upload
-	cloudsToUpload := []string{s.appConfig.StorageConfig.DefaultCloud}
+	cloudsToUpload := []string{route.Provider}
 	if s.appConfig.StorageConfig.ReplicateToAllClouds {
 		for provider := range s.storageManager.GetAllAdapters() {
 			found := slices.Contains(cloudsToUpload, provider)
@@ -80,9 +158,14 @@ func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHea
 				cloudsToUpload = append(cloudsToUpload, provider)
 			}
 		}
-	} else if targetCloud != "" && targetCloud != s.appConfig.StorageConfig.DefaultCloud {
+	} else if targetCloud != "" && targetCloud != route.Provider {
 		cloudsToUpload = []string{targetCloud} // Override default if specific target is provided and not replicating
 	}
+	// Key IDs are provider-specific: an AWS key ARN means nothing as an Azure encryption scope
+	if req.Options.KMSKeyID != "" && len(cloudsToUpload) > 1 {
+		return nil, fmt.Errorf("%w: kms_key_id names a key of one provider and cannot be used while files are replicated to %d clouds",
+			ErrInvalidUpload, len(cloudsToUpload))
+	}
 
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(cloudsToUpload))
@@ -102,17 +185,25 @@ func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHea
 			}
 
 			// Create a new reader for each upload to avoid issues with exhausted readers
-			uploadReader := bytes.NewReader(fileBytes)
+			uploadReader := bytes.NewReader(storedBytes)
 
 			// Use a unique key for each cloud if needed, or a common one
 			cloudKey := fmt.Sprintf("%s/%s", fileUUID, fileHeader.Filename) // Use UUID as prefix for cloud storage key
 
-			log.Printf("Uploading %s to %s bucket %s with key %s", fileHeader.Filename, p, fileHeader.Filename, cloudKey) // Log bucket name
+			bucket := route.BucketFor(p)
+
+			log.Printf("Uploading %s to %s bucket %s with key %s", fileHeader.Filename, p, bucket, cloudKey) // Log bucket name
 
 			// Pass original content type, not encrypted content type
 			uploadMetadata := map[string]string{"Content-Type": contentType}
+			if contentEncoding != "" {
+				uploadMetadata["Content-Encoding"] = contentEncoding
+			}
+
+			// Provider defaults from config, overridden by per-request options except the tenant's key
+			uploadOptions := storage.UploadOptionsFor(s.appConfig.StorageConfig, p, tenant, req.Options)
 
-			info, uploadErr := adapter.Upload(ctx, fileHeader.Filename, cloudKey, uploadReader, int64(len(fileBytes)), uploadMetadata)
+			info, uploadErr := adapter.Upload(ctx, bucket, cloudKey, uploadReader, int64(len(storedBytes)), uploadMetadata, uploadOptions)
 			if uploadErr != nil {
 				errChan <- fmt.Errorf("failed to upload to %s: %w", p, uploadErr)
 				return
@@ -147,7 +238,383 @@ func (s *FileRepo) UploadFile(ctx context.Context, fileHeader *multipart.FileHea
 	return fileMeta, nil
 }
 
+// QueryFiles returns one page of the files matching a metadata query.
+func (s *FileRepo) QueryFiles(ctx context.Context, q metadata.Query) (*metadata.Page, error) {
+	return s.metadataStore.QueryFileMetadata(ctx, q)
+}
+
 // GetFileMetadata retrieves detailed metadata for a file.
 func (s *FileRepo) GetFileMetadata(ctx context.Context, fileID string) (*metadata.FileMetadata, error) {
 	return s.metadataStore.GetFileMetadata(ctx, fileID)
 }
+
+// FileHistory returns the recorded metadata changes of a file, oldest first. The history
+// outlives the file, so it is also available after the file has been purged.
+func (s *FileRepo) FileHistory(ctx context.Context, fileID string) ([]metadata.Change, error) {
+	return s.history.ListChanges(ctx, fileID)
+}
+
+// UpdateFile applies a client patch to a file's metadata. With a non-zero ifRevision the
+// update fails with metadata.ErrRevisionMismatch if the file changed in the meantime.
+// Files under legal hold cannot be modified, and changes that would take a file out of
+// a running retention fail with lifecycle.ErrRetentionActive.
+func (s *FileRepo) UpdateFile(ctx context.Context, fileID string, patch metadata.Patch, ifRevision int64) (*metadata.FileMetadata, error) {
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	latest, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLegalHold(latest); err != nil {
+		return nil, err
+	}
+	if err := s.lifecycle.CheckChange(latest, patch.Applied(latest), time.Now()); err != nil {
+		return nil, err
+	}
+	return s.metadataStore.UpdateFileMetadata(ctx, fileID, patch, ifRevision)
+}
+
+// DeleteFile moves a file to the trash. Its cloud copies are kept until the trash purge job
+// deletes them, so the file can be restored until then. Files under legal hold are refused
+// with ErrLegalHold and files still under retention with lifecycle.ErrRetentionActive.
+func (s *FileRepo) DeleteFile(ctx context.Context, fileMeta *metadata.FileMetadata, deletedBy string) error {
+	return s.trashFile(ctx, fileMeta, deletedBy, time.Now())
+}
+
+// trashFile is DeleteFile at now.
+func (s *FileRepo) trashFile(ctx context.Context, fileMeta *metadata.FileMetadata, deletedBy string, now time.Time) error {
+	if err := s.lifecycle.CheckDelete(fileMeta, now); err != nil {
+		return err
+	}
+
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+	latest, err := s.metadataStore.GetFileMetadata(ctx, fileMeta.ID)
+	if err != nil {
+		return err
+	}
+	if err := checkLegalHold(latest); err != nil {
+		return err
+	}
+	if latest.InTrash() {
+		return nil
+	}
+
+	_, err = s.metadataStore.UpdateFileMetadata(ctx, fileMeta.ID, metadata.Patch{DeletedAt: &now, DeletedBy: &deletedBy}, 0)
+	if err != nil {
+		return fmt.Errorf("failed to move file to the trash: %w", err)
+	}
+	return nil
+}
+
+// deleteFile permanently removes the metadata first so the file disappears atomically for clients;
+// objects that fail to delete afterwards are only logged as orphans.
+func (s *FileRepo) deleteFile(ctx context.Context, fileMeta *metadata.FileMetadata) error {
+	s.copiesMu.Lock()
+	latest, err := s.metadataStore.GetFileMetadata(ctx, fileMeta.ID)
+	if err == nil {
+		err = checkLegalHold(latest)
+	}
+	if err == nil {
+		err = s.metadataStore.DeleteFileMetadata(ctx, fileMeta.ID)
+	}
+	s.copiesMu.Unlock()
+	if errors.Is(err, ErrLegalHold) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete file metadata: %w", err)
+	}
+	fileMeta = latest
+
+	for key, info := range fileMeta.CloudCopies {
+		adapter, err := s.storageManager.GetAdapter(info.CloudProvider)
+		if err == nil {
+			err = adapter.Delete(ctx, info.Bucket, info.Name)
+		}
+		if err != nil {
+			log.Printf("Failed to delete copy %s of file %s at %s: %v", key, fileMeta.ID, info.StoragePath, err)
+		}
+	}
+	return nil
+}
+
+// Download is the content of a stored file, ready to be streamed to a client.
+type Download struct {
+	Body            io.ReadCloser
+	FileName        string
+	ContentType     string
+	ContentEncoding string // Set when Body is still compressed and must be sent with a Content-Encoding header
+	Size            int64  // Length of Body, -1 if unknown
+}
+
+// DownloadFile opens the stored bytes of a file. Compressed files are passed through
+// as is when acceptEncoding allows their encoding, and decompressed otherwise.
+func (s *FileRepo) DownloadFile(ctx context.Context, fileMeta *metadata.FileMetadata, acceptEncoding string) (*Download, error) {
+	info, err := s.primaryCopy(fileMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := s.storageManager.GetAdapter(info.CloudProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get adapter for %s: %w", info.CloudProvider, err)
+	}
+
+	body, err := adapter.Download(ctx, info.Bucket, info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	download := &Download{
+		Body:        body,
+		FileName:    fileMeta.FileName,
+		ContentType: fileMeta.ContentType,
+		Size:        fileMeta.Size,
+	}
+	if fileMeta.ContentEncoding == "" {
+		return download, nil
+	}
+
+	if compression.AcceptsEncoding(acceptEncoding, fileMeta.ContentEncoding) {
+		download.ContentEncoding = fileMeta.ContentEncoding
+		download.Size = fileMeta.StoredSize
+		return download, nil
+	}
+
+	codec, err := compression.GetCodec(fileMeta.ContentEncoding)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	decompressed, err := codec.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to decompress file content: %w", err)
+	}
+	download.Body = &decompressingReader{ReadCloser: decompressed, source: body}
+	return download, nil
+}
+
+// PresignDownload returns a time-limited URL for downloading a file directly from its
+// primary cloud copy. The URL serves the stored bytes, which may be compressed.
+func (s *FileRepo) PresignDownload(ctx context.Context, fileMeta *metadata.FileMetadata, expiry time.Duration) (string, error) {
+	info, err := s.primaryCopy(fileMeta)
+	if err != nil {
+		return "", err
+	}
+
+	adapter, err := s.storageManager.GetAdapter(info.CloudProvider)
+	if err != nil {
+		return "", fmt.Errorf("failed to get adapter for %s: %w", info.CloudProvider, err)
+	}
+
+	presigner, ok := adapter.(storage.Presigner)
+	if !ok {
+		return "", fmt.Errorf("cloud provider %s does not support presigned URLs", info.CloudProvider)
+	}
+	return presigner.PresignDownload(ctx, info.Bucket, info.Name, expiry)
+}
+
+// primaryCopy picks the cloud copy to read a file from, preferring the default cloud.
+func (s *FileRepo) primaryCopy(fileMeta *metadata.FileMetadata) (*storage.FileInfo, error) {
+	key, err := s.primaryCopyKey(fileMeta)
+	if err != nil {
+		return nil, err
+	}
+	return fileMeta.CloudCopies[key], nil
+}
+
+// decompressingReader closes both the decompressor and the underlying cloud reader.
+type decompressingReader struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (r *decompressingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if sourceErr := r.source.Close(); err == nil {
+		err = sourceErr
+	}
+	return err
+}
+
+var (
+	// ErrCopyExists is returned when the target of a copy already holds a copy of the file.
+	ErrCopyExists = errors.New("file already has a copy at the target location")
+	// ErrInvalidTransfer is returned for copies and moves from an unknown copy, or to an
+	// unknown cloud or a bucket the file's tenant is not routed to.
+	ErrInvalidTransfer = errors.New("invalid copy or move")
+)
+
+// CopyRequest describes a copy or move of a file's stored bytes to another cloud or bucket.
+type CopyRequest struct {
+	Source       string                `json:"source"`        // CloudCopies key to copy from; defaults to the primary copy
+	TargetCloud  string                `json:"target_cloud"`  // Provider to copy to; defaults to the source provider
+	TargetBucket string                `json:"target_bucket"` // Bucket to copy to, one the tenant is routed to; defaults to the routed bucket
+	Options      storage.UploadOptions `json:"-"`             // Encryption and storage class of the new copy; never replace the tenant's key
+}
+
+// CopyFile copies a file's stored bytes to another bucket or cloud and records the new
+// copy in CloudCopies. Copies within a provider are performed server-side; copies across
+// providers are streamed through the service without buffering the whole file.
+func (s *FileRepo) CopyFile(ctx context.Context, fileID string, req CopyRequest) (*metadata.FileMetadata, error) {
+	return s.transferFile(ctx, fileID, req, false)
+}
+
+// MoveFile copies a file like CopyFile, then removes the source copy from CloudCopies and
+// deletes its object. Files under legal hold cannot be moved.
+func (s *FileRepo) MoveFile(ctx context.Context, fileID string, req CopyRequest) (*metadata.FileMetadata, error) {
+	return s.transferFile(ctx, fileID, req, true)
+}
+
+func (s *FileRepo) transferFile(ctx context.Context, fileID string, req CopyRequest, move bool) (*metadata.FileMetadata, error) {
+	fileMeta, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if move {
+		if err := checkLegalHold(fileMeta); err != nil {
+			return nil, err
+		}
+	}
+
+	srcKey := req.Source
+	if srcKey == "" {
+		if srcKey, err = s.primaryCopyKey(fileMeta); err != nil {
+			return nil, err
+		}
+	}
+	src, ok := fileMeta.CloudCopies[srcKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: file %s has no copy %q", ErrInvalidTransfer, fileID, srcKey)
+	}
+
+	targetCloud := req.TargetCloud
+	if targetCloud == "" {
+		targetCloud = src.CloudProvider
+	}
+	dstAdapter, err := s.storageManager.GetAdapter(targetCloud)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+	targetBucket := req.TargetBucket
+	if targetBucket == "" {
+		targetBucket = s.routeFor(fileMeta).BucketFor(targetCloud)
+	}
+	if !slices.Contains(s.storageManager.TenantBuckets(fileMeta.Tenant, targetCloud), targetBucket) {
+		return nil, fmt.Errorf("%w: bucket %s on %s is not routed to tenant %s", ErrInvalidTransfer, targetBucket, targetCloud, fileMeta.Tenant)
+	}
+	// The routed bucket depends on the file's current path and type, so copies are keyed
+	// by bucket too: the upload's copy, keyed by provider alone, may be in any bucket
+	dstKey := targetCloud + ":" + targetBucket
+	// Copies keep their object name, so a copy in the same bucket is the same object; a
+	// move onto it would delete the only one
+	for key, info := range fileMeta.CloudCopies {
+		if info.CloudProvider == targetCloud && info.Bucket == targetBucket {
+			return nil, fmt.Errorf("%w: %s is already stored there as %s", ErrCopyExists, dstKey, key)
+		}
+	}
+
+	opts := storage.UploadOptionsFor(s.appConfig.StorageConfig, targetCloud, fileMeta.Tenant, req.Options)
+
+	var info *storage.FileInfo
+	if targetCloud == src.CloudProvider {
+		// Native server-side copy within the provider
+		info, err = dstAdapter.Copy(ctx, src.Bucket, src.Name, targetBucket, src.Name, opts)
+	} else {
+		info, err = s.streamCopy(ctx, fileMeta, src, dstAdapter, targetBucket, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %s to %s: %w", srcKey, dstKey, err)
+	}
+
+	// Record the new copy (and drop the source on move) in a single metadata update
+	s.copiesMu.Lock()
+	latest, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err == nil && move {
+		err = checkLegalHold(latest) // A hold may have been placed while copying
+	}
+	if err == nil {
+		if latest.LegalHold != nil {
+			// Copies of held files are held too, as SetLegalHold would have done
+			if holdErr := s.setCloudLegalHold(ctx, info, true); holdErr != nil {
+				log.Printf("Legal hold of file %s is enforced by the service only for copy %s: %v", fileID, dstKey, holdErr)
+			} else {
+				info.LegalHold = true
+			}
+		}
+		copies := maps.Clone(latest.CloudCopies)
+		copies[dstKey] = info
+		if move {
+			delete(copies, srcKey)
+		}
+		_, err = s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{CloudCopies: copies}, 0)
+	}
+	s.copiesMu.Unlock()
+	if err != nil {
+		// Roll back the new object so it does not linger without metadata
+		if delErr := dstAdapter.Delete(ctx, info.Bucket, info.Name); delErr != nil {
+			log.Printf("Failed to roll back copy of %s at %s: %v", fileID, info.StoragePath, delErr)
+		}
+		if errors.Is(err, ErrLegalHold) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record copy of file %s: %w", fileID, err)
+	}
+
+	if move {
+		srcAdapter, err := s.storageManager.GetAdapter(src.CloudProvider)
+		if err == nil {
+			err = srcAdapter.Delete(ctx, src.Bucket, src.Name)
+		}
+		if err != nil {
+			// Metadata no longer references the source, so this only leaves an orphaned object
+			log.Printf("Failed to delete source object %s after move: %v", src.StoragePath, err)
+		}
+	}
+
+	return s.metadataStore.GetFileMetadata(ctx, fileID)
+}
+
+// streamCopy pipes an object from one provider into another.
+func (s *FileRepo) streamCopy(ctx context.Context, fileMeta *metadata.FileMetadata, src *storage.FileInfo, dst storage.Storage, bucket string, opts storage.UploadOptions) (*storage.FileInfo, error) {
+	srcAdapter, err := s.storageManager.GetAdapter(src.CloudProvider)
+	if err != nil {
+		return nil, err
+	}
+	body, err := srcAdapter.Download(ctx, src.Bucket, src.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	uploadMetadata := map[string]string{"Content-Type": fileMeta.ContentType}
+	if fileMeta.ContentEncoding != "" {
+		uploadMetadata["Content-Encoding"] = fileMeta.ContentEncoding
+	}
+	return dst.Upload(ctx, bucket, src.Name, body, src.Size, uploadMetadata, opts)
+}
+
+// primaryCopyKey returns the CloudCopies key of the copy returned by primaryCopy.
+func (s *FileRepo) primaryCopyKey(fileMeta *metadata.FileMetadata) (string, error) {
+	if _, ok := fileMeta.CloudCopies[s.appConfig.StorageConfig.DefaultCloud]; ok {
+		return s.appConfig.StorageConfig.DefaultCloud, nil
+	}
+	keys := slices.Sorted(maps.Keys(fileMeta.CloudCopies))
+	if len(keys) == 0 {
+		return "", fmt.Errorf("file %s has no cloud copies", fileMeta.ID)
+	}
+	return keys[0], nil
+}
+
+// routeFor returns the storage route of a file based on its tenant, uploader, path and type.
+func (s *FileRepo) routeFor(fileMeta *metadata.FileMetadata) storage.Route {
+	return s.storageManager.Route(storage.RouteInput{
+		Tenant:      fileMeta.Tenant,
+		ServerID:    fileMeta.UploadedBy,
+		LogicalPath: fileMeta.LogicalPath,
+		ContentType: fileMeta.ContentType,
+	})
+}
@@ -0,0 +1,311 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/lifecycle"
+	"file-manager/metadata"
+	"file-manager/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRepo creates a FileRepo on in-memory stores without cloud storage, for the
+// operations that only touch metadata.
+func newTestRepo(t *testing.T, cfg *config.AppConfig) *FileRepo {
+	t.Helper()
+	history := metadata.NewInMemoryHistoryStore()
+	store := metadata.NewAuditedStore(metadata.NewInMemoryMetadataStore(), history)
+	repo, err := NewFileRepo(nil, store, history, NewInMemoryShareStore(), cfg)
+	require.NoError(t, err)
+	return repo
+}
+
+// newStorageRepo is newTestRepo with in-memory "aws" and "gcp" clouds. Unless cfg names
+// others, "aws" is the default cloud and "files" the default bucket.
+func newStorageRepo(t *testing.T, cfg *config.AppConfig) (*FileRepo, map[string]*storage.InMemoryStorage) {
+	t.Helper()
+	if cfg.StorageConfig.DefaultCloud == "" {
+		cfg.StorageConfig.DefaultCloud = "aws"
+	}
+	if cfg.BucketName == "" {
+		cfg.BucketName = "files"
+	}
+	clouds := map[string]*storage.InMemoryStorage{"aws": storage.NewInMemoryStorage("aws"), "gcp": storage.NewInMemoryStorage("gcp")}
+	adapters := make(map[string]storage.Storage)
+	for provider, cloud := range clouds {
+		adapters[provider] = cloud
+	}
+	sm, err := storage.NewStorageManagerWithAdapters(cfg, adapters)
+	require.NoError(t, err)
+
+	history := metadata.NewInMemoryHistoryStore()
+	store := metadata.NewAuditedStore(metadata.NewInMemoryMetadataStore(), history)
+	repo, err := NewFileRepo(sm, store, history, NewInMemoryShareStore(), cfg)
+	require.NoError(t, err)
+	return repo, clouds
+}
+
+// uploadFile uploads content as the file at path, uploaded by app in the tenant of ctx.
+func uploadFile(t *testing.T, ctx context.Context, repo *FileRepo, path, contentType, content string) *metadata.FileMetadata {
+	t.Helper()
+	meta, err := repo.UploadFile(ctx, uploadRequest(t, path, contentType, content))
+	require.NoError(t, err)
+	return meta
+}
+
+// uploadRequest is the request uploadFile makes.
+func uploadRequest(t *testing.T, path, contentType, content string) UploadRequest {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filepath.Base(path)))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	parsed, err := multipart.NewReader(&body, form.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	return UploadRequest{File: parsed.File["file"][0], LogicalPath: path, UploadedBy: "app"}
+}
+
+// addFiles stores files of the tenant of ctx, uploaded a day ago.
+func addFiles(t *testing.T, ctx context.Context, repo *FileRepo, files ...*metadata.FileMetadata) {
+	t.Helper()
+	tenant, err := metadata.SingleTenant(ctx)
+	require.NoError(t, err)
+	for _, meta := range files {
+		meta.Tenant = tenant
+		if meta.UploadedAt.IsZero() {
+			meta.UploadedAt = time.Now().Add(-24 * time.Hour)
+		}
+		require.NoError(t, repo.metadataStore.CreateFileMetadata(ctx, meta))
+	}
+}
+
+func TestUpdateFileRetention(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Lifecycle.Rules = []config.LifecycleRule{
+		{Name: "records", PathPrefix: "/records/", MinRetentionDays: 30},
+		{Name: "legal", Tags: map[string]string{"class": "legal"}, MinRetentionDays: 365},
+	}
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name    string
+		patch   metadata.Patch
+		wantErr error
+	}{
+		{"rename within the rule", metadata.Patch{FileName: str("b.pdf")}, nil},
+		{"move within the rule", metadata.Patch{LogicalPath: str("/records/2025/a.pdf")}, nil},
+		{"move out of the rule", metadata.Patch{LogicalPath: str("/other/a.pdf")}, lifecycle.ErrRetentionActive},
+		{"tag without changing the rule", metadata.Patch{CustomTags: map[string]*string{"class": str("legal")}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, cfg)
+			addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/records/a.pdf", FileName: "a.pdf", UploadedBy: "app"})
+
+			_, err := repo.UpdateFile(ctx, "f", tt.patch, 0)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("untag out of a longer rule", func(t *testing.T) {
+		ctx := metadata.WithTenant(context.Background(), "clinic")
+		repo := newTestRepo(t, cfg)
+		addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/legal/a.pdf", UploadedBy: "app",
+			CustomTags: map[string]string{"class": "legal"}})
+		_, err := repo.UpdateFile(ctx, "f", metadata.Patch{ClearTags: true}, 0)
+		assert.ErrorIs(t, err, lifecycle.ErrRetentionActive)
+	})
+}
+
+func TestMoveFolderRetention(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Lifecycle.Rules = []config.LifecycleRule{{Name: "records", PathPrefix: "/records/", MinRetentionDays: 30}}
+	tests := []struct {
+		name     string
+		from, to string
+		wantErr  error
+	}{
+		{"within the rule", "/records/2025/", "/records/archive/", nil},
+		{"out of the rule", "/records/2025/", "/other/", lifecycle.ErrRetentionActive},
+		{"unretained folder", "/drafts/", "/other/", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, cfg)
+			addFiles(t, ctx, repo,
+				&metadata.FileMetadata{ID: "r", LogicalPath: "/records/2025/a.pdf", UploadedBy: "app"},
+				&metadata.FileMetadata{ID: "d", LogicalPath: "/drafts/b.pdf", UploadedBy: "app"},
+			)
+
+			_, err := repo.MoveFolder(ctx, tt.from, tt.to, "", nil)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				meta, err := repo.GetFileMetadata(ctx, "r")
+				require.NoError(t, err)
+				assert.Equal(t, "/records/2025/a.pdf", meta.LogicalPath, "refused moves change nothing")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUploadKMSKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		replicate bool
+		key       string // kms_key_id of the request
+		wantErr   error
+		wantKeys  map[string]string // Copy key -> KMS key
+	}{
+		{name: "configured keys", wantKeys: map[string]string{"aws": "arn:aws:kms:configured"}},
+		{name: "requested key", key: "arn:aws:kms:requested", wantKeys: map[string]string{"aws": "arn:aws:kms:requested"}},
+		{name: "replicas use their configured keys", replicate: true,
+			wantKeys: map[string]string{"aws": "arn:aws:kms:configured", "gcp": "projects/p/locations/l/keyRings/r/cryptoKeys/configured"}},
+		{name: "requested key on replicas", replicate: true, key: "arn:aws:kms:requested", wantErr: ErrInvalidUpload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.AppConfig{}
+			cfg.StorageConfig.ReplicateToAllClouds = tt.replicate
+			cfg.StorageConfig.AWSEncryption = storage.EncryptionKMS
+			cfg.StorageConfig.AWSKMSKeyID = "arn:aws:kms:configured"
+			cfg.StorageConfig.GCPKMSKeyName = "projects/p/locations/l/keyRings/r/cryptoKeys/configured"
+			repo, clouds := newStorageRepo(t, cfg)
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+
+			req := uploadRequest(t, "/records/a.txt", "text/plain", "patient record")
+			req.Options = storage.UploadOptions{Encryption: storage.EncryptionKMS, KMSKeyID: tt.key}
+			meta, err := repo.UploadFile(ctx, req)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				for provider, cloud := range clouds {
+					objects, err := cloud.List(ctx, "files", "")
+					require.NoError(t, err)
+					assert.Empty(t, objects, "nothing is uploaded to %s", provider)
+				}
+				return
+			}
+			require.NoError(t, err)
+			keys := make(map[string]string)
+			for key, info := range meta.CloudCopies {
+				keys[key] = info.KMSKeyID
+				assert.Equal(t, storage.EncryptionKMS, info.Encryption, key)
+			}
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+}
+
+func TestTransferFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        CopyRequest
+		move       bool
+		wantErr    error
+		wantKey    string // Of the new copy
+		wantCloud  string
+		wantBucket string
+	}{
+		{name: "copy to another bucket", req: CopyRequest{TargetBucket: "archive"}, wantKey: "aws:archive", wantCloud: "aws", wantBucket: "archive"},
+		{name: "copy to another cloud", req: CopyRequest{TargetCloud: "gcp"}, wantKey: "gcp:files", wantCloud: "gcp", wantBucket: "files"},
+		{name: "move to another bucket", req: CopyRequest{Source: "aws", TargetBucket: "archive"}, move: true, wantKey: "aws:archive", wantCloud: "aws", wantBucket: "archive"},
+		{name: "move to another cloud", req: CopyRequest{TargetCloud: "gcp"}, move: true, wantKey: "gcp:files", wantCloud: "gcp", wantBucket: "files"},
+		{name: "copy onto the source", req: CopyRequest{TargetBucket: "files"}, wantErr: ErrCopyExists},
+		{name: "move onto the source", req: CopyRequest{}, move: true, wantErr: ErrCopyExists},
+		{name: "bucket of no route", req: CopyRequest{TargetBucket: "elsewhere"}, wantErr: ErrInvalidTransfer},
+		{name: "unknown cloud", req: CopyRequest{TargetCloud: "azure"}, wantErr: ErrInvalidTransfer},
+		{name: "unknown source", req: CopyRequest{Source: "gcp", TargetBucket: "archive"}, wantErr: ErrInvalidTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.AppConfig{}
+			cfg.StorageConfig.Routes = []config.StorageRoute{{PathPrefix: "/archive/", Bucket: "archive"}}
+			repo, clouds := newStorageRepo(t, cfg)
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			file := uploadFile(t, ctx, repo, "/records/a.txt", "text/plain", "patient record")
+			src := file.CloudCopies["aws"]
+
+			var updated *metadata.FileMetadata
+			var err error
+			if tt.move {
+				updated, err = repo.MoveFile(ctx, file.ID, tt.req)
+			} else {
+				updated, err = repo.CopyFile(ctx, file.ID, tt.req)
+			}
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				stored, err := repo.GetFileMetadata(ctx, file.ID)
+				require.NoError(t, err)
+				assert.Equal(t, file.CloudCopies, stored.CloudCopies, "failed transfers record nothing")
+				return
+			}
+			require.NoError(t, err)
+
+			copied := updated.CloudCopies[tt.wantKey]
+			require.NotNil(t, copied, "copies: %v", updated.CloudCopies)
+			assert.Equal(t, tt.wantCloud, copied.CloudProvider)
+			assert.Equal(t, tt.wantBucket, copied.Bucket)
+			content, ok := clouds[tt.wantCloud].Content(tt.wantBucket, copied.Name)
+			require.True(t, ok)
+			assert.Equal(t, "patient record", string(content))
+
+			_, kept := updated.CloudCopies["aws"]
+			_, srcExists := clouds["aws"].Content(src.Bucket, src.Name)
+			assert.Equal(t, !tt.move, kept, "the source copy is only dropped by moves")
+			assert.Equal(t, !tt.move, srcExists, "the source object is only deleted by moves")
+
+			download, err := repo.DownloadFile(ctx, updated, "")
+			require.NoError(t, err)
+			defer download.Body.Close()
+			got, err := io.ReadAll(download.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "patient record", string(got))
+		})
+	}
+}
+
+func TestTransferFileAfterRerouting(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.StorageConfig.Routes = []config.StorageRoute{{PathPrefix: "/archive/", Bucket: "archive"}}
+	repo, _ := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	file := uploadFile(t, ctx, repo, "/records/a.txt", "text/plain", "patient record")
+
+	// The upload's copy stays in "files" while the file is now routed to "archive"
+	archived := "/archive/a.txt"
+	_, err := repo.UpdateFile(ctx, file.ID, metadata.Patch{LogicalPath: &archived}, 0)
+	require.NoError(t, err)
+
+	updated, err := repo.CopyFile(ctx, file.ID, CopyRequest{})
+	require.NoError(t, err)
+	require.Contains(t, updated.CloudCopies, "aws:archive")
+	assert.Equal(t, "archive", updated.CloudCopies["aws:archive"].Bucket)
+	assert.Equal(t, "files", updated.CloudCopies["aws"].Bucket, "the upload's copy is kept")
+
+	_, err = repo.CopyFile(ctx, file.ID, CopyRequest{TargetBucket: "files"})
+	assert.ErrorIs(t, err, ErrCopyExists, "the upload's copy is still found in its bucket")
+}
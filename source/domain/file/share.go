@@ -0,0 +1,384 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"file-manager/metadata"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidShare is returned for share links with a bad expiry, download limit or passcode.
+	ErrInvalidShare = errors.New("invalid share link")
+	// ErrShareNotFound is returned for unknown share links and tokens.
+	ErrShareNotFound = errors.New("share link not found")
+	// ErrShareUnavailable is returned for share links that are expired, revoked or used up,
+	// or whose file is gone.
+	ErrShareUnavailable = errors.New("share link is no longer available")
+	// ErrPasscodeRequired is returned when a share link with a passcode is used without one.
+	ErrPasscodeRequired = errors.New("passcode required")
+	// ErrWrongPasscode is returned when a share link is used with the wrong passcode.
+	ErrWrongPasscode = errors.New("wrong passcode")
+)
+
+// Outcomes of share link accesses.
+const (
+	ShareDownloaded       = "downloaded"
+	ShareUnavailable      = "unavailable"
+	SharePasscodeRequired = "passcode_required"
+	ShareWrongPasscode    = "wrong_passcode"
+	ShareLocked           = "locked" // Too many wrong passcodes revoked the link
+)
+
+// minPasscodeLength is the shortest passcode a share link accepts.
+const minPasscodeLength = 6
+
+// ShareLink lets anyone holding its token download one file without credentials, until
+// it expires, is revoked or reaches its download limit. Only hashes of the token and
+// passcode are kept.
+type ShareLink struct {
+	ID               string     `json:"id"`
+	FileID           string     `json:"file_id"`
+	Tenant           string     `json:"-"` // Tenant of the file, whose files alone the link reaches
+	TokenHash        string     `json:"-"`
+	PasscodeHash     string     `json:"-"`
+	HasPasscode      bool       `json:"has_passcode"`
+	CreatedBy        string     `json:"created_by"` // Server ID
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	MaxDownloads     int        `json:"max_downloads,omitempty"` // 0 is unlimited
+	Downloads        int        `json:"downloads"`
+	FailedPasscodes  int        `json:"failed_passcodes,omitempty"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Available reports whether the link can still be used at now.
+func (l *ShareLink) Available(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt) && (l.MaxDownloads == 0 || l.Downloads < l.MaxDownloads)
+}
+
+// ShareAccess records one use of a share link.
+type ShareAccess struct {
+	At        time.Time `json:"at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   string    `json:"outcome"`
+}
+
+// ShareStore persists share links and their access logs.
+type ShareStore interface {
+	CreateShare(ctx context.Context, link *ShareLink) error
+	GetShare(ctx context.Context, id string) (*ShareLink, error)
+	GetShareByToken(ctx context.Context, tokenHash string) (*ShareLink, error)
+	ListShares(ctx context.Context, fileID string) ([]*ShareLink, error) // Oldest first
+	// UpdateShare applies update to a copy of a link and stores the copy, even when update
+	// returns an error, which UpdateShare then returns. Updates of a link are serialized.
+	UpdateShare(ctx context.Context, id string, update func(*ShareLink) error) (*ShareLink, error)
+	AppendAccess(ctx context.Context, id string, access ShareAccess) error
+	ListAccesses(ctx context.Context, id string) ([]ShareAccess, error) // Oldest first, never nil
+}
+
+// InMemoryShareStore is a simple in-memory implementation of ShareStore.
+// NOT FOR PRODUCTION USE.
+type InMemoryShareStore struct {
+	mu       sync.Mutex
+	links    map[string]*ShareLink    // map[id]*ShareLink
+	tokens   map[string]string        // map[tokenHash]id
+	accesses map[string][]ShareAccess // map[id][]ShareAccess
+}
+
+// NewInMemoryShareStore creates an empty InMemoryShareStore.
+func NewInMemoryShareStore() *InMemoryShareStore {
+	return &InMemoryShareStore{
+		links:    make(map[string]*ShareLink),
+		tokens:   make(map[string]string),
+		accesses: make(map[string][]ShareAccess),
+	}
+}
+
+// CreateShare stores a new link.
+func (m *InMemoryShareStore) CreateShare(ctx context.Context, link *ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *link
+	m.links[link.ID] = &copied
+	m.tokens[link.TokenHash] = link.ID
+	return nil
+}
+
+// GetShare returns a copy of a link.
+func (m *InMemoryShareStore) GetShare(ctx context.Context, id string) (*ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	copied := *link
+	return &copied, nil
+}
+
+// GetShareByToken returns a copy of the link with a token hash.
+func (m *InMemoryShareStore) GetShareByToken(ctx context.Context, tokenHash string) (*ShareLink, error) {
+	m.mu.Lock()
+	id, ok := m.tokens[tokenHash]
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	return m.GetShare(ctx, id)
+}
+
+// ListShares returns copies of the links of a file.
+func (m *InMemoryShareStore) ListShares(ctx context.Context, fileID string) ([]*ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	links := make([]*ShareLink, 0)
+	for _, link := range m.links {
+		if link.FileID == fileID {
+			copied := *link
+			links = append(links, &copied)
+		}
+	}
+	slices.SortFunc(links, func(a, b *ShareLink) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return links, nil
+}
+
+// UpdateShare implements ShareStore.
+func (m *InMemoryShareStore) UpdateShare(ctx context.Context, id string, update func(*ShareLink) error) (*ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	copied := *link
+	err := update(&copied)
+	m.links[id] = &copied
+	result := copied
+	return &result, err
+}
+
+// AppendAccess adds an entry to a link's access log.
+func (m *InMemoryShareStore) AppendAccess(ctx context.Context, id string, access ShareAccess) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accesses[id] = append(m.accesses[id], access)
+	return nil
+}
+
+// ListAccesses returns a link's access log.
+func (m *InMemoryShareStore) ListAccesses(ctx context.Context, id string) ([]ShareAccess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ShareAccess{}, m.accesses[id]...), nil
+}
+
+// ShareRequest describes a new share link.
+type ShareRequest struct {
+	ExpiresAt    time.Time // Zero for the configured default lifetime
+	MaxDownloads int       // 0 is unlimited
+	Passcode     string    // Optional
+	CreatedBy    string    // Server ID
+}
+
+// hashShareToken returns the stored form of a share token.
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShare creates a share link for a file and returns it with its token, which is
+// only available here.
+func (s *FileRepo) CreateShare(ctx context.Context, fileMeta *metadata.FileMetadata, req ShareRequest) (*ShareLink, string, error) {
+	tenant, err := metadata.SingleTenant(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg := s.appConfig.Shares
+	now := time.Now().UTC()
+	expiresAt := req.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(cfg.DefaultTTL)
+	}
+	if !expiresAt.After(now) {
+		return nil, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidShare)
+	}
+	if expiresAt.Sub(now) > cfg.MaxTTL {
+		return nil, "", fmt.Errorf("%w: share links can last at most %s", ErrInvalidShare, cfg.MaxTTL)
+	}
+	if req.MaxDownloads < 0 {
+		return nil, "", fmt.Errorf("%w: max_downloads must not be negative", ErrInvalidShare)
+	}
+	if req.Passcode != "" && len(req.Passcode) < minPasscodeLength {
+		return nil, "", fmt.Errorf("%w: passcodes need at least %d characters", ErrInvalidShare, minPasscodeLength)
+	}
+
+	token := rand.Text()
+	link := &ShareLink{
+		ID:           uuid.NewString(),
+		FileID:       fileMeta.ID,
+		Tenant:       tenant,
+		TokenHash:    hashShareToken(token),
+		CreatedBy:    req.CreatedBy,
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt.UTC(),
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.Passcode != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Passcode), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidShare, err)
+		}
+		link.PasscodeHash = string(hashed)
+		link.HasPasscode = true
+	}
+	if err := s.shares.CreateShare(ctx, link); err != nil {
+		return nil, "", err
+	}
+	return link, token, nil
+}
+
+// ListShares returns the share links of a file.
+func (s *FileRepo) ListShares(ctx context.Context, fileID string) ([]*ShareLink, error) {
+	return s.shares.ListShares(ctx, fileID)
+}
+
+// GetShare returns a share link of a file with its access log.
+func (s *FileRepo) GetShare(ctx context.Context, fileID, shareID string) (*ShareLink, []ShareAccess, error) {
+	link, err := s.shares.GetShare(ctx, shareID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if link.FileID != fileID {
+		return nil, nil, ErrShareNotFound
+	}
+	accesses, err := s.shares.ListAccesses(ctx, shareID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return link, accesses, nil
+}
+
+// RevokeShare stops a share link of a file from working. Revoking twice keeps the first
+// revocation time.
+func (s *FileRepo) RevokeShare(ctx context.Context, fileID, shareID string) (*ShareLink, error) {
+	link, err := s.shares.GetShare(ctx, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if link.FileID != fileID {
+		return nil, ErrShareNotFound
+	}
+	return s.shares.UpdateShare(ctx, shareID, func(l *ShareLink) error {
+		if l.RevokedAt == nil {
+			now := time.Now().UTC()
+			l.RevokedAt = &now
+		}
+		return nil
+	})
+}
+
+// RedeemShare checks a share token and passcode and counts a download. It returns the
+// link's file, or ErrShareNotFound, ErrShareUnavailable, ErrPasscodeRequired or
+// ErrWrongPasscode. Too many wrong passcodes revoke the link. Every use of an existing
+// link is recorded in its access log with the outcome. The file is looked up in the
+// tenant the link was created in.
+func (s *FileRepo) RedeemShare(ctx context.Context, token, passcode string, access ShareAccess) (*metadata.FileMetadata, error) {
+	link, err := s.shares.GetShareByToken(ctx, hashShareToken(token))
+	if err != nil {
+		if errors.Is(err, ErrShareNotFound) {
+			log.Printf("Share link with an unknown token accessed from %s", access.IP)
+		}
+		return nil, err
+	}
+
+	fileMeta, err := s.metadataStore.GetFileMetadata(metadata.WithTenant(ctx, link.Tenant), link.FileID)
+	if err == nil && fileMeta.InTrash() {
+		err = ErrShareUnavailable
+	}
+	if err != nil {
+		s.recordShareAccess(ctx, link, access, ShareUnavailable)
+		return nil, ErrShareUnavailable
+	}
+
+	// The passcode is compared against the copy read above, so the slow hash does not hold
+	// up the share store. The update below only records the outcome, re-checking what
+	// other redemptions may have changed in the meantime.
+	outcome := ShareDownloaded
+	if !link.Available(time.Now()) {
+		outcome = ShareUnavailable
+	} else if link.PasscodeHash != "" {
+		if passcode == "" {
+			outcome = SharePasscodeRequired
+		} else if bcrypt.CompareHashAndPassword([]byte(link.PasscodeHash), []byte(passcode)) != nil {
+			outcome = ShareWrongPasscode
+		}
+	}
+
+	maxAttempts := s.appConfig.Shares.MaxPasscodeAttempts
+	switch outcome {
+	case ShareUnavailable:
+		err = ErrShareUnavailable
+	case SharePasscodeRequired:
+		err = ErrPasscodeRequired
+	case ShareWrongPasscode:
+		_, err = s.shares.UpdateShare(ctx, link.ID, func(l *ShareLink) error {
+			l.FailedPasscodes++
+			if l.RevokedAt == nil && l.FailedPasscodes >= maxAttempts {
+				now := time.Now().UTC()
+				outcome = ShareLocked
+				l.RevokedAt = &now
+			}
+			return ErrWrongPasscode
+		})
+	default:
+		_, err = s.shares.UpdateShare(ctx, link.ID, func(l *ShareLink) error {
+			now := time.Now().UTC()
+			if !l.Available(now) || (l.PasscodeHash != "" && l.FailedPasscodes >= maxAttempts) {
+				outcome = ShareUnavailable
+				return ErrShareUnavailable
+			}
+			l.Downloads++
+			l.LastDownloadedAt = &now
+			return nil
+		})
+	}
+	s.recordShareAccess(ctx, link, access, outcome)
+	if err != nil {
+		return nil, err
+	}
+	return fileMeta, nil
+}
+
+// recordShareAccess appends to a link's access log and logs the access.
+func (s *FileRepo) recordShareAccess(ctx context.Context, link *ShareLink, access ShareAccess, outcome string) {
+	access.At = time.Now().UTC()
+	access.Outcome = outcome
+	log.Printf("Share link %s of file %s accessed from %s: %s", link.ID, link.FileID, access.IP, outcome)
+	if err := s.shares.AppendAccess(ctx, link.ID, access); err != nil {
+		log.Printf("Error recording access to share link %s: %v", link.ID, err)
+	}
+}
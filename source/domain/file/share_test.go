@@ -0,0 +1,233 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shareConfig() *config.AppConfig {
+	cfg := &config.AppConfig{}
+	cfg.Shares = config.ShareConfig{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour, MaxPasscodeAttempts: 3}
+	return cfg
+}
+
+func TestRedeemSharePasscodes(t *testing.T) {
+	const passcode = "clinic-2025"
+	tests := []struct {
+		name      string
+		passcode  string   // Of the link
+		attempts  []string // Passcodes tried before the checked attempt
+		try       string
+		wantErr   error
+		downloads int
+	}{
+		{name: "no passcode needed", try: "", downloads: 1},
+		{name: "right passcode", passcode: passcode, try: passcode, downloads: 1},
+		{name: "missing passcode", passcode: passcode, try: "", wantErr: ErrPasscodeRequired},
+		{name: "wrong passcode", passcode: passcode, try: "guess-1", wantErr: ErrWrongPasscode},
+		{name: "right passcode after wrong ones", passcode: passcode, attempts: []string{"guess-1", "guess-2"}, try: passcode, downloads: 1},
+		{name: "locked after too many wrong ones", passcode: passcode, attempts: []string{"guess-1", "guess-2", "guess-3"}, try: passcode, wantErr: ErrShareUnavailable},
+		{name: "missing passcodes do not count", passcode: passcode, attempts: []string{"", "", ""}, try: passcode, downloads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, shareConfig())
+			addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/a.pdf", UploadedBy: "app"})
+			fileMeta, err := repo.GetFileMetadata(ctx, "f")
+			require.NoError(t, err)
+			link, token, err := repo.CreateShare(ctx, fileMeta, ShareRequest{Passcode: tt.passcode, CreatedBy: "app"})
+			require.NoError(t, err)
+
+			for _, attempt := range tt.attempts {
+				_, _ = repo.RedeemShare(context.Background(), token, attempt, ShareAccess{IP: "192.0.2.1"})
+			}
+			got, err := repo.RedeemShare(context.Background(), token, tt.try, ShareAccess{IP: "192.0.2.1"})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "f", got.ID)
+			}
+
+			stored, accesses, err := repo.GetShare(ctx, "f", link.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.downloads, stored.Downloads)
+			assert.Len(t, accesses, len(tt.attempts)+1, "every use is logged")
+		})
+	}
+}
+
+func TestRedeemShareLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ShareRequest
+		revoke  bool
+		trash   bool
+		uses    int
+		wantErr error
+	}{
+		{name: "within the download limit", req: ShareRequest{MaxDownloads: 2}, uses: 1},
+		{name: "download limit reached", req: ShareRequest{MaxDownloads: 2}, uses: 2, wantErr: ErrShareUnavailable},
+		{name: "revoked", revoke: true, wantErr: ErrShareUnavailable},
+		{name: "file in the trash", trash: true, wantErr: ErrShareUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.WithTenant(context.Background(), "clinic")
+			repo := newTestRepo(t, shareConfig())
+			addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/a.pdf", UploadedBy: "app"})
+			fileMeta, err := repo.GetFileMetadata(ctx, "f")
+			require.NoError(t, err)
+			link, token, err := repo.CreateShare(ctx, fileMeta, tt.req)
+			require.NoError(t, err)
+
+			if tt.revoke {
+				_, err = repo.RevokeShare(ctx, "f", link.ID)
+				require.NoError(t, err)
+			}
+			if tt.trash {
+				now := time.Now()
+				_, err = repo.metadataStore.UpdateFileMetadata(ctx, "f", metadata.Patch{DeletedAt: &now}, 0)
+				require.NoError(t, err)
+			}
+			for range tt.uses {
+				_, err := repo.RedeemShare(context.Background(), token, "", ShareAccess{})
+				require.NoError(t, err)
+			}
+			_, err = repo.RedeemShare(context.Background(), token, "", ShareAccess{})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		repo := newTestRepo(t, shareConfig())
+		_, err := repo.RedeemShare(context.Background(), "nope", "", ShareAccess{})
+		assert.ErrorIs(t, err, ErrShareNotFound)
+	})
+}
+
+func TestRedeemShareConcurrentGuesses(t *testing.T) {
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	repo := newTestRepo(t, shareConfig())
+	addFiles(t, ctx, repo, &metadata.FileMetadata{ID: "f", LogicalPath: "/a.pdf", UploadedBy: "app"})
+	fileMeta, err := repo.GetFileMetadata(ctx, "f")
+	require.NoError(t, err)
+	link, token, err := repo.CreateShare(ctx, fileMeta, ShareRequest{Passcode: "clinic-2025"})
+	require.NoError(t, err)
+
+	// Guesses are checked outside the store lock, so they run in parallel, but every one
+	// of them is counted.
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = repo.RedeemShare(context.Background(), token, "guess-"+string(rune('a'+i)), ShareAccess{})
+		}()
+	}
+	wg.Wait()
+
+	stored, _, err := repo.GetShare(ctx, "f", link.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+	_, err = repo.RedeemShare(context.Background(), token, "clinic-2025", ShareAccess{})
+	assert.ErrorIs(t, err, ErrShareUnavailable)
+}
+
+func TestShareLinkDownloads(t *testing.T) {
+	repo, _ := newStorageRepo(t, shareConfig())
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	fileMeta := uploadFile(t, ctx, repo, "/shared/reports/dosage.txt", "text/plain", "dosage report")
+	_, err := repo.SetFileACL(ctx, fileMeta.ID, metadata.ACL{{Role: "analytics", Access: []string{metadata.AccessRead}}})
+	require.NoError(t, err)
+	e := routerAs(repo, caller{"app", "calculator", "clinic", ownFiles})
+	files := "/files/" + fileMeta.ID
+
+	// Access granted by an ACL does not extend to sharing
+	analytics := routerAs(repo, caller{"analytics-server", "analytics", "clinic", ownFiles})
+	rec := serve(analytics, http.MethodGet, files, "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(analytics, http.MethodPost, files+"/shares", `{}`, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(e, http.MethodPost, files+"/shares", `{"expires_in": 31536000}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "beyond the maximum lifetime")
+	rec = serve(e, http.MethodPost, files+"/shares", `{"expires_in": 3600, "max_downloads": 2, "passcode": "clinic-2025"}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "http://example.com/s/"+created.Token, created.URL)
+	link := "/s/" + created.Token
+
+	passcode := func(code string) http.Header { return http.Header{"X-Share-Passcode": {code}} }
+	steps := []struct {
+		name       string
+		method     string
+		body       string
+		header     http.Header
+		wantStatus int
+	}{
+		{"no passcode", http.MethodGet, "", nil, http.StatusUnauthorized},
+		{"browser without a passcode", http.MethodGet, "", http.Header{echo.HeaderAccept: {echo.MIMETextHTML}}, http.StatusUnauthorized},
+		{"wrong passcode", http.MethodGet, "", passcode("wrong-code"), http.StatusForbidden},
+		{"right passcode", http.MethodGet, "", passcode("clinic-2025"), http.StatusOK},
+		{"passcode form", http.MethodPost, "passcode=clinic-2025", http.Header{echo.HeaderContentType: {echo.MIMEApplicationForm}}, http.StatusOK},
+		{"used up", http.MethodGet, "", passcode("clinic-2025"), http.StatusGone},
+	}
+	for _, step := range steps {
+		rec := serve(e, step.method, link, step.body, step.header)
+		require.Equal(t, step.wantStatus, rec.Code, step.name)
+		if step.wantStatus == http.StatusOK {
+			assert.Equal(t, "dosage report", rec.Body.String(), step.name)
+		}
+	}
+	rec = serve(e, http.MethodGet, link, "", http.Header{echo.HeaderAccept: {echo.MIMETextHTML}})
+	assert.NotContains(t, rec.Body.String(), "<form", "used up links show no passcode form")
+
+	rec = serve(e, http.MethodGet, files+"/shares/"+created.ID, "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stored struct {
+		Downloads int           `json:"downloads"`
+		Accesses  []ShareAccess `json:"accesses"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stored))
+	assert.Equal(t, 2, stored.Downloads)
+	var outcomes []string
+	for _, access := range stored.Accesses {
+		outcomes = append(outcomes, access.Outcome)
+	}
+	assert.Subset(t, outcomes, []string{"passcode_required", "wrong_passcode", "downloaded", "unavailable"})
+
+	// Revoked links stop working, unknown ones were never there
+	rec = serve(e, http.MethodPost, files+"/shares", `{}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	rec = serve(e, http.MethodGet, "/s/"+created.Token, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(e, http.MethodDelete, files+"/shares/"+created.ID, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(e, http.MethodGet, "/s/"+created.Token, "", nil)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	rec = serve(e, http.MethodGet, "/s/unknown-token", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,101 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTenantIsolation(t *testing.T) {
+	tests := []struct {
+		name       string
+		as         caller
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"read own file", caller{"north-app", "calculator", "north", ownFiles}, http.MethodGet, "/files/n", "", http.StatusOK},
+		{"read another tenant's file", caller{"south-app", "calculator", "south", ownFiles}, http.MethodGet, "/files/n", "", http.StatusNotFound},
+		{"admin reads another tenant's file", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodGet, "/files/n", "", http.StatusNotFound},
+		{"update another tenant's file", caller{"south-app", "calculator", "south", ownFiles}, http.MethodPatch, "/files/n", `{"file_name": "x.pdf"}`, http.StatusNotFound},
+		{"share another tenant's file", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodPut, "/files/n/acl", `{"acl": [{"server": "south-app", "access": ["read"]}]}`, http.StatusNotFound},
+		{"admin downloads another tenant's file", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodGet, "/files/n/download", "", http.StatusNotFound},
+		{"admin reads another tenant's history", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodGet, "/files/n/history", "", http.StatusNotFound},
+		{"admin reads another tenant's ACL", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodGet, "/files/n/acl", "", http.StatusNotFound},
+		{"admin lists another tenant's shares", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodGet, "/files/n/shares", "", http.StatusNotFound},
+		{"admin shares another tenant's file", caller{"south-admin", "admin", "south", []string{"*"}}, http.MethodPost, "/files/n/shares", `{}`, http.StatusNotFound},
+		{"read another server's file", caller{"north-other", "calculator", "north", ownFiles}, http.MethodGet, "/files/n", "", http.StatusForbidden},
+		{"admin reads a file of its tenant", caller{"north-admin", "admin", "north", []string{"*"}}, http.MethodGet, "/files/n", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := testRouter(t, tt.as)
+			rec := serve(e, tt.method, tt.path, tt.body, nil)
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestTenantListings(t *testing.T) {
+	southAdmin := caller{"south-admin", "admin", "south", []string{"*"}}
+	tests := []struct {
+		name string
+		path string
+		want string // Only file in the listing
+	}{
+		{"search", "/files?prefix=/docs/", "s"},
+		{"folder", "/folders?path=/docs", "s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := testRouter(t, southAdmin)
+			rec := serve(e, http.MethodGet, tt.path, "", nil)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var listing struct {
+				Files []*metadata.FileMetadata `json:"files"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+			require.Len(t, listing.Files, 1)
+			assert.Equal(t, tt.want, listing.Files[0].ID)
+		})
+	}
+
+	t.Run("trash", func(t *testing.T) {
+		e, repo := testRouter(t, southAdmin)
+		north := metadata.WithTenant(context.Background(), "north")
+		fileMeta, err := repo.GetFileMetadata(north, "n")
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteFile(north, fileMeta, "north-app"))
+		rec := serve(e, http.MethodGet, "/files/trash", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"files": []}`, rec.Body.String())
+	})
+}
+
+func TestTenantBuckets(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.StorageConfig.Tenants = map[string]config.TenantStorage{"north": {Bucket: "north-files"}}
+	repo, clouds := newStorageRepo(t, cfg)
+	north := metadata.WithTenant(context.Background(), "north")
+	south := metadata.WithTenant(context.Background(), "south")
+
+	// Tenants have their own paths, so both may use the same one
+	northFile := uploadFile(t, north, repo, "/reports/dosage.txt", "text/plain", "north dosage report")
+	southFile := uploadFile(t, south, repo, "/reports/dosage.txt", "text/plain", "south dosage report")
+	assert.Equal(t, "north-files", northFile.CloudCopies["aws"].Bucket)
+	assert.Equal(t, "files", southFile.CloudCopies["aws"].Bucket)
+	content, ok := clouds["aws"].Content("north-files", northFile.CloudCopies["aws"].Name)
+	require.True(t, ok)
+	assert.Equal(t, "north dosage report", string(content))
+
+	_, err := repo.GetFileMetadata(south, northFile.ID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"file-manager/metadata"
+)
+
+// ErrNotInTrash is returned when restoring a file that has not been deleted.
+var ErrNotInTrash = errors.New("file is not in the trash")
+
+// RestoreFile moves a file out of the trash.
+func (s *FileRepo) RestoreFile(ctx context.Context, fileID string) (*metadata.FileMetadata, error) {
+	s.copiesMu.Lock()
+	defer s.copiesMu.Unlock()
+
+	fileMeta, err := s.metadataStore.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !fileMeta.InTrash() {
+		return nil, ErrNotInTrash
+	}
+
+	fileMeta, err = s.metadataStore.UpdateFileMetadata(ctx, fileID, metadata.Patch{Restore: true}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore file: %w", err)
+	}
+	return fileMeta, nil
+}
+
+// PurgeTrash permanently deletes the files that have been in the trash for longer than
+// the configured retention, along with their cloud copies. Files that are still under
+// legal hold or lifecycle retention stay in the trash until a later run.
+func (s *FileRepo) PurgeTrash(ctx context.Context, now time.Time) (int, error) {
+	files, err := s.metadataStore.ListFileMetadata(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, fileMeta := range files {
+		if ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+		if !fileMeta.InTrash() || now.Before(fileMeta.DeletedAt.Add(s.appConfig.Trash.Retention)) {
+			continue
+		}
+		if fileMeta.LegalHold != nil {
+			continue // deleteFile checks again under the lock
+		}
+		if err := s.lifecycle.CheckDelete(fileMeta, now); err != nil {
+			continue
+		}
+		if err := s.deleteFile(ctx, fileMeta); err != nil {
+			log.Printf("Trash: failed to purge file %s: %v", fileMeta.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RunTrashPurger purges the trash every interval until ctx is done.
+func (s *FileRepo) RunTrashPurger(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ctx = metadata.AllTenants(metadata.WithActor(ctx, "system:trash-purger"))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.PurgeTrash(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Trash purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Trash purge: deleted %d files", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	cfg := &config.AppConfig{}
+	cfg.Trash.Retention = time.Hour
+	repo, clouds := newStorageRepo(t, cfg)
+	ctx := metadata.WithTenant(context.Background(), "clinic")
+	file := uploadFile(t, ctx, repo, "/trash/a.bin", "application/octet-stream", "random bytes")
+	e := routerAs(repo, caller{"app", "calculator", "clinic", ownFiles})
+	listed := func(path string) []string {
+		t.Helper()
+		rec := serve(e, http.MethodGet, path, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page metadata.Page
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		ids := []string{}
+		for _, listed := range page.Files {
+			ids = append(ids, listed.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(e, http.MethodDelete, "/files/"+file.ID, "", nil).Code)
+	assert.Empty(t, listed("/files?prefix=/trash/"), "deleted files are not listed")
+	assert.Equal(t, []string{file.ID}, listed("/files/trash"))
+	assert.Equal(t, http.StatusNotFound, serve(e, http.MethodGet, "/files/"+file.ID, "", nil).Code)
+
+	require.Equal(t, http.StatusOK, serve(e, http.MethodPost, "/files/"+file.ID+"/restore", "", nil).Code)
+	assert.Equal(t, http.StatusConflict, serve(e, http.MethodPost, "/files/"+file.ID+"/restore", "", nil).Code, "not in the trash")
+	rec := serve(e, http.MethodGet, "/files/"+file.ID+"/download", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "random bytes", rec.Body.String())
+
+	require.Equal(t, http.StatusNoContent, serve(e, http.MethodDelete, "/files/"+file.ID, "", nil).Code)
+	purged, err := repo.PurgeTrash(ctx, time.Now().Add(cfg.Trash.Retention+time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Empty(t, listed("/files/trash"))
+	assert.Equal(t, http.StatusNotFound, serve(e, http.MethodPost, "/files/"+file.ID+"/restore", "", nil).Code)
+	src := file.CloudCopies["aws"]
+	_, stored := clouds["aws"].Content(src.Bucket, src.Name)
+	assert.False(t, stored, "purged objects are deleted")
+}
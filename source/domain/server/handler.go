@@ -0,0 +1,275 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"file-manager/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ServerHandler struct {
+	registry *auth.Registry
+}
+
+// NewServerHandler creates a new ServerHandler instance.
+func NewServerHandler(registry *auth.Registry) *ServerHandler {
+	return &ServerHandler{registry: registry}
+}
+
+type registerServerRequest struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"` // Optional; the caller's tenant unless it is a platform admin
+	PIN    string `json:"pin"`    // Optional; generated when empty
+}
+
+// credentialsResponse returns a server together with its new PIN. The PIN is only
+// shown in this response and cannot be read back later.
+type credentialsResponse struct {
+	*auth.Server
+	PIN string `json:"pin"`
+}
+
+// ListServers lists the servers of the caller's tenant, or of every tenant for platform
+// admins.
+func (h *ServerHandler) ListServers(c echo.Context) error {
+	servers, err := h.registry.ListServers(c.Request().Context(), registryTenant(c))
+	if err != nil {
+		log.Printf("Error listing servers: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list servers")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"servers": servers})
+}
+
+// RegisterServer registers a new server and returns its PIN. Only platform admins can
+// register servers in other tenants or with a role that administers every tenant.
+func (h *ServerHandler) RegisterServer(c echo.Context) error {
+	var req registerServerRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	ctx := c.Request().Context()
+	if tenant := registryTenant(c); tenant != auth.AllTenants {
+		if tenant == "" || (req.Tenant != "" && req.Tenant != tenant) {
+			return echo.NewHTTPError(http.StatusForbidden, "Servers can only be registered in your own tenant")
+		}
+		req.Tenant = tenant
+		platform, err := h.registry.GrantsPlatform(ctx, req.Role)
+		if err != nil {
+			return registryError(err)
+		}
+		if platform {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Access denied. Requires permission: %s", auth.PermPlatformAdmin))
+		}
+	}
+
+	server, pin, err := h.registry.RegisterServer(ctx, req.ID, req.Role, req.Tenant, req.PIN)
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusCreated, credentialsResponse{Server: server, PIN: pin})
+}
+
+type rotatePINRequest struct {
+	PIN string `json:"pin"` // Optional; generated when empty
+}
+
+// RotatePIN replaces a server's PIN and returns the new one.
+func (h *ServerHandler) RotatePIN(c echo.Context) error {
+	var req rotatePINRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	if err := h.checkTarget(c, c.Param("id")); err != nil {
+		return err
+	}
+
+	server, pin, err := h.registry.RotatePIN(c.Request().Context(), registryTenant(c), c.Param("id"), req.PIN)
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusOK, credentialsResponse{Server: server, PIN: pin})
+}
+
+// DisableServer stops a server from authenticating.
+func (h *ServerHandler) DisableServer(c echo.Context) error {
+	if callerID, _ := auth.GetServerIDFromContext(c); callerID == c.Param("id") {
+		return echo.NewHTTPError(http.StatusBadRequest, "A server cannot disable itself")
+	}
+	return h.setDisabled(c, true)
+}
+
+// EnableServer lets a disabled server authenticate again.
+func (h *ServerHandler) EnableServer(c echo.Context) error {
+	return h.setDisabled(c, false)
+}
+
+func (h *ServerHandler) setDisabled(c echo.Context, disabled bool) error {
+	if err := h.checkTarget(c, c.Param("id")); err != nil {
+		return err
+	}
+	server, err := h.registry.SetDisabled(c.Request().Context(), registryTenant(c), c.Param("id"), disabled)
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusOK, server)
+}
+
+// registryError maps registry errors to HTTP errors.
+func registryError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidServer), errors.Is(err, auth.ErrInvalidAPIKey), errors.Is(err, auth.ErrInvalidRole):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrServerNotFound), errors.Is(err, auth.ErrAPIKeyNotFound), errors.Is(err, auth.ErrRoleNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, auth.ErrServerExists), errors.Is(err, auth.ErrRoleReadOnly), errors.Is(err, auth.ErrRoleInUse):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		log.Printf("Error updating server registry: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update server registry")
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; keys without it do not expire
+}
+
+// apiKeyResponse returns a new API key together with the key itself, which is only
+// shown in this response.
+type apiKeyResponse struct {
+	*auth.APIKey
+	Key string `json:"key"`
+}
+
+// ListAPIKeys lists the API keys of the calling server, or of the server named by the
+// :id path parameter on admin routes.
+func (h *ServerHandler) ListAPIKeys(c echo.Context) error {
+	if err := h.checkTarget(c, keyOwner(c)); err != nil {
+		return err
+	}
+	keys, err := h.registry.ListAPIKeys(c.Request().Context(), registryTenant(c), keyOwner(c))
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// CreateAPIKey issues an API key and returns it once.
+func (h *ServerHandler) CreateAPIKey(c echo.Context) error {
+	var req createAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+	if err := h.checkTarget(c, keyOwner(c)); err != nil {
+		return err
+	}
+
+	key, secret, err := h.registry.CreateAPIKey(c.Request().Context(), registryTenant(c), keyOwner(c), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusCreated, apiKeyResponse{APIKey: key, Key: secret})
+}
+
+// RevokeAPIKey revokes an API key. Requests using it fail from then on.
+func (h *ServerHandler) RevokeAPIKey(c echo.Context) error {
+	if err := h.checkTarget(c, keyOwner(c)); err != nil {
+		return err
+	}
+	key, err := h.registry.RevokeAPIKey(c.Request().Context(), registryTenant(c), keyOwner(c), c.Param("key_id"))
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+type putRoleRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// ListRoles lists the built-in, configured and custom roles.
+func (h *ServerHandler) ListRoles(c echo.Context) error {
+	roles, err := h.registry.ListRoles(c.Request().Context())
+	if err != nil {
+		log.Printf("Error listing roles: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list roles")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"roles": roles, "permissions": auth.Permissions})
+}
+
+// PutRole creates or replaces the custom role named by the :name path parameter. Servers
+// with the role get the new permissions on their next request. Roles are shared by every
+// tenant, so the route also requires the platform permission.
+func (h *ServerHandler) PutRole(c echo.Context) error {
+	var req putRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	role, err := h.registry.PutRole(c.Request().Context(), c.Param("name"), req.Permissions)
+	if err != nil {
+		return registryError(err)
+	}
+	return c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role that no server has.
+func (h *ServerHandler) DeleteRole(c echo.Context) error {
+	if err := h.registry.DeleteRole(c.Request().Context(), c.Param("name")); err != nil {
+		return registryError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkTarget refuses to act on a server whose role grants PermPlatformAdmin unless the
+// caller has it too, so tenant admins cannot take over a platform admin of their tenant
+// by rotating its PIN or issuing it an API key.
+func (h *ServerHandler) checkTarget(c echo.Context, id string) error {
+	tenant := registryTenant(c)
+	if tenant == auth.AllTenants {
+		return nil
+	}
+	ctx := c.Request().Context()
+	server, err := h.registry.GetServer(ctx, tenant, id)
+	if err != nil {
+		return registryError(err)
+	}
+	platform, err := h.registry.GrantsPlatform(ctx, server.Role)
+	if err != nil {
+		return registryError(err)
+	}
+	if platform {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Access denied. Requires permission: %s", auth.PermPlatformAdmin))
+	}
+	return nil
+}
+
+// registryTenant returns the tenant whose servers a request may manage: every tenant for
+// platform admins, the caller's own otherwise.
+func registryTenant(c echo.Context) string {
+	if auth.Authorize(c, auth.PermPlatformAdmin, "") == nil {
+		return auth.AllTenants
+	}
+	tenant, err := auth.GetTenantFromContext(c)
+	if err != nil {
+		return "" // Matches no server
+	}
+	return tenant
+}
+
+// keyOwner returns the server whose API keys a request manages.
+func keyOwner(c echo.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	serverID, _ := auth.GetServerIDFromContext(c)
+	return serverID
+}
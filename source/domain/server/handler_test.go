@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file-manager/auth"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// caller identifies the authenticated server of a test request, as ServerAuthMiddleware
+// would.
+type caller struct {
+	id, role, tenant string
+}
+
+var (
+	northAdmin = caller{"north-admin", "admin", "north"}
+	platform   = caller{"platform", auth.PlatformRole, "ops"}
+	northRoot  = caller{"north-root", auth.PlatformRole, "north"} // A platform admin living in a tenant
+)
+
+func testRouter(t *testing.T, as caller) *echo.Echo {
+	t.Helper()
+	ctx := context.Background()
+	store, err := auth.NewFileServerStore(filepath.Join(t.TempDir(), "servers.json"))
+	require.NoError(t, err)
+	for _, s := range []caller{northAdmin, platform, northRoot, {"north-app", "calculator", "north"}, {"south-app", "calculator", "south"}} {
+		server := &auth.Server{ID: s.id, HashedPIN: "unused", Role: s.role, Tenant: s.tenant, CreatedAt: time.Now()}
+		require.NoError(t, store.CreateServer(ctx, server))
+	}
+	registry := auth.NewRegistry(store)
+	permissions, err := registry.RolePermissions(ctx, as.role)
+	require.NoError(t, err)
+
+	h := NewServerHandler(registry)
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("serverID", as.id)
+			c.Set("serverRole", as.role)
+			c.Set("serverTenant", as.tenant)
+			c.Set("permissions", permissions)
+			return next(c)
+		}
+	})
+	g := e.Group("", auth.RequirePermission(auth.PermServersManage))
+	g.GET("/servers", h.ListServers)
+	g.POST("/servers", h.RegisterServer)
+	g.POST("/servers/:id/rotate", h.RotatePIN)
+	g.POST("/servers/:id/disable", h.DisableServer)
+	g.POST("/servers/:id/enable", h.EnableServer)
+	g.GET("/servers/:id/keys", h.ListAPIKeys)
+	g.POST("/servers/:id/keys", h.CreateAPIKey)
+	g.DELETE("/servers/:id/keys/:key_id", h.RevokeAPIKey)
+
+	roles := auth.RequirePermission(auth.PermRolesManage)
+	platformOnly := auth.RequirePermission(auth.PermPlatformAdmin)
+	e.GET("/roles", h.ListRoles, roles)
+	e.PUT("/roles/:name", h.PutRole, roles, platformOnly)
+	e.DELETE("/roles/:name", h.DeleteRole, roles, platformOnly)
+	return e
+}
+
+func TestServerRegistryTenantIsolation(t *testing.T) {
+	tests := []struct {
+		name       string
+		as         caller
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantTenant string // Of the registered server
+	}{
+		{"register in own tenant", northAdmin, http.MethodPost, "/servers", `{"id": "new-app", "role": "calculator"}`, http.StatusCreated, "north"},
+		{"register in own tenant by name", northAdmin, http.MethodPost, "/servers", `{"id": "new-app", "role": "calculator", "tenant": "north"}`, http.StatusCreated, "north"},
+		{"register in another tenant", northAdmin, http.MethodPost, "/servers", `{"id": "new-app", "role": "calculator", "tenant": "south"}`, http.StatusForbidden, ""},
+		{"register a platform admin", northAdmin, http.MethodPost, "/servers", `{"id": "new-app", "role": "platform-admin"}`, http.StatusForbidden, ""},
+		{"platform registers anywhere", platform, http.MethodPost, "/servers", `{"id": "new-app", "role": "calculator", "tenant": "south"}`, http.StatusCreated, "south"},
+		{"rotate own tenant's server", northAdmin, http.MethodPost, "/servers/north-app/rotate", `{}`, http.StatusOK, ""},
+		{"rotate another tenant's server", northAdmin, http.MethodPost, "/servers/south-app/rotate", `{}`, http.StatusNotFound, ""},
+		{"disable another tenant's server", northAdmin, http.MethodPost, "/servers/south-app/disable", ``, http.StatusNotFound, ""},
+		{"platform disables anywhere", platform, http.MethodPost, "/servers/south-app/disable", ``, http.StatusOK, ""},
+		{"list another tenant's keys", northAdmin, http.MethodGet, "/servers/south-app/keys", ``, http.StatusNotFound, ""},
+		{"create a key for another tenant", northAdmin, http.MethodPost, "/servers/south-app/keys", `{"name": "ci", "scopes": ["files:read"]}`, http.StatusNotFound, ""},
+		{"create a key in own tenant", northAdmin, http.MethodPost, "/servers/north-app/keys", `{"name": "ci", "scopes": ["files:read"]}`, http.StatusCreated, ""},
+		{"rotate a platform admin of own tenant", northAdmin, http.MethodPost, "/servers/north-root/rotate", `{}`, http.StatusForbidden, ""},
+		{"disable a platform admin of own tenant", northAdmin, http.MethodPost, "/servers/north-root/disable", ``, http.StatusForbidden, ""},
+		{"enable a platform admin of own tenant", northAdmin, http.MethodPost, "/servers/north-root/enable", ``, http.StatusForbidden, ""},
+		{"list a platform admin's keys", northAdmin, http.MethodGet, "/servers/north-root/keys", ``, http.StatusForbidden, ""},
+		{"create a key for a platform admin", northAdmin, http.MethodPost, "/servers/north-root/keys", `{"name": "ci", "scopes": ["admin"]}`, http.StatusForbidden, ""},
+		{"revoke a platform admin's key", northAdmin, http.MethodDelete, "/servers/north-root/keys/k1", ``, http.StatusForbidden, ""},
+		{"platform rotates a platform admin", platform, http.MethodPost, "/servers/north-root/rotate", `{}`, http.StatusOK, ""},
+		{"platform creates a key for a platform admin", platform, http.MethodPost, "/servers/north-root/keys", `{"name": "ci", "scopes": ["admin"]}`, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			testRouter(t, tt.as).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantTenant != "" {
+				var server auth.Server
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &server))
+				assert.Equal(t, tt.wantTenant, server.Tenant)
+			}
+		})
+	}
+}
+
+func TestListServersTenantIsolation(t *testing.T) {
+	tests := []struct {
+		as   caller
+		want []string
+	}{
+		{northAdmin, []string{"north-admin", "north-root", "north-app"}},
+		{platform, []string{"north-admin", "platform", "north-root", "north-app", "south-app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.as.id, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			testRouter(t, tt.as).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/servers", nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resp struct {
+				Servers []auth.Server `json:"servers"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			var ids []string
+			for _, server := range resp.Servers {
+				ids = append(ids, server.ID)
+			}
+			assert.ElementsMatch(t, tt.want, ids)
+		})
+	}
+}
+
+func TestRoleRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		as         caller
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"create a role", platform, http.MethodPut, "/roles/auditor", `{"permissions": ["files:read:any"]}`, http.StatusOK},
+		{"unknown permission", platform, http.MethodPut, "/roles/broken", `{"permissions": ["files:read"]}`, http.StatusBadRequest},
+		{"change a built-in role", platform, http.MethodPut, "/roles/admin", `{"permissions": ["files:read:own"]}`, http.StatusConflict},
+		{"delete a role in use", platform, http.MethodDelete, "/roles/calculator", ``, http.StatusConflict},
+		{"delete an undefined role", platform, http.MethodDelete, "/roles/undefined", ``, http.StatusNotFound},
+		{"tenant admin changes a role", northAdmin, http.MethodPut, "/roles/auditor", `{"permissions": ["files:read:any"]}`, http.StatusForbidden},
+		{"tenant admin lists roles", northAdmin, http.MethodGet, "/roles", ``, http.StatusOK},
+		{"register with an undefined role", northAdmin, http.MethodPost, "/servers", `{"id": "it-nobody", "role": "undefined"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			testRouter(t, tt.as).ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
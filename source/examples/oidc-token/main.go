@@ -0,0 +1,135 @@
+// Command oidc-token acts as a minimal OIDC provider for local testing. It keeps ES256
+// signing keys in a directory, publishes their public halves as jwks.json and prints a
+// signed token for the given claims.
+//
+//	go run ./examples/oidc-token -dir /tmp/oidc -sub report-worker -role calculator
+//
+// Point the service at it with OIDC_ISSUER, OIDC_AUDIENCE and
+// OIDC_JWKS_URL=file:///tmp/oidc/jwks.json. -rotate adds a new signing key and keeps
+// the old ones published, as providers do during key rotation.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory holding keys.json (private) and jwks.json (public)")
+	issuer := flag.String("iss", "https://issuer.example.com", "issuer claim")
+	audience := flag.String("aud", "file-manager", "audience claim")
+	subject := flag.String("sub", "", "subject claim, mapped to the server ID")
+	role := flag.String("role", "", "role claim")
+	tenant := flag.String("tenant", "default", "tenant claim; empty to leave it out")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime; negative for an expired token")
+	rotate := flag.Bool("rotate", false, "add a new signing key before signing")
+	flag.Parse()
+
+	keys, err := loadKeys(filepath.Join(*dir, "keys.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *rotate || len(keys.Keys) == 0 {
+		if keys, err = addKey(keys); err != nil {
+			log.Fatal(err)
+		}
+		if err := saveKeys(*dir, keys); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	signingKey := keys.Keys[len(keys.Keys)-1]
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signingKey},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:   *issuer,
+		Subject:  *subject,
+		Audience: jwt.Audience{*audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(*ttl)),
+	}
+	custom := map[string]any{}
+	if *role != "" {
+		custom["role"] = *role
+	}
+	if *tenant != "" {
+		custom["tenant"] = *tenant
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Claims(custom).Serialize()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(token)
+}
+
+func loadKeys(path string) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return keys, err
+	}
+	return keys, json.Unmarshal(data, &keys)
+}
+
+func addKey(keys jose.JSONWebKeySet) (jose.JSONWebKeySet, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return keys, err
+	}
+	keys.Keys = append(keys.Keys, jose.JSONWebKey{
+		Key:       private,
+		KeyID:     strings.ToLower(rand.Text()[:8]),
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	})
+	return keys, nil
+}
+
+// saveKeys writes the private keys and the public JWKS. The JWKS is replaced atomically
+// because the service may read it at any time.
+func saveKeys(dir string, keys jose.JSONWebKeySet) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "keys.json"), data, 0o600); err != nil {
+		return err
+	}
+
+	var public jose.JSONWebKeySet
+	for _, key := range keys.Keys {
+		public.Keys = append(public.Keys, key.Public())
+	}
+	data, err = json.MarshalIndent(public, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "jwks.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "jwks.json"))
+}
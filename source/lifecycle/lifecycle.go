@@ -0,0 +1,145 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"file-manager/compression"
+	"file-manager/config"
+	"file-manager/metadata"
+)
+
+// ErrRetentionActive is returned when a file is deleted before its minimum retention has passed.
+var ErrRetentionActive = errors.New("file is under retention")
+
+const day = 24 * time.Hour
+
+// Policy evaluates the configured lifecycle rules against file metadata.
+type Policy struct {
+	rules []config.LifecycleRule
+}
+
+// NewPolicy validates the lifecycle rules and creates a Policy.
+func NewPolicy(rules []config.LifecycleRule) (*Policy, error) {
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if rule.MinRetentionDays < 0 || rule.ExpireAfterDays < 0 {
+			return nil, fmt.Errorf("lifecycle rule %s: retention and expiry must not be negative", name)
+		}
+		if rule.ExpireAfterDays > 0 && rule.ExpireAfterDays < rule.MinRetentionDays {
+			return nil, fmt.Errorf("lifecycle rule %s: expiry (%d days) is shorter than the minimum retention (%d days)", name, rule.ExpireAfterDays, rule.MinRetentionDays)
+		}
+		for _, t := range rule.Transitions {
+			if t.StorageClass == "" || t.AfterDays < 0 {
+				return nil, fmt.Errorf("lifecycle rule %s: transitions need a storage class and a non-negative age", name)
+			}
+		}
+	}
+
+	// Evaluate transitions in order of age so the latest due one wins
+	sorted := slices.Clone(rules)
+	for i := range sorted {
+		sorted[i].Transitions = slices.Clone(sorted[i].Transitions)
+		slices.SortStableFunc(sorted[i].Transitions, func(a, b config.LifecycleTransition) int {
+			return a.AfterDays - b.AfterDays
+		})
+	}
+	return &Policy{rules: sorted}, nil
+}
+
+// Empty reports whether the policy has no rules.
+func (p *Policy) Empty() bool {
+	return len(p.rules) == 0
+}
+
+// Match returns the first rule that applies to a file, or nil.
+func (p *Policy) Match(meta *metadata.FileMetadata) *config.LifecycleRule {
+	for i := range p.rules {
+		if ruleMatches(p.rules[i], meta) {
+			return &p.rules[i]
+		}
+	}
+	return nil
+}
+
+// RetainUntil returns the time before which a file may not be deleted, or the zero time
+// when no retention applies.
+func (p *Policy) RetainUntil(meta *metadata.FileMetadata) time.Time {
+	rule := p.Match(meta)
+	if rule == nil || rule.MinRetentionDays == 0 {
+		return time.Time{}
+	}
+	return meta.UploadedAt.Add(time.Duration(rule.MinRetentionDays) * day)
+}
+
+// CheckDelete returns ErrRetentionActive when the file is still under retention at now.
+func (p *Policy) CheckDelete(meta *metadata.FileMetadata, now time.Time) error {
+	if until := p.RetainUntil(meta); now.Before(until) {
+		return fmt.Errorf("%w until %s", ErrRetentionActive, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckChange returns ErrRetentionActive when changing a file from before to after, such
+// as a new path, type or tags, would end or shorten a retention still running at now.
+// Otherwise retention could be escaped by moving a file out of its rule and deleting it.
+func (p *Policy) CheckChange(before, after *metadata.FileMetadata, now time.Time) error {
+	until := p.RetainUntil(before)
+	if !now.Before(until) {
+		return nil
+	}
+	if p.RetainUntil(after).Before(until) {
+		return fmt.Errorf("%w until %s and the change would lift it", ErrRetentionActive, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Expired reports whether a file has reached the expiry age of its rule.
+func (p *Policy) Expired(meta *metadata.FileMetadata, now time.Time) bool {
+	rule := p.Match(meta)
+	if rule == nil || rule.ExpireAfterDays == 0 {
+		return false
+	}
+	return !now.Before(meta.UploadedAt.Add(time.Duration(rule.ExpireAfterDays) * day))
+}
+
+// StorageClassFor returns the storage class a file's copy on the given provider should
+// be in at now, or "" when no transition is due.
+func (p *Policy) StorageClassFor(meta *metadata.FileMetadata, provider string, now time.Time) string {
+	rule := p.Match(meta)
+	if rule == nil {
+		return ""
+	}
+	storageClass := ""
+	for _, t := range rule.Transitions {
+		if t.Provider != "" && t.Provider != provider {
+			continue
+		}
+		if now.Before(meta.UploadedAt.Add(time.Duration(t.AfterDays) * day)) {
+			break
+		}
+		storageClass = t.StorageClass
+	}
+	return storageClass
+}
+
+func ruleMatches(rule config.LifecycleRule, meta *metadata.FileMetadata) bool {
+	if rule.PathPrefix != "" && !strings.HasPrefix(meta.LogicalPath, rule.PathPrefix) {
+		return false
+	}
+	if rule.ContentType != "" && !compression.MatchContentType([]string{rule.ContentType}, meta.ContentType) {
+		return false
+	}
+	for k, v := range rule.Tags {
+		if meta.CustomTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
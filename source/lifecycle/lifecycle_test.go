@@ -0,0 +1,105 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"file-manager/config"
+	"file-manager/metadata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := NewPolicy([]config.LifecycleRule{
+		{Name: "records", PathPrefix: "/records/", MinRetentionDays: 30},
+		{Name: "legal", Tags: map[string]string{"class": "legal"}, MinRetentionDays: 365},
+		{Name: "scratch", PathPrefix: "/tmp/", ExpireAfterDays: 7},
+	})
+	require.NoError(t, err)
+	return policy
+}
+
+func TestCheckDelete(t *testing.T) {
+	policy := testPolicy(t)
+	uploaded := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		path    string
+		tags    map[string]string
+		age     time.Duration
+		blocked bool
+	}{
+		{"retained file", "/records/a.pdf", nil, 10 * day, true},
+		{"retention passed", "/records/a.pdf", nil, 30 * day, false},
+		{"no rule", "/other/a.pdf", nil, time.Hour, false},
+		{"rule without retention", "/tmp/a.pdf", nil, time.Hour, false},
+		{"retained by tags", "/other/a.pdf", map[string]string{"class": "legal"}, 100 * day, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := &metadata.FileMetadata{LogicalPath: tt.path, CustomTags: tt.tags, UploadedAt: uploaded}
+			err := policy.CheckDelete(meta, uploaded.Add(tt.age))
+			if tt.blocked {
+				assert.ErrorIs(t, err, ErrRetentionActive)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckChange(t *testing.T) {
+	policy := testPolicy(t)
+	uploaded := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	legal := map[string]string{"class": "legal"}
+	tests := []struct {
+		name       string
+		beforePath string
+		beforeTags map[string]string
+		afterPath  string
+		afterTags  map[string]string
+		age        time.Duration
+		blocked    bool
+	}{
+		{"move out of retention", "/records/a.pdf", nil, "/other/a.pdf", nil, day, true},
+		{"move within the rule", "/records/a.pdf", nil, "/records/2025/a.pdf", nil, day, false},
+		{"move after retention", "/records/a.pdf", nil, "/other/a.pdf", nil, 31 * day, false},
+		{"drop the retaining tag", "/other/a.pdf", legal, "/other/a.pdf", nil, day, true},
+		{"shorten to a weaker rule", "/other/a.pdf", legal, "/records/a.pdf", nil, day, true},
+		{"lengthen retention", "/records/a.pdf", nil, "/records/a.pdf", legal, day, false},
+		{"move into retention", "/other/a.pdf", nil, "/records/a.pdf", nil, day, false},
+		{"unretained file", "/tmp/a.pdf", nil, "/other/a.pdf", nil, day, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := &metadata.FileMetadata{LogicalPath: tt.beforePath, CustomTags: tt.beforeTags, UploadedAt: uploaded}
+			after := &metadata.FileMetadata{LogicalPath: tt.afterPath, CustomTags: tt.afterTags, UploadedAt: uploaded}
+			err := policy.CheckChange(before, after, uploaded.Add(tt.age))
+			if tt.blocked {
+				assert.ErrorIs(t, err, ErrRetentionActive)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewPolicyRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.LifecycleRule
+	}{
+		{"negative retention", config.LifecycleRule{MinRetentionDays: -1}},
+		{"expiry before retention", config.LifecycleRule{MinRetentionDays: 30, ExpireAfterDays: 10}},
+		{"transition without class", config.LifecycleRule{Transitions: []config.LifecycleTransition{{AfterDays: 1}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicy([]config.LifecycleRule{tt.rule})
+			assert.Error(t, err)
+		})
+	}
+}
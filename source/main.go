@@ -19,6 +19,6 @@ func main() {
 
 	err := app.Start(ctx)
 	if err != nil {
-		logger.Error("Failed to start app", err.Error())
+		logger.Error("Failed to start app", "error", err.Error())
 	}
 }
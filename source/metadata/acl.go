@@ -0,0 +1,128 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidACL is returned for ACL entries without a principal or with unknown access.
+var ErrInvalidACL = errors.New("invalid access control list")
+
+// Access levels an ACL entry can grant.
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessDelete = "delete"
+)
+
+// accessLevels lists every valid access level.
+var accessLevels = []string{AccessRead, AccessWrite, AccessDelete}
+
+// ACLEntry grants access to a server, or to every server with a role.
+type ACLEntry struct {
+	Server string   `json:"server,omitempty"` // Server ID
+	Role   string   `json:"role,omitempty"`
+	Access []string `json:"access"` // AccessRead, AccessWrite and/or AccessDelete
+
+	// GrantedBy is set by the service on folder entries granted by a server limited to its
+	// own files. Such entries only cover files uploaded by that server, so they cannot
+	// share files other servers put into the folder later.
+	GrantedBy string `json:"granted_by,omitempty"`
+}
+
+// ACL is a list of entries. Entries only add access: a principal has an access level if
+// any entry grants it.
+type ACL []ACLEntry
+
+// Principal is who an ACL is checked for.
+type Principal struct {
+	ServerID string
+	Role     string
+}
+
+// Validate checks every entry and sorts their access levels.
+func (a ACL) Validate() error {
+	for i := range a {
+		entry := &a[i]
+		if (entry.Server == "") == (entry.Role == "") {
+			return fmt.Errorf("%w: entry %d must name either a server or a role", ErrInvalidACL, i)
+		}
+		if len(entry.Access) == 0 {
+			return fmt.Errorf("%w: entry %d grants no access", ErrInvalidACL, i)
+		}
+		for _, access := range entry.Access {
+			if !slices.Contains(accessLevels, access) {
+				return fmt.Errorf("%w: unknown access %q (%s)", ErrInvalidACL, access, strings.Join(accessLevels, ", "))
+			}
+		}
+		entry.Access = slices.Compact(slices.Sorted(slices.Values(entry.Access)))
+	}
+	return nil
+}
+
+// Grants reports whether any entry grants access to the principal.
+func (a ACL) Grants(p Principal, access string) bool {
+	for _, entry := range a {
+		if (entry.Server != "" && entry.Server == p.ServerID) || (entry.Role != "" && entry.Role == p.Role) {
+			if slices.Contains(entry.Access, access) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of the ACL.
+func (a ACL) Clone() ACL {
+	if a == nil {
+		return nil
+	}
+	copied := make(ACL, len(a))
+	for i, entry := range a {
+		entry.Access = slices.Clone(entry.Access)
+		copied[i] = entry
+	}
+	return copied
+}
+
+// GrantedBy returns a copy of the ACL with every entry marked as granted by server, or
+// with the marks removed for "".
+func (a ACL) GrantedBy(server string) ACL {
+	marked := a.Clone()
+	for i := range marked {
+		marked[i].GrantedBy = server
+	}
+	return marked
+}
+
+// ApplicableACL returns the inherited entries that cover a file: those not granted by a
+// server other than its uploader.
+func ApplicableACL(inherited ACL, meta *FileMetadata) ACL {
+	var acl ACL
+	for _, entry := range inherited {
+		if entry.GrantedBy == "" || entry.GrantedBy == meta.UploadedBy {
+			acl = append(acl, entry)
+		}
+	}
+	return acl
+}
+
+// EffectiveACL returns the ACL that applies to a file: the applicable entries of every
+// folder above it, from the root down, followed by the file's own.
+func EffectiveACL(inherited ACL, meta *FileMetadata) ACL {
+	return append(ApplicableACL(inherited, meta), meta.ACL...)
+}
+
+// ancestors returns the folders above a logical path, from the root down, e.g. "/",
+// "/a/" and "/a/b/" for "/a/b/c.pdf". Folder paths include themselves.
+func ancestors(logicalPath string) []string {
+	folders := []string{"/"}
+	for i := 1; i < len(logicalPath); i++ {
+		if logicalPath[i] == '/' {
+			folders = append(folders, logicalPath[:i+1])
+		}
+	}
+	return folders
+}
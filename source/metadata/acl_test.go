@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACLValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		acl   ACL
+		valid bool
+	}{
+		{"server entry", ACL{{Server: "a", Access: []string{AccessRead}}}, true},
+		{"role entry", ACL{{Role: "analytics", Access: []string{AccessWrite, AccessRead}}}, true},
+		{"no principal", ACL{{Access: []string{AccessRead}}}, false},
+		{"server and role", ACL{{Server: "a", Role: "analytics", Access: []string{AccessRead}}}, false},
+		{"no access", ACL{{Server: "a"}}, false},
+		{"unknown access", ACL{{Server: "a", Access: []string{"admin"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.acl.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidACL)
+			}
+		})
+	}
+}
+
+func TestACLInheritance(t *testing.T) {
+	ctx := WithTenant(context.Background(), "clinic")
+	store := NewInMemoryMetadataStore()
+	files := []*FileMetadata{
+		{ID: "own", LogicalPath: "/reports/dosage/a.pdf", UploadedBy: "owner", Tenant: "clinic"},
+		{ID: "other", LogicalPath: "/reports/dosage/b.pdf", UploadedBy: "intruder", Tenant: "clinic"},
+		{ID: "outside", LogicalPath: "/private/c.pdf", UploadedBy: "owner", Tenant: "clinic"},
+		{ID: "shared", LogicalPath: "/reports/dosage/d.pdf", UploadedBy: "owner", Tenant: "clinic",
+			ACL: ACL{{Server: "auditor", Access: []string{AccessRead}}}},
+	}
+	for _, meta := range files {
+		require.NoError(t, store.CreateFileMetadata(ctx, meta))
+	}
+	// An open grant on a parent folder and one limited to the files of its granter
+	require.NoError(t, store.SetFolderACL(ctx, "/reports/", ACL{{Role: "analytics", Access: []string{AccessRead}}}))
+	require.NoError(t, store.SetFolderACL(ctx, "/reports/dosage/",
+		ACL{{Server: "billing", Access: []string{AccessRead, AccessWrite}}}.GrantedBy("owner")))
+
+	tests := []struct {
+		name      string
+		fileID    string
+		principal Principal
+		access    string
+		want      bool
+	}{
+		{"grant from a parent folder", "own", Principal{ServerID: "x", Role: "analytics"}, AccessRead, true},
+		{"grant from the enclosing folder", "own", Principal{ServerID: "billing"}, AccessWrite, true},
+		{"access not granted", "own", Principal{ServerID: "billing"}, AccessDelete, false},
+		{"granter's entry skips other uploaders", "other", Principal{ServerID: "billing"}, AccessRead, false},
+		{"open entry covers other uploaders", "other", Principal{ServerID: "x", Role: "analytics"}, AccessRead, true},
+		{"no grant outside the folder", "outside", Principal{ServerID: "billing"}, AccessRead, false},
+		{"file's own entry", "shared", Principal{ServerID: "auditor"}, AccessRead, true},
+		{"own entry of another file", "own", Principal{ServerID: "auditor"}, AccessRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := store.GetFileMetadata(ctx, tt.fileID)
+			require.NoError(t, err)
+			inherited, err := store.InheritedACL(ctx, meta.LogicalPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, EffectiveACL(inherited, meta).Grants(tt.principal, tt.access))
+		})
+	}
+
+	t.Run("shared files are found by queries", func(t *testing.T) {
+		page, err := store.QueryFileMetadata(ctx, Query{UploadedBy: "billing", SharedWith: &Principal{ServerID: "billing"}})
+		require.NoError(t, err)
+		var ids []string
+		for _, meta := range page.Files {
+			ids = append(ids, meta.ID)
+		}
+		assert.ElementsMatch(t, []string{"own", "shared"}, ids)
+	})
+}
@@ -0,0 +1,48 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrFolderExists is returned when creating a folder that already exists.
+	ErrFolderExists = errors.New("folder already exists")
+	// ErrPathExists is returned when a move would overwrite another file's logical path.
+	ErrPathExists = errors.New("logical path already exists")
+)
+
+// FolderListing is the content of a virtual folder.
+type FolderListing struct {
+	Path    string          `json:"path"`
+	Folders []string        `json:"folders"` // Full paths of the immediate subfolders, ending in "/"
+	Files   []*FileMetadata `json:"files"`   // Files directly in the folder
+}
+
+// NormalizeFolder cleans a folder path into the "/a/b/" form used for folder prefixes.
+// The root folder is "/".
+func NormalizeFolder(folder string) (string, error) {
+	if !strings.HasPrefix(folder, "/") {
+		return "", fmt.Errorf("folder path %q must start with /", folder)
+	}
+	cleaned := path.Clean(folder)
+	if cleaned == "/" {
+		return "/", nil
+	}
+	return cleaned + "/", nil
+}
+
+// childOf reports whether logicalPath lies under folder and returns the immediate child
+// on the way to it: the file path itself, or the full path of a subfolder.
+func childOf(folder, logicalPath string) (child string, isFolder bool, ok bool) {
+	rest, ok := strings.CutPrefix(logicalPath, folder)
+	if !ok || rest == "" {
+		return "", false, false
+	}
+	if name, _, found := strings.Cut(rest, "/"); found {
+		return folder + name + "/", true, true
+	}
+	return logicalPath, false, true
+}
@@ -0,0 +1,262 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Change actions recorded in the history.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// SystemActor is recorded for changes made without an actor in the context, such as
+// those of background jobs that do not name themselves.
+const SystemActor = "system"
+
+// Change is an immutable record of one change to a file's metadata.
+type Change struct {
+	Seq      int64                  `json:"seq"` // Position in the history, increasing across all files
+	FileID   string                 `json:"file_id"`
+	Tenant   string                 `json:"-"` // Tenant of the file, which alone may read the change
+	Action   string                 `json:"action"`
+	Actor    string                 `json:"actor"` // Server ID, or "system:<job>" for background jobs
+	At       time.Time              `json:"at"`
+	Revision int64                  `json:"revision,omitempty"` // Revision after the change; 0 for deletions
+	Diff     map[string]FieldChange `json:"diff"`               // Changed fields by JSON name
+}
+
+// FieldChange holds the JSON values of a field before and after a change. Before is
+// omitted for fields that were unset and After for fields that were removed.
+type FieldChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// HistoryStore keeps the append-only change history of file metadata. Like MetadataStore,
+// it only lists the changes of the tenant of the context.
+type HistoryStore interface {
+	AppendChange(ctx context.Context, change Change) error
+	ListChanges(ctx context.Context, fileID string) ([]Change, error) // Oldest first, never nil
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose metadata changes are attributed to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of a context, or SystemActor when none is set.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// InMemoryHistoryStore is a simple in-memory implementation of HistoryStore.
+// NOT FOR PRODUCTION USE.
+type InMemoryHistoryStore struct {
+	mu      sync.RWMutex
+	seq     int64
+	changes map[string][]Change // map[fileID][]Change
+}
+
+// NewInMemoryHistoryStore creates a new InMemoryHistoryStore.
+func NewInMemoryHistoryStore() *InMemoryHistoryStore {
+	return &InMemoryHistoryStore{changes: make(map[string][]Change)}
+}
+
+// AppendChange records a change and assigns its sequence number.
+func (h *InMemoryHistoryStore) AppendChange(ctx context.Context, change Change) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	change.Seq = h.seq
+	h.changes[change.FileID] = append(h.changes[change.FileID], change)
+	return nil
+}
+
+// ListChanges returns the history of a file, including files that have been deleted.
+func (h *InMemoryHistoryStore) ListChanges(ctx context.Context, fileID string) ([]Change, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	changes := []Change{}
+	for _, change := range h.changes[fileID] {
+		ok, err := visible(ctx, change.Tenant)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// AuditedStore wraps a MetadataStore and records every create, update and delete in a
+// HistoryStore. Writes are serialized so each record sees the exact state before it.
+// A change that cannot be recorded is reported as an error, but the change itself has
+// already been made.
+type AuditedStore struct {
+	MetadataStore
+	history HistoryStore
+	mu      sync.Mutex
+}
+
+// NewAuditedStore creates an AuditedStore around store.
+func NewAuditedStore(store MetadataStore, history HistoryStore) *AuditedStore {
+	return &AuditedStore{MetadataStore: store, history: history}
+}
+
+// CreateFileMetadata creates the metadata and records it as the first change.
+func (a *AuditedStore) CreateFileMetadata(ctx context.Context, meta *FileMetadata) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.MetadataStore.CreateFileMetadata(ctx, meta); err != nil {
+		return err
+	}
+	return a.record(ctx, ChangeCreated, meta.ID, nil, meta)
+}
+
+// UpdateFileMetadata applies the patch and records the fields it changed.
+func (a *AuditedStore) UpdateFileMetadata(ctx context.Context, id string, patch Patch, ifRevision int64) (*FileMetadata, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	before, err := a.snapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := a.MetadataStore.UpdateFileMetadata(ctx, id, patch, ifRevision)
+	if err != nil {
+		return nil, err
+	}
+	return updated, a.record(ctx, ChangeUpdated, id, before, updated)
+}
+
+// DeleteFileMetadata deletes the metadata and records its last state.
+func (a *AuditedStore) DeleteFileMetadata(ctx context.Context, id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	before, err := a.snapshot(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := a.MetadataStore.DeleteFileMetadata(ctx, id); err != nil {
+		return err
+	}
+	return a.record(ctx, ChangeDeleted, id, before, nil)
+}
+
+// MoveFolder moves the folder and records the new path of every moved file.
+func (a *AuditedStore) MoveFolder(ctx context.Context, from, to string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	files, err := a.MetadataStore.ListFileMetadata(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+	before := make([]*FileMetadata, len(files))
+	for i, meta := range files {
+		before[i] = meta.Clone()
+	}
+
+	moved, err := a.MetadataStore.MoveFolder(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	for _, prev := range before {
+		after, err := a.MetadataStore.GetFileMetadata(ctx, prev.ID)
+		if err != nil {
+			return moved, err
+		}
+		if err := a.record(ctx, ChangeUpdated, prev.ID, prev, after); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// snapshot returns a deep copy of the current metadata, which the wrapped store may
+// change in place, maps and slices included.
+func (a *AuditedStore) snapshot(ctx context.Context, id string) (*FileMetadata, error) {
+	meta, err := a.MetadataStore.GetFileMetadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Clone(), nil
+}
+
+func (a *AuditedStore) record(ctx context.Context, action, id string, before, after *FileMetadata) error {
+	diff, err := diffMetadata(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to record metadata change of %s: %w", id, err)
+	}
+	change := Change{FileID: id, Action: action, Actor: ActorFrom(ctx), At: time.Now(), Diff: diff}
+	if after != nil {
+		change.Revision = after.Revision
+		change.Tenant = after.Tenant
+	} else {
+		change.Tenant = before.Tenant
+	}
+	if err := a.history.AppendChange(ctx, change); err != nil {
+		return fmt.Errorf("failed to record metadata change of %s: %w", id, err)
+	}
+	return nil
+}
+
+// diffMetadata compares the JSON fields of two metadata states, either of which may be
+// nil. The revision is recorded on the change itself and left out of the diff.
+func diffMetadata(before, after *FileMetadata) (map[string]FieldChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshaled JSON has a stable field and map key order, so equal values are equal bytes
+	diff := make(map[string]FieldChange)
+	for name, b := range beforeFields {
+		if a := afterFields[name]; !bytes.Equal(b, a) {
+			diff[name] = FieldChange{Before: b, After: a}
+		}
+	}
+	for name, a := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			diff[name] = FieldChange{After: a}
+		}
+	}
+	delete(diff, "revision")
+	return diff, nil
+}
+
+func jsonFields(meta *FileMetadata) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if meta == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,40 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCopiesMetadata(t *testing.T) {
+	ctx := WithTenant(context.Background(), "clinic")
+	history := NewInMemoryHistoryStore()
+	store := NewAuditedStore(NewInMemoryMetadataStore(), history)
+	created := &FileMetadata{
+		ID: "f", LogicalPath: "/docs/a.pdf", Tenant: "clinic",
+		CustomTags: map[string]string{"a": "1"},
+		ACL:        ACL{{Server: "b", Access: []string{AccessRead}}},
+	}
+	require.NoError(t, store.CreateFileMetadata(ctx, created))
+	created.CustomTags["a"] = "changed"
+	created.ACL[0].Access[0] = AccessDelete
+
+	got, err := store.GetFileMetadata(ctx, "f")
+	require.NoError(t, err)
+	assert.Equal(t, "1", got.CustomTags["a"])
+	assert.Equal(t, AccessRead, got.ACL[0].Access[0])
+
+	got.CustomTags["a"] = "changed"
+	again, err := store.GetFileMetadata(ctx, "f")
+	require.NoError(t, err)
+	assert.Equal(t, "1", again.CustomTags["a"], "callers cannot change the stored metadata")
+
+	_, err = store.UpdateFileMetadata(ctx, "f", Patch{CustomTags: map[string]*string{"b": nil}, ClearTags: true}, 0)
+	require.NoError(t, err)
+	changes, err := history.ListChanges(ctx, "f")
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.JSONEq(t, `{"a": "1"}`, string(changes[1].Diff["custom_tags"].Before))
+}
@@ -1,9 +1,13 @@
 package metadata
 
 import (
+	"cmp"
 	"context"
 	"file-manager/storage"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,140 +15,353 @@ import (
 // FileMetadata represents the logical metadata for a file in our system.
 // This is distinct from cloud-specific FileInfo, though it contains it.
 type FileMetadata struct {
-	ID          string                       `json:"id"`
-	LogicalPath string                       `json:"logical_path"` // e.g., /users/john/documents/report.pdf
-	FileName    string                       `json:"file_name"`
-	Size        int64                        `json:"size"`
-	ContentType string                       `json:"content_type"`
-	UploadedAt  time.Time                    `json:"uploaded_at"`
-	UploadedBy  string                       `json:"uploaded_by"`  // Server ID
-	CloudCopies map[string]*storage.FileInfo `json:"cloud_copies"` // Map of cloud_provider -> FileInfo
-	CustomTags  map[string]string            `json:"custom_tags,omitempty"`
-}
-
-// MetadataStore defines the interface for metadata operations.
+	ID              string                       `json:"id"`
+	LogicalPath     string                       `json:"logical_path"` // e.g., /users/john/documents/report.pdf
+	FileName        string                       `json:"file_name"`
+	Size            int64                        `json:"size"`
+	ContentType     string                       `json:"content_type"`
+	ContentEncoding string                       `json:"content_encoding,omitempty"` // Compression of the stored bytes, e.g. "gzip"
+	StoredSize      int64                        `json:"stored_size,omitempty"`      // Size of the stored (compressed) bytes
+	UploadedAt      time.Time                    `json:"uploaded_at"`
+	UploadedBy      string                       `json:"uploaded_by"`      // Server ID
+	Tenant          string                       `json:"tenant,omitempty"` // Tenant of the uploading server
+	CloudCopies     map[string]*storage.FileInfo `json:"cloud_copies"`     // Map of cloud_provider -> FileInfo
+	CustomTags      map[string]string            `json:"custom_tags,omitempty"`
+	ACL             ACL                          `json:"acl,omitempty"`        // Access for other servers, besides that of enclosing folders
+	LegalHold       *LegalHold                   `json:"legal_hold,omitempty"` // Set while the file is frozen
+	DeletedAt       *time.Time                   `json:"deleted_at,omitempty"` // Set while the file is in the trash
+	DeletedBy       string                       `json:"deleted_by,omitempty"` // Server ID that moved the file to the trash
+	Revision        int64                        `json:"revision"`             // Incremented by every update, starting at 1
+}
+
+// Clone returns a deep copy of the metadata, sharing nothing with it.
+func (m *FileMetadata) Clone() *FileMetadata {
+	copied := *m
+	if m.CloudCopies != nil {
+		copied.CloudCopies = make(map[string]*storage.FileInfo, len(m.CloudCopies))
+		for provider, info := range m.CloudCopies {
+			if info != nil {
+				infoCopy := *info
+				infoCopy.CustomMetadata = maps.Clone(info.CustomMetadata)
+				info = &infoCopy
+			}
+			copied.CloudCopies[provider] = info
+		}
+	}
+	copied.CustomTags = maps.Clone(m.CustomTags)
+	copied.ACL = m.ACL.Clone()
+	if m.LegalHold != nil {
+		hold := *m.LegalHold
+		copied.LegalHold = &hold
+	}
+	if m.DeletedAt != nil {
+		deletedAt := *m.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	return &copied
+}
+
+// InTrash reports whether the file has been soft deleted.
+func (m *FileMetadata) InTrash() bool {
+	return m.DeletedAt != nil
+}
+
+// LegalHold freezes a file for litigation or audits: while it is set the file cannot be
+// deleted, moved or modified by anyone, including admin servers.
+type LegalHold struct {
+	Reason string    `json:"reason"`
+	SetBy  string    `json:"set_by"` // Server ID that placed the hold
+	SetAt  time.Time `json:"set_at"`
+}
+
+// Usage is the storage consumed by a server or tenant. Bytes count the stored (possibly
+// compressed) size of each file once, whatever its number of cloud copies. Files in the
+// trash count until they are purged.
+type Usage struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// usageOf returns the usage a single file contributes.
+func usageOf(meta *FileMetadata) Usage {
+	size := meta.StoredSize
+	if size == 0 {
+		size = meta.Size
+	}
+	return Usage{Files: 1, Bytes: size}
+}
+
+// MetadataStore defines the interface for metadata operations. Every call is limited to
+// the tenant of its context (see WithTenant): files of other tenants are not found, and
+// logical paths, folders and ACLs are separate per tenant. Contexts without a tenant get
+// ErrNoTenant.
 type MetadataStore interface {
 	CreateFileMetadata(ctx context.Context, meta *FileMetadata) error
 	GetFileMetadata(ctx context.Context, id string) (*FileMetadata, error)
 	GetFileMetadataByPath(ctx context.Context, logicalPath string) (*FileMetadata, error)
 	ListFileMetadata(ctx context.Context, prefix string) ([]*FileMetadata, error)
-	UpdateFileMetadata(ctx context.Context, id string, updates map[string]interface{}) error
+	QueryFileMetadata(ctx context.Context, q Query) (*Page, error)
+	UpdateFileMetadata(ctx context.Context, id string, patch Patch, ifRevision int64) (*FileMetadata, error)
 	DeleteFileMetadata(ctx context.Context, id string) error
+	CreateFolder(ctx context.Context, path string) error
+	ListFolder(ctx context.Context, path string) (*FolderListing, error)
+	MoveFolder(ctx context.Context, from, to string) (int, error)
+	DeleteFolder(ctx context.Context, path string) error
+	GetFolderACL(ctx context.Context, path string) (ACL, error)        // The folder's own entries
+	SetFolderACL(ctx context.Context, path string, acl ACL) error      // An empty ACL removes the entries
+	InheritedACL(ctx context.Context, logicalPath string) (ACL, error) // Entries of every folder above a path
+	GetServerUsage(ctx context.Context, serverID string) (Usage, error)
+	GetTenantUsage(ctx context.Context, tenant string) (Usage, error)
 }
 
-// InMemoryMetadataStore is a simple in-memory implementation of MetadataStore.
+// InMemoryMetadataStore is a simple in-memory implementation of MetadataStore. Each
+// tenant's files, folders and ACLs are kept in a partition of their own, and calls only
+// reach the partitions their context may see (see WithTenant).
 // NOT FOR PRODUCTION USE.
 type InMemoryMetadataStore struct {
-	mu        sync.RWMutex
+	mu      sync.RWMutex
+	tenants map[string]*tenantFiles // map[tenant]*tenantFiles
+}
+
+// tenantFiles is the metadata of one tenant.
+type tenantFiles struct {
 	store     map[string]*FileMetadata // map[id]*FileMetadata
 	pathIndex map[string]string        // map[logicalPath]id
+	folders   map[string]bool          // Explicitly created folders, e.g. "/patients/123/"
+	acls      map[string]ACL           // map[folder]ACL
+	byServer  map[string]Usage         // map[serverID]Usage
+	usage     Usage
 }
 
-// NewInMemoryMetadataStore creates a new InMemoryMetadataStore.
-func NewInMemoryMetadataStore() *InMemoryMetadataStore {
-	return &InMemoryMetadataStore{
+func newTenantFiles() *tenantFiles {
+	return &tenantFiles{
 		store:     make(map[string]*FileMetadata),
 		pathIndex: make(map[string]string),
+		folders:   make(map[string]bool),
+		acls:      make(map[string]ACL),
+		byServer:  make(map[string]Usage),
 	}
 }
 
-// CreateFileMetadata adds new file metadata.
+// NewInMemoryMetadataStore creates a new InMemoryMetadataStore.
+func NewInMemoryMetadataStore() *InMemoryMetadataStore {
+	return &InMemoryMetadataStore{tenants: make(map[string]*tenantFiles)}
+}
+
+// visibleTenants returns the partitions a context may see. Callers must hold m.mu.
+func (m *InMemoryMetadataStore) visibleTenants(ctx context.Context) ([]*tenantFiles, error) {
+	tenant, all, err := TenantFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return slices.Collect(maps.Values(m.tenants)), nil
+	}
+	if t, ok := m.tenants[tenant]; ok {
+		return []*tenantFiles{t}, nil
+	}
+	return nil, nil
+}
+
+// tenantOf returns the partition of a context's single tenant. Missing partitions are
+// created when create is set and returned empty otherwise. Callers must hold m.mu, for
+// writing when create is set.
+func (m *InMemoryMetadataStore) tenantOf(ctx context.Context, create bool) (*tenantFiles, error) {
+	tenant, err := SingleTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := m.tenants[tenant]
+	if !ok {
+		t = newTenantFiles()
+		if create {
+			m.tenants[tenant] = t
+		}
+	}
+	return t, nil
+}
+
+// findFile returns a file a context may see along with its partition. Callers must hold
+// m.mu.
+func (m *InMemoryMetadataStore) findFile(ctx context.Context, id string) (*tenantFiles, *FileMetadata, error) {
+	tenants, err := m.visibleTenants(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range tenants {
+		if meta, ok := t.store[id]; ok {
+			return t, meta, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("file metadata with ID %s not found", id)
+}
+
+// CreateFileMetadata adds new file metadata to the partition of its tenant, which must be
+// that of the context unless it spans all tenants.
 func (m *InMemoryMetadataStore) CreateFileMetadata(ctx context.Context, meta *FileMetadata) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.store[meta.ID]; exists {
-		return fmt.Errorf("file metadata with ID %s already exists", meta.ID)
+	if meta.Tenant == "" {
+		return fmt.Errorf("%w: file %s has none", ErrNoTenant, meta.ID)
 	}
-	if _, exists := m.pathIndex[meta.LogicalPath]; exists {
+	ok, err := visible(ctx, meta.Tenant)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: file %s is of tenant %q", ErrCrossTenant, meta.ID, meta.Tenant)
+	}
+	for _, t := range m.tenants {
+		if _, exists := t.store[meta.ID]; exists {
+			return fmt.Errorf("file metadata with ID %s already exists", meta.ID)
+		}
+	}
+	t, ok := m.tenants[meta.Tenant]
+	if !ok {
+		t = newTenantFiles()
+		m.tenants[meta.Tenant] = t
+	}
+	if _, exists := t.pathIndex[meta.LogicalPath]; exists {
 		return fmt.Errorf("file metadata with path %s already exists", meta.LogicalPath)
 	}
 
-	m.store[meta.ID] = meta
-	m.pathIndex[meta.LogicalPath] = meta.ID
+	meta.Revision = 1
+	meta = meta.Clone() // The caller keeps its own copy
+	t.store[meta.ID] = meta
+	t.pathIndex[meta.LogicalPath] = meta.ID
+	t.addUsage(meta, 1)
 	return nil
 }
 
-// GetFileMetadata retrieves file metadata by ID.
+// GetFileMetadata retrieves a copy of file metadata by ID.
 func (m *InMemoryMetadataStore) GetFileMetadata(ctx context.Context, id string) (*FileMetadata, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	meta, ok := m.store[id]
-	if !ok {
-		return nil, fmt.Errorf("file metadata with ID %s not found", id)
+	_, meta, err := m.findFile(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	return meta, nil
+	return meta.Clone(), nil
 }
 
-// GetFileMetadataByPath retrieves file metadata by logical path.
+// GetFileMetadataByPath retrieves a copy of file metadata by logical path.
 func (m *InMemoryMetadataStore) GetFileMetadataByPath(ctx context.Context, logicalPath string) (*FileMetadata, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	id, ok := m.pathIndex[logicalPath]
+	t, err := m.tenantOf(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := t.pathIndex[logicalPath]
 	if !ok {
 		return nil, fmt.Errorf("file metadata with path %s not found", logicalPath)
 	}
-	return m.store[id], nil
+	return t.store[id].Clone(), nil
 }
 
-// ListFileMetadata lists file metadata based on prefix and server ID.
+// ListFileMetadata lists copies of the file metadata under a logical path prefix, ordered
+// by path.
 func (m *InMemoryMetadataStore) ListFileMetadata(ctx context.Context, prefix string) ([]*FileMetadata, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	var results []*FileMetadata
-	for _, meta := range m.store {
-		if prefix == "" || (len(meta.LogicalPath) >= len(prefix) && meta.LogicalPath[:len(prefix)] == prefix) {
-			results = append(results, meta)
+	tenants, err := m.visibleTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*FileMetadata, 0)
+	for _, t := range tenants {
+		for _, meta := range t.store {
+			if strings.HasPrefix(meta.LogicalPath, prefix) {
+				results = append(results, meta.Clone())
+			}
 		}
 	}
+	slices.SortFunc(results, func(a, b *FileMetadata) int {
+		return cmp.Or(strings.Compare(a.LogicalPath, b.LogicalPath), strings.Compare(a.Tenant, b.Tenant))
+	})
 	return results, nil
 }
 
-// UpdateFileMetadata updates existing file metadata.
-func (m *InMemoryMetadataStore) UpdateFileMetadata(ctx context.Context, id string, updates map[string]interface{}) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// QueryFileMetadata returns one page of the files matching a query.
+func (m *InMemoryMetadataStore) QueryFileMetadata(ctx context.Context, q Query) (*Page, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
 
-	meta, ok := m.store[id]
-	if !ok {
-		return fmt.Errorf("file metadata with ID %s not found", id)
-	}
-
-	// Apply updates (simplified, needs robust type checking in production)
-	for k, v := range updates {
-		switch k {
-		case "logical_path":
-			if newPath, ok := v.(string); ok {
-				if _, exists := m.pathIndex[newPath]; exists && m.pathIndex[newPath] != id {
-					return fmt.Errorf("new logical path %s already exists for another file", newPath)
-				}
-				delete(m.pathIndex, meta.LogicalPath)
-				meta.LogicalPath = newPath
-				m.pathIndex[newPath] = id
-			}
-		case "file_name":
-			if newName, ok := v.(string); ok {
-				meta.FileName = newName
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenants, err := m.visibleTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*FileMetadata
+	for _, t := range tenants {
+		for _, meta := range t.store {
+			var acl ACL
+			if q.SharedWith != nil && meta.UploadedBy != q.UploadedBy {
+				acl = EffectiveACL(t.inheritedACL(meta.LogicalPath), meta)
 			}
-		case "content_type":
-			if newType, ok := v.(string); ok {
-				meta.ContentType = newType
+			if !q.Matches(meta, acl) {
+				continue
 			}
-		case "custom_tags":
-			if tags, ok := v.(map[string]string); ok {
-				meta.CustomTags = tags
+			after, err := q.After(meta)
+			if err != nil {
+				return nil, err
 			}
-		case "cloud_copies":
-			if copies, ok := v.(map[string]*storage.FileInfo); ok {
-				meta.CloudCopies = copies
+			if after {
+				matches = append(matches, meta.Clone())
 			}
-			// Add more fields as needed
 		}
 	}
-	return nil
+	slices.SortFunc(matches, q.Compare)
+
+	page := &Page{Files: matches}
+	if len(matches) > q.Limit {
+		page.Files = matches[:q.Limit]
+		page.NextCursor = q.EncodeCursor(page.Files[q.Limit-1])
+	}
+	if page.Files == nil {
+		page.Files = []*FileMetadata{}
+	}
+	return page, nil
+}
+
+// UpdateFileMetadata applies a patch to existing file metadata and bumps its revision.
+// With a non-zero ifRevision the update only happens if the stored revision still
+// matches, otherwise ErrRevisionMismatch is returned. Invalid patches change nothing.
+func (m *InMemoryMetadataStore) UpdateFileMetadata(ctx context.Context, id string, patch Patch, ifRevision int64) (*FileMetadata, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, meta, err := m.findFile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ifRevision != 0 && meta.Revision != ifRevision {
+		return nil, fmt.Errorf("%w: expected revision %d, current is %d", ErrRevisionMismatch, ifRevision, meta.Revision)
+	}
+	if patch.LogicalPath != nil && *patch.LogicalPath != meta.LogicalPath {
+		if _, exists := t.pathIndex[*patch.LogicalPath]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrPathExists, *patch.LogicalPath)
+		}
+		delete(t.pathIndex, meta.LogicalPath)
+		t.pathIndex[*patch.LogicalPath] = id
+	}
+
+	// The patch's maps and pointers stay with the caller
+	updated := patch.Applied(meta).Clone()
+	updated.Revision++
+	t.store[id] = updated
+	return updated.Clone(), nil
 }
 
 // DeleteFileMetadata deletes file metadata by ID.
@@ -152,12 +369,248 @@ func (m *InMemoryMetadataStore) DeleteFileMetadata(ctx context.Context, id strin
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	meta, ok := m.store[id]
-	if !ok {
-		return fmt.Errorf("file metadata with ID %s not found", id)
+	t, meta, err := m.findFile(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	delete(t.store, id)
+	delete(t.pathIndex, meta.LogicalPath)
+	t.addUsage(meta, -1)
+	return nil
+}
+
+// GetServerUsage returns the storage used by the files a server uploaded.
+func (m *InMemoryMetadataStore) GetServerUsage(ctx context.Context, serverID string) (Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenants, err := m.visibleTenants(ctx)
+	if err != nil {
+		return Usage{}, err
 	}
+	var usage Usage
+	for _, t := range tenants {
+		usage.Files += t.byServer[serverID].Files
+		usage.Bytes += t.byServer[serverID].Bytes
+	}
+	return usage, nil
+}
+
+// GetTenantUsage returns the storage used by the files of a tenant.
+func (m *InMemoryMetadataStore) GetTenantUsage(ctx context.Context, tenant string) (Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if ok, err := visible(ctx, tenant); err != nil {
+		return Usage{}, err
+	} else if !ok {
+		return Usage{}, fmt.Errorf("%w: usage of tenant %q", ErrCrossTenant, tenant)
+	}
+	if t, ok := m.tenants[tenant]; ok {
+		return t.usage, nil
+	}
+	return Usage{}, nil
+}
+
+// addUsage adds (sign 1) or removes (sign -1) a file from the usage counters.
+// Callers must hold m.mu.
+func (t *tenantFiles) addUsage(meta *FileMetadata, sign int64) {
+	u := usageOf(meta)
+	server := t.byServer[meta.UploadedBy]
+	server.Files += sign * u.Files
+	server.Bytes += sign * u.Bytes
+	t.byServer[meta.UploadedBy] = server
+
+	t.usage.Files += sign * u.Files
+	t.usage.Bytes += sign * u.Bytes
+}
+
+// CreateFolder records an empty folder. Folders containing files exist implicitly.
+func (m *InMemoryMetadataStore) CreateFolder(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	delete(m.store, id)
-	delete(m.pathIndex, meta.LogicalPath)
+	t, err := m.tenantOf(ctx, true)
+	if err != nil {
+		return err
+	}
+	if t.folders[path] {
+		return fmt.Errorf("%w: %s", ErrFolderExists, path)
+	}
+	t.folders[path] = true
 	return nil
 }
+
+// ListFolder returns the immediate subfolders and files of a folder. Files in the trash
+// are left out and do not make their folders appear.
+func (m *InMemoryMetadataStore) ListFolder(ctx context.Context, path string) (*FolderListing, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.tenantOf(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	listing := &FolderListing{Path: path, Folders: []string{}, Files: []*FileMetadata{}}
+	for _, meta := range t.store {
+		if meta.InTrash() {
+			continue
+		}
+		if child, isFolder, ok := childOf(path, meta.LogicalPath); ok {
+			if isFolder {
+				listing.Folders = append(listing.Folders, child)
+			} else {
+				listing.Files = append(listing.Files, meta.Clone())
+			}
+		}
+	}
+	for folder := range t.folders {
+		if child, _, ok := childOf(path, folder); ok {
+			listing.Folders = append(listing.Folders, child)
+		}
+	}
+
+	slices.Sort(listing.Folders)
+	listing.Folders = slices.Compact(listing.Folders)
+	slices.SortFunc(listing.Files, func(a, b *FileMetadata) int {
+		return strings.Compare(a.LogicalPath, b.LogicalPath)
+	})
+	return listing, nil
+}
+
+// MoveFolder renames every file and folder under from to the same path under to in a
+// single step, failing without changes if any target path is taken. It returns the
+// number of files moved.
+func (m *InMemoryMetadataStore) MoveFolder(ctx context.Context, from, to string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.tenantOf(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	moved := make(map[string]string) // id -> new path
+	for path, id := range t.pathIndex {
+		if rest, ok := strings.CutPrefix(path, from); ok {
+			moved[id] = to + rest
+		}
+	}
+	for _, newPath := range moved {
+		if id, exists := t.pathIndex[newPath]; exists {
+			if _, movesAway := moved[id]; !movesAway {
+				return 0, fmt.Errorf("%w: %s", ErrPathExists, newPath)
+			}
+		}
+	}
+
+	for id := range moved {
+		delete(t.pathIndex, t.store[id].LogicalPath)
+	}
+	for id, newPath := range moved {
+		t.store[id].LogicalPath = newPath
+		t.store[id].Revision++
+		t.pathIndex[newPath] = id
+	}
+	var movedFolders []string
+	for folder := range t.folders {
+		if strings.HasPrefix(folder, from) {
+			movedFolders = append(movedFolders, folder)
+		}
+	}
+	for _, folder := range movedFolders {
+		delete(t.folders, folder)
+	}
+	for _, folder := range movedFolders {
+		t.folders[to+strings.TrimPrefix(folder, from)] = true
+	}
+	t.folders[to] = true // Keep the target even if it was an empty folder
+
+	movedACLs := make(map[string]ACL)
+	for folder, acl := range t.acls {
+		if rest, ok := strings.CutPrefix(folder, from); ok {
+			movedACLs[to+rest] = acl
+			delete(t.acls, folder)
+		}
+	}
+	maps.Copy(t.acls, movedACLs)
+	return len(moved), nil
+}
+
+// DeleteFolder removes the folder records and ACLs at and under path. Files are not
+// affected.
+func (m *InMemoryMetadataStore) DeleteFolder(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.tenantOf(ctx, false)
+	if err != nil {
+		return err
+	}
+	for folder := range t.folders {
+		if strings.HasPrefix(folder, path) {
+			delete(t.folders, folder)
+		}
+	}
+	for folder := range t.acls {
+		if strings.HasPrefix(folder, path) {
+			delete(t.acls, folder)
+		}
+	}
+	return nil
+}
+
+// GetFolderACL returns the entries set on a folder itself, or nil.
+func (m *InMemoryMetadataStore) GetFolderACL(ctx context.Context, path string) (ACL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.tenantOf(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return t.acls[path].Clone(), nil
+}
+
+// SetFolderACL replaces the entries of a folder. They apply to every file under it.
+func (m *InMemoryMetadataStore) SetFolderACL(ctx context.Context, path string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.tenantOf(ctx, true)
+	if err != nil {
+		return err
+	}
+	if len(acl) == 0 {
+		delete(t.acls, path)
+		return nil
+	}
+	t.acls[path] = acl.Clone()
+	return nil
+}
+
+// InheritedACL returns the entries of every folder above a logical path, from the root
+// down.
+func (m *InMemoryMetadataStore) InheritedACL(ctx context.Context, logicalPath string) (ACL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.tenantOf(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return t.inheritedACL(logicalPath).Clone(), nil
+}
+
+// inheritedACL is InheritedACL for callers holding m.mu.
+func (t *tenantFiles) inheritedACL(logicalPath string) ACL {
+	var acl ACL
+	for _, folder := range ancestors(logicalPath) {
+		acl = append(acl, t.acls[folder]...)
+	}
+	return acl
+}
@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"strings"
+	"time"
+
+	"file-manager/storage"
+)
+
+var (
+	// ErrInvalidPatch is returned for patches with unknown, read-only or malformed fields.
+	ErrInvalidPatch = errors.New("invalid metadata patch")
+	// ErrRevisionMismatch is returned when a conditional update targets a stale revision.
+	ErrRevisionMismatch = errors.New("metadata revision mismatch")
+)
+
+// Patch is a partial update of file metadata. Nil fields are left unchanged, so a patch
+// only touches what its caller meant to change.
+type Patch struct {
+	LogicalPath *string
+	FileName    *string
+	ContentType *string
+	CustomTags  map[string]*string // Merged into the tags; a nil value removes the tag
+	ClearTags   bool               // Removes all tags before CustomTags is merged
+
+	ACL              *ACL                         // Replaces the file's ACL; an empty one removes it
+	CloudCopies      map[string]*storage.FileInfo // Replaces all cloud copies when non-nil
+	LegalHold        *LegalHold                   // Places a legal hold
+	ReleaseLegalHold bool
+	DeletedAt        *time.Time // Moves the file to the trash
+	DeletedBy        *string
+	Restore          bool // Takes the file out of the trash
+}
+
+// mergePatchFields are the fields clients may change through a JSON Merge Patch. Every
+// other FileMetadata field is managed by the service.
+var mergePatchFields = []string{"logical_path", "file_name", "content_type", "custom_tags"}
+
+// ParseMergePatch decodes a JSON Merge Patch (RFC 7396) of the client-editable metadata
+// fields. Unknown and read-only fields are rejected rather than ignored, and so is null
+// for fields that cannot be removed.
+func ParseMergePatch(data []byte) (Patch, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Patch{}, fmt.Errorf("%w: body must be a JSON object", ErrInvalidPatch)
+	}
+
+	var patch Patch
+	for name, raw := range fields {
+		if bytes.Equal(raw, []byte("null")) && name != "custom_tags" {
+			return Patch{}, fmt.Errorf("%w: %s cannot be removed", ErrInvalidPatch, name)
+		}
+		var err error
+		switch name {
+		case "logical_path":
+			err = json.Unmarshal(raw, &patch.LogicalPath)
+		case "file_name":
+			err = json.Unmarshal(raw, &patch.FileName)
+		case "content_type":
+			err = json.Unmarshal(raw, &patch.ContentType)
+		case "custom_tags":
+			if bytes.Equal(raw, []byte("null")) {
+				patch.ClearTags = true
+				continue
+			}
+			err = json.Unmarshal(raw, &patch.CustomTags)
+		default:
+			return Patch{}, fmt.Errorf("%w: unknown or read-only field %q (editable: %s)", ErrInvalidPatch, name, strings.Join(mergePatchFields, ", "))
+		}
+		if err != nil {
+			return Patch{}, fmt.Errorf("%w: %s has the wrong type", ErrInvalidPatch, name)
+		}
+	}
+	return patch, nil
+}
+
+// Empty reports whether the patch changes nothing.
+func (p *Patch) Empty() bool {
+	return p.LogicalPath == nil && p.FileName == nil && p.ContentType == nil && p.CustomTags == nil && !p.ClearTags &&
+		p.ACL == nil && p.CloudCopies == nil && p.LegalHold == nil && !p.ReleaseLegalHold &&
+		p.DeletedAt == nil && p.DeletedBy == nil && !p.Restore
+}
+
+// Validate checks the patch values without looking at the stored file.
+func (p *Patch) Validate() error {
+	if p.LogicalPath != nil {
+		logicalPath := *p.LogicalPath
+		if !strings.HasPrefix(logicalPath, "/") || strings.HasSuffix(logicalPath, "/") {
+			return fmt.Errorf("%w: logical_path must start with / and name a file", ErrInvalidPatch)
+		}
+	}
+	if p.FileName != nil && (*p.FileName == "" || strings.Contains(*p.FileName, "/")) {
+		return fmt.Errorf("%w: file_name must be non-empty and must not contain /", ErrInvalidPatch)
+	}
+	if p.ContentType != nil {
+		if _, _, err := mime.ParseMediaType(*p.ContentType); err != nil {
+			return fmt.Errorf("%w: content_type: %v", ErrInvalidPatch, err)
+		}
+	}
+	for k := range p.CustomTags {
+		if k == "" {
+			return fmt.Errorf("%w: custom_tags keys must not be empty", ErrInvalidPatch)
+		}
+	}
+	if p.ACL != nil {
+		if err := p.ACL.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+	}
+	if p.LegalHold != nil && p.ReleaseLegalHold {
+		return fmt.Errorf("%w: cannot place and release a legal hold at once", ErrInvalidPatch)
+	}
+	if p.DeletedAt != nil && p.Restore {
+		return fmt.Errorf("%w: cannot trash and restore a file at once", ErrInvalidPatch)
+	}
+	return nil
+}
+
+// Applied returns a copy of meta with the patch applied, leaving meta unchanged, so the
+// outcome of an update can be checked before it is made.
+func (p *Patch) Applied(meta *FileMetadata) *FileMetadata {
+	copied := meta.Clone()
+	p.apply(copied)
+	return copied
+}
+
+// apply writes the patch onto meta. The logical path index is the store's concern.
+func (p *Patch) apply(meta *FileMetadata) {
+	if p.LogicalPath != nil {
+		meta.LogicalPath = *p.LogicalPath
+	}
+	if p.FileName != nil {
+		meta.FileName = *p.FileName
+	}
+	if p.ContentType != nil {
+		meta.ContentType = *p.ContentType
+	}
+	if p.ClearTags {
+		meta.CustomTags = nil
+	}
+	if len(p.CustomTags) > 0 {
+		tags := maps.Clone(meta.CustomTags)
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		for k, v := range p.CustomTags {
+			if v == nil {
+				delete(tags, k)
+			} else {
+				tags[k] = *v
+			}
+		}
+		if len(tags) == 0 {
+			tags = nil
+		}
+		meta.CustomTags = tags
+	}
+	if p.ACL != nil {
+		meta.ACL = nil
+		if len(*p.ACL) > 0 {
+			meta.ACL = *p.ACL
+		}
+	}
+	if p.CloudCopies != nil {
+		meta.CloudCopies = p.CloudCopies
+	}
+	if p.LegalHold != nil {
+		meta.LegalHold = p.LegalHold
+	}
+	if p.ReleaseLegalHold {
+		meta.LegalHold = nil
+	}
+	if p.DeletedAt != nil {
+		meta.DeletedAt = p.DeletedAt
+	}
+	if p.DeletedBy != nil {
+		meta.DeletedBy = *p.DeletedBy
+	}
+	if p.Restore {
+		meta.DeletedAt = nil
+		meta.DeletedBy = ""
+	}
+}
@@ -0,0 +1,116 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name    string
+		body    string
+		want    Patch
+		invalid bool
+	}{
+		{"rename", `{"file_name": "b.pdf"}`, Patch{FileName: str("b.pdf")}, false},
+		{"move and retype", `{"logical_path": "/x/b.pdf", "content_type": "application/pdf"}`,
+			Patch{LogicalPath: str("/x/b.pdf"), ContentType: str("application/pdf")}, false},
+		{"set and remove tags", `{"custom_tags": {"a": "1", "b": null}}`,
+			Patch{CustomTags: map[string]*string{"a": str("1"), "b": nil}}, false},
+		{"clear tags", `{"custom_tags": null}`, Patch{ClearTags: true}, false},
+		{"empty patch", `{}`, Patch{}, false},
+		{"not an object", `[]`, Patch{}, true},
+		{"read-only field", `{"size": 1}`, Patch{}, true},
+		{"unknown field", `{"colour": "red"}`, Patch{}, true},
+		{"removing a required field", `{"file_name": null}`, Patch{}, true},
+		{"wrong type", `{"file_name": 1}`, Patch{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := ParseMergePatch([]byte(tt.body))
+			if tt.invalid {
+				assert.ErrorIs(t, err, ErrInvalidPatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, patch)
+		})
+	}
+}
+
+func TestUpdateFileMetadata(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name       string
+		patch      Patch
+		ifRevision int64
+		wantErr    error
+		check      func(t *testing.T, meta *FileMetadata)
+	}{
+		{
+			name:  "unconditional update",
+			patch: Patch{FileName: str("b.pdf")},
+			check: func(t *testing.T, meta *FileMetadata) {
+				assert.Equal(t, "b.pdf", meta.FileName)
+				assert.Equal(t, int64(2), meta.Revision)
+			},
+		},
+		{
+			name:       "matching revision",
+			patch:      Patch{CustomTags: map[string]*string{"keep": nil, "new": str("1")}},
+			ifRevision: 1,
+			check: func(t *testing.T, meta *FileMetadata) {
+				assert.Equal(t, map[string]string{"other": "x", "new": "1"}, meta.CustomTags)
+			},
+		},
+		{
+			name:       "stale revision",
+			patch:      Patch{FileName: str("b.pdf")},
+			ifRevision: 7,
+			wantErr:    ErrRevisionMismatch,
+		},
+		{
+			name:    "taken path",
+			patch:   Patch{LogicalPath: str("/docs/taken.pdf")},
+			wantErr: ErrPathExists,
+		},
+		{
+			name:    "invalid path",
+			patch:   Patch{LogicalPath: str("docs/")},
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:  "clear tags",
+			patch: Patch{ClearTags: true},
+			check: func(t *testing.T, meta *FileMetadata) {
+				assert.Nil(t, meta.CustomTags)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithTenant(context.Background(), "clinic")
+			store := NewInMemoryMetadataStore()
+			require.NoError(t, store.CreateFileMetadata(ctx, &FileMetadata{
+				ID: "f", LogicalPath: "/docs/a.pdf", FileName: "a.pdf", Tenant: "clinic",
+				CustomTags: map[string]string{"keep": "y", "other": "x"},
+			}))
+			require.NoError(t, store.CreateFileMetadata(ctx, &FileMetadata{ID: "g", LogicalPath: "/docs/taken.pdf", Tenant: "clinic"}))
+
+			updated, err := store.UpdateFileMetadata(ctx, "f", tt.patch, tt.ifRevision)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				stored, err := store.GetFileMetadata(ctx, "f")
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), stored.Revision, "failed updates change nothing")
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, updated)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package metadata
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery is returned for queries with unknown sort fields or malformed cursors.
+var ErrInvalidQuery = errors.New("invalid metadata query")
+
+// Sort fields supported by Query.SortBy.
+const (
+	SortByUploadedAt  = "uploaded_at"
+	SortByDeletedAt   = "deleted_at"
+	SortBySize        = "size"
+	SortByFileName    = "file_name"
+	SortByLogicalPath = "logical_path"
+)
+
+// TrashFilter selects files by their trash state.
+type TrashFilter int
+
+const (
+	TrashExclude TrashFilter = iota // Only files that are not in the trash (default)
+	TrashOnly                       // Only files in the trash
+	TrashInclude                    // Both
+)
+
+// Query selects, sorts and paginates file metadata. Zero-valued fields do not filter.
+// Stores order results by the sort field, then by ID, so cursors stay stable while files
+// are added or removed; persistent stores map this onto ORDER BY sort_field, id and a
+// keyset condition on the cursor.
+type Query struct {
+	PathPrefix     string
+	Tags           map[string]string // All tags must match
+	ContentType    string            // Exact media type or wildcard such as "image/*"
+	UploadedBy     string
+	SharedWith     *Principal // With UploadedBy, also matches files whose ACL lets the principal read them
+	MinSize        int64
+	MaxSize        int64
+	UploadedAfter  time.Time
+	UploadedBefore time.Time
+	NameContains   string // Case-insensitive substring of FileName
+	Trash          TrashFilter
+
+	SortBy     string // One of the SortBy constants; defaults to SortByUploadedAt
+	Descending bool
+	Limit      int    // Page size; defaults to DefaultPageSize, capped at MaxPageSize
+	Cursor     string // NextCursor of the previous page
+}
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Page is one page of query results.
+type Page struct {
+	Files      []*FileMetadata `json:"files"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// Normalize applies defaults and validates the sort field.
+func (q *Query) Normalize() error {
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByUploadedAt
+	case SortByUploadedAt, SortByDeletedAt, SortBySize, SortByFileName, SortByLogicalPath:
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, q.SortBy)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	q.Limit = min(q.Limit, MaxPageSize)
+	return nil
+}
+
+// Matches reports whether a file passes the query's filters. acl is the file's effective
+// ACL, only needed for files of other servers than UploadedBy when SharedWith is set.
+func (q *Query) Matches(meta *FileMetadata, acl ACL) bool {
+	switch q.Trash {
+	case TrashExclude:
+		if meta.InTrash() {
+			return false
+		}
+	case TrashOnly:
+		if !meta.InTrash() {
+			return false
+		}
+	}
+	if q.PathPrefix != "" && !strings.HasPrefix(meta.LogicalPath, q.PathPrefix) {
+		return false
+	}
+	if q.UploadedBy != "" && meta.UploadedBy != q.UploadedBy && (q.SharedWith == nil || !acl.Grants(*q.SharedWith, AccessRead)) {
+		return false
+	}
+	if q.ContentType != "" && !matchContentType(q.ContentType, meta.ContentType) {
+		return false
+	}
+	if q.MinSize > 0 && meta.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && meta.Size > q.MaxSize {
+		return false
+	}
+	if !q.UploadedAfter.IsZero() && meta.UploadedAt.Before(q.UploadedAfter) {
+		return false
+	}
+	if !q.UploadedBefore.IsZero() && !meta.UploadedAt.Before(q.UploadedBefore) {
+		return false
+	}
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(meta.FileName), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	for k, v := range q.Tags {
+		if meta.CustomTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders two files by the query's sort field and direction, breaking ties by ID.
+func (q *Query) Compare(a, b *FileMetadata) int {
+	c := compareField(q.SortBy, a, b)
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if q.Descending {
+		return -c
+	}
+	return c
+}
+
+func compareField(field string, a, b *FileMetadata) int {
+	switch field {
+	case SortBySize:
+		return cmp.Compare(a.Size, b.Size)
+	case SortByFileName:
+		return cmp.Compare(a.FileName, b.FileName)
+	case SortByLogicalPath:
+		return cmp.Compare(a.LogicalPath, b.LogicalPath)
+	case SortByDeletedAt:
+		return deletedAt(a).Compare(deletedAt(b))
+	default:
+		return a.UploadedAt.Compare(b.UploadedAt)
+	}
+}
+
+func deletedAt(meta *FileMetadata) time.Time {
+	if meta.DeletedAt == nil {
+		return time.Time{}
+	}
+	return *meta.DeletedAt
+}
+
+// cursor records the sort position of the last file of a page.
+type cursor struct {
+	SortBy      string    `json:"s"`
+	Descending  bool      `json:"d,omitempty"`
+	ID          string    `json:"id"`
+	Time        time.Time `json:"t,omitzero"`
+	Size        int64     `json:"n,omitempty"`
+	FileName    string    `json:"f,omitempty"`
+	LogicalPath string    `json:"p,omitempty"`
+}
+
+// EncodeCursor returns the cursor pointing after the given file.
+func (q *Query) EncodeCursor(last *FileMetadata) string {
+	c := cursor{SortBy: q.SortBy, Descending: q.Descending, ID: last.ID}
+	switch q.SortBy {
+	case SortBySize:
+		c.Size = last.Size
+	case SortByFileName:
+		c.FileName = last.FileName
+	case SortByLogicalPath:
+		c.LogicalPath = last.LogicalPath
+	case SortByDeletedAt:
+		c.Time = deletedAt(last)
+	default:
+		c.Time = last.UploadedAt
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// After reports whether a file comes after the query's cursor. Without a cursor every
+// file does.
+func (q *Query) After(meta *FileMetadata) (bool, error) {
+	if q.Cursor == "" {
+		return true, nil
+	}
+	pos, err := q.decodeCursor()
+	if err != nil {
+		return false, err
+	}
+	return q.Compare(meta, pos) > 0, nil
+}
+
+// decodeCursor turns the cursor back into a file holding its sort position.
+func (q *Query) decodeCursor() (*FileMetadata, error) {
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.SortBy != q.SortBy || c.Descending != q.Descending {
+		return nil, fmt.Errorf("%w: cursor belongs to a query with a different sort order", ErrInvalidQuery)
+	}
+
+	pos := &FileMetadata{
+		ID:          c.ID,
+		UploadedAt:  c.Time,
+		Size:        c.Size,
+		FileName:    c.FileName,
+		LogicalPath: c.LogicalPath,
+	}
+	if q.SortBy == SortByDeletedAt {
+		pos.DeletedAt = &c.Time
+	}
+	return pos, nil
+}
+
+// matchContentType matches a media type against an exact type or a "type/*" wildcard,
+// ignoring parameters such as charset.
+func matchContentType(pattern, contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	pattern = strings.ToLower(pattern)
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return pattern == mediaType
+}
@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryFileMetadata(t *testing.T) {
+	ctx := WithTenant(context.Background(), "clinic")
+	store := NewInMemoryMetadataStore()
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := base.Add(time.Hour)
+	for i, meta := range []*FileMetadata{
+		{ID: "a", LogicalPath: "/search/report-10.bin", FileName: "report-10.bin", Size: 10, ContentType: "application/octet-stream", CustomTags: map[string]string{"dept": "x"}},
+		{ID: "b", LogicalPath: "/search/report-20.bin", FileName: "report-20.bin", Size: 20, ContentType: "application/octet-stream"},
+		{ID: "c", LogicalPath: "/search/report-30.bin", FileName: "Report-30.bin", Size: 30, ContentType: "application/octet-stream"},
+		{ID: "d", LogicalPath: "/search/notes.txt", FileName: "notes.txt", Size: 40, ContentType: "text/plain; charset=utf-8", UploadedBy: "other"},
+		{ID: "e", LogicalPath: "/other/report-50.bin", FileName: "report-50.bin", Size: 50, ContentType: "application/octet-stream"},
+		{ID: "f", LogicalPath: "/search/report-60.bin", FileName: "report-60.bin", Size: 60, ContentType: "application/octet-stream", DeletedAt: &deletedAt},
+	} {
+		meta.Tenant = "clinic"
+		meta.UploadedAt = base.Add(time.Duration(i) * time.Minute)
+		if meta.UploadedBy == "" {
+			meta.UploadedBy = "app"
+		}
+		require.NoError(t, store.CreateFileMetadata(ctx, meta))
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"everything but the trash", Query{}, []string{"a", "b", "c", "d", "e"}},
+		{"prefix", Query{PathPrefix: "/search/"}, []string{"a", "b", "c", "d"}},
+		{"name ignores case", Query{NameContains: "REPORT", PathPrefix: "/search/"}, []string{"a", "b", "c"}},
+		{"content type wildcard", Query{ContentType: "text/*"}, []string{"d"}},
+		{"size range", Query{MinSize: 15, MaxSize: 40}, []string{"b", "c", "d"}},
+		{"tag", Query{Tags: map[string]string{"dept": "x"}}, []string{"a"}},
+		{"uploader", Query{UploadedBy: "other"}, []string{"d"}},
+		{"upload time", Query{UploadedAfter: base.Add(time.Minute), UploadedBefore: base.Add(3 * time.Minute)}, []string{"b", "c"}},
+		{"trash only", Query{Trash: TrashOnly}, []string{"f"}},
+		{"descending size", Query{PathPrefix: "/search/", SortBy: SortBySize, Descending: true, Trash: TrashInclude}, []string{"f", "d", "c", "b", "a"}},
+		{"file name", Query{SortBy: SortByFileName}, []string{"c", "d", "a", "b", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := store.QueryFileMetadata(ctx, tt.query)
+			require.NoError(t, err)
+			var ids []string
+			for _, meta := range page.Files {
+				ids = append(ids, meta.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		q := Query{NameContains: "report", MinSize: 15, SortBy: SortBySize, Descending: true, Limit: 2}
+		var ids []string
+		for pages := 1; ; pages++ {
+			page, err := store.QueryFileMetadata(ctx, q)
+			require.NoError(t, err)
+			for _, meta := range page.Files {
+				ids = append(ids, meta.ID)
+			}
+			if page.NextCursor == "" {
+				assert.Equal(t, 2, pages)
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"e", "c", "b"}, ids)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, q := range []Query{
+			{SortBy: "owner"},
+			{Cursor: "not a cursor"},
+			{SortBy: SortBySize, Cursor: (&Query{SortBy: SortByFileName}).EncodeCursor(&FileMetadata{ID: "a"})},
+		} {
+			_, err := store.QueryFileMetadata(ctx, q)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		}
+	})
+}
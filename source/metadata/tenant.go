@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNoTenant is returned by store calls whose context names no tenant, and by calls
+	// on logical paths made with an AllTenants context.
+	ErrNoTenant = errors.New("no tenant in context")
+	// ErrCrossTenant is returned when a call names data of a tenant other than that of
+	// its context.
+	ErrCrossTenant = errors.New("data belongs to another tenant")
+)
+
+type tenantKey struct{}
+
+// tenantScope is the context value set by WithTenant and AllTenants.
+type tenantScope struct {
+	tenant string
+	all    bool
+}
+
+// WithTenant returns a context whose store calls only see the files, folders, ACLs and
+// history of tenant. Tenants have separate namespaces of logical paths.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantScope{tenant: tenant})
+}
+
+// AllTenants returns a context whose store calls span every tenant, for background jobs
+// and storage maintenance. Calls on logical paths still need a single tenant.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantScope{all: true})
+}
+
+// TenantFrom returns the tenant of a context set by WithTenant. all is true for contexts
+// set by AllTenants; contexts without either return ErrNoTenant.
+func TenantFrom(ctx context.Context) (tenant string, all bool, err error) {
+	scope, ok := ctx.Value(tenantKey{}).(tenantScope)
+	if !ok || (!scope.all && scope.tenant == "") {
+		return "", false, ErrNoTenant
+	}
+	return scope.tenant, scope.all, nil
+}
+
+// SingleTenant returns the tenant of a context set by WithTenant, and ErrNoTenant for
+// any other context.
+func SingleTenant(ctx context.Context) (string, error) {
+	tenant, all, err := TenantFrom(ctx)
+	if err == nil && all {
+		err = ErrNoTenant
+	}
+	return tenant, err
+}
+
+// visible reports whether a context may see data of tenant.
+func visible(ctx context.Context, tenant string) (bool, error) {
+	scoped, all, err := TenantFrom(ctx)
+	if err != nil {
+		return false, err
+	}
+	return all || scoped == tenant, nil
+}
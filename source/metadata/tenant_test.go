@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	north := WithTenant(context.Background(), "north")
+	south := WithTenant(context.Background(), "south")
+	store := NewInMemoryMetadataStore()
+	require.NoError(t, store.CreateFileMetadata(north, &FileMetadata{ID: "n", LogicalPath: "/a.pdf", Tenant: "north", UploadedBy: "s1", StoredSize: 10}))
+	require.NoError(t, store.CreateFileMetadata(south, &FileMetadata{ID: "s", LogicalPath: "/a.pdf", Tenant: "south", UploadedBy: "s2", StoredSize: 20}))
+	require.NoError(t, store.SetFolderACL(north, "/", ACL{{Role: "reader", Access: []string{AccessRead}}}))
+
+	tests := []struct {
+		name    string
+		call    func(ctx context.Context) error
+		wantErr error // For the south tenant; the north tenant succeeds
+	}{
+		{"get by ID", func(ctx context.Context) error {
+			_, err := store.GetFileMetadata(ctx, "n")
+			return err
+		}, nil},
+		{"update", func(ctx context.Context) error {
+			name := "b.pdf"
+			_, err := store.UpdateFileMetadata(ctx, "n", Patch{FileName: &name}, 0)
+			return err
+		}, nil},
+		{"delete", func(ctx context.Context) error {
+			return store.DeleteFileMetadata(ctx, "n")
+		}, nil},
+		{"usage of another tenant", func(ctx context.Context) error {
+			_, err := store.GetTenantUsage(ctx, "north")
+			return err
+		}, ErrCrossTenant},
+		{"create for another tenant", func(ctx context.Context) error {
+			return store.CreateFileMetadata(ctx, &FileMetadata{ID: "x", LogicalPath: "/x.pdf", Tenant: "north"})
+		}, ErrCrossTenant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(south)
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("paths are separate namespaces", func(t *testing.T) {
+		meta, err := store.GetFileMetadataByPath(south, "/a.pdf")
+		require.NoError(t, err)
+		assert.Equal(t, "s", meta.ID)
+	})
+	t.Run("listings and queries", func(t *testing.T) {
+		files, err := store.ListFileMetadata(south, "")
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, "s", files[0].ID)
+
+		page, err := store.QueryFileMetadata(south, Query{})
+		require.NoError(t, err)
+		require.Len(t, page.Files, 1)
+		assert.Equal(t, "s", page.Files[0].ID)
+	})
+	t.Run("folder ACLs", func(t *testing.T) {
+		acl, err := store.InheritedACL(south, "/a.pdf")
+		require.NoError(t, err)
+		assert.Empty(t, acl)
+	})
+	t.Run("usage", func(t *testing.T) {
+		usage, err := store.GetTenantUsage(south, "south")
+		require.NoError(t, err)
+		assert.Equal(t, Usage{Files: 1, Bytes: 20}, usage)
+	})
+	t.Run("all tenants", func(t *testing.T) {
+		files, err := store.ListFileMetadata(AllTenants(context.Background()), "")
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+
+		_, err = store.GetFileMetadataByPath(AllTenants(context.Background()), "/a.pdf")
+		assert.ErrorIs(t, err, ErrNoTenant)
+	})
+	t.Run("no tenant", func(t *testing.T) {
+		_, err := store.GetFileMetadata(context.Background(), "n")
+		assert.ErrorIs(t, err, ErrNoTenant)
+	})
+}
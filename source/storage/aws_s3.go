@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
+	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -22,22 +26,56 @@ type AWSS3Adapter struct {
 	region     string
 }
 
+// AWSS3Options configures an AWSS3Adapter. Only Region is required; everything else
+// falls back to the AWS SDK defaults.
+type AWSS3Options struct {
+	Region          string
+	AccessKeyID     string // Static credentials; when empty the default credential chain is used
+	SecretAccessKey string // (environment, shared config profile, then IAM role)
+	Profile         string // Shared config profile to load credentials from
+	EndpointURL     string // Custom S3-compatible endpoint, e.g. MinIO or LocalStack
+	UsePathStyle    bool   // Address buckets as endpoint/bucket/key instead of bucket.endpoint/key
+	CABundle        string // Path to a PEM bundle trusted in addition to the system roots
+}
+
 // NewAWSS3Adapter creates a new AWSS3Adapter instance.
-func NewAWSS3Adapter(region, accessKeyID, secretAccessKey string) (*AWSS3Adapter, error) {
-	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(),
-		awsConfig.WithRegion(region),
-		awsConfig.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-			return aws.Credentials{
-				AccessKeyID:     accessKeyID,
-				SecretAccessKey: secretAccessKey,
-			}, nil
-		})),
-	)
+func NewAWSS3Adapter(opts AWSS3Options) (*AWSS3Adapter, error) {
+	region := opts.Region
+	if region == "" && opts.EndpointURL != "" {
+		region = "us-east-1" // S3-compatible stand-ins still require a signing region
+	}
+
+	var loadOpts []func(*awsConfig.LoadOptions) error
+	if region != "" {
+		loadOpts = append(loadOpts, awsConfig.WithRegion(region))
+	}
+	if opts.AccessKeyID != "" && opts.SecretAccessKey != "" {
+		loadOpts = append(loadOpts, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		))
+	}
+	if opts.Profile != "" {
+		loadOpts = append(loadOpts, awsConfig.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.CABundle != "" {
+		caBundle, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", opts.CABundle, err)
+		}
+		loadOpts = append(loadOpts, awsConfig.WithCustomCABundle(bytes.NewReader(caBundle)))
+	}
+
+	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(), loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS SDK config: %w", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(opts.EndpointURL)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
 	uploader := manager.NewUploader(client)
 	downloader := manager.NewDownloader(client)
 
@@ -45,23 +83,24 @@ func NewAWSS3Adapter(region, accessKeyID, secretAccessKey string) (*AWSS3Adapter
 		client:     client,
 		uploader:   uploader,
 		downloader: downloader,
-		region:     region,
+		region:     cfg.Region,
 	}, nil
 }
 
 // Upload implements the Storage.Upload method for AWS S3.
-func (a *AWSS3Adapter) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string) (*FileInfo, error) {
-	// Convert custom metadata to S3-compatible format (x-amz-meta-)
-	s3Metadata := make(map[string]string)
-	for k, v := range metadata {
-		s3Metadata["x-amz-meta-"+k] = v
-	}
-
+func (a *AWSS3Adapter) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string, opts UploadOptions) (*FileInfo, error) {
+	// The SDK sends each custom metadata key as an x-amz-meta- header
 	uploadInput := &s3.PutObjectInput{
 		Bucket:   aws.String(bucket),
 		Key:      aws.String(key),
 		Body:     data,
-		Metadata: s3Metadata,
+		Metadata: metadata,
+	}
+	if contentType := metadata["Content-Type"]; contentType != "" {
+		uploadInput.ContentType = aws.String(contentType)
+	}
+	if err := applyS3UploadOptions(uploadInput, opts); err != nil {
+		return nil, err
 	}
 
 	// For large files, use the uploader which handles multipart uploads automatically
@@ -78,11 +117,44 @@ func (a *AWSS3Adapter) Upload(ctx context.Context, bucket, key string, data io.R
 		VersionID:      aws.ToString(uploadOutput.VersionID), // Will be nil if versioning is not enabled
 		CustomMetadata: metadata,
 		CloudProvider:  "aws",
+		Bucket:         bucket,
 		StoragePath:    fmt.Sprintf("s3://%s/%s", bucket, key),
+
+		Encryption:         string(uploadOutput.ServerSideEncryption),
+		KMSKeyID:           aws.ToString(uploadOutput.SSEKMSKeyId),
+		StorageClass:       opts.StorageClass,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
 	}
 	return fileInfo, nil
 }
 
+// applyS3UploadOptions maps generic UploadOptions onto an S3 PutObjectInput.
+func applyS3UploadOptions(input *s3.PutObjectInput, opts UploadOptions) error {
+	switch opts.Encryption {
+	case "":
+	case EncryptionManaged:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if opts.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+		}
+	default:
+		return fmt.Errorf("unsupported S3 encryption mode: %s", opts.Encryption)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	return nil
+}
+
 // Download implements the Storage.Download method for AWS S3.
 func (a *AWSS3Adapter) Download(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
 	buff := manager.NewWriteAtBuffer([]byte{})
@@ -136,7 +208,14 @@ func (a *AWSS3Adapter) List(ctx context.Context, bucket, prefix string) ([]*File
 				VersionID:      aws.ToString(headOutput.VersionId),
 				CustomMetadata: customMeta,
 				CloudProvider:  "aws",
+				Bucket:         bucket,
 				StoragePath:    fmt.Sprintf("s3://%s/%s", bucket, *obj.Key),
+
+				Encryption:         string(headOutput.ServerSideEncryption),
+				KMSKeyID:           aws.ToString(headOutput.SSEKMSKeyId),
+				StorageClass:       string(headOutput.StorageClass),
+				CacheControl:       aws.ToString(headOutput.CacheControl),
+				ContentDisposition: aws.ToString(headOutput.ContentDisposition),
 			})
 		}
 	}
@@ -179,7 +258,15 @@ func (a *AWSS3Adapter) GetMetadata(ctx context.Context, bucket, key string) (*Fi
 		VersionID:      aws.ToString(headOutput.VersionId),
 		CustomMetadata: customMeta,
 		CloudProvider:  "aws",
+		Bucket:         bucket,
 		StoragePath:    fmt.Sprintf("s3://%s/%s", bucket, key),
+
+		Encryption:         string(headOutput.ServerSideEncryption),
+		KMSKeyID:           aws.ToString(headOutput.SSEKMSKeyId),
+		StorageClass:       string(headOutput.StorageClass),
+		CacheControl:       aws.ToString(headOutput.CacheControl),
+		ContentDisposition: aws.ToString(headOutput.ContentDisposition),
+		LegalHold:          headOutput.ObjectLockLegalHoldStatus == types.ObjectLockLegalHoldStatusOn,
 	}, nil
 }
 
@@ -202,16 +289,128 @@ func (a *AWSS3Adapter) UpdateMetadata(ctx context.Context, bucket, key string, m
 		newS3Metadata[k] = v
 	}
 
-	// S3 requires a copy operation to update metadata
-	_, err = a.client.CopyObject(ctx, &s3.CopyObjectInput{
+	// S3 requires a copy operation to update metadata. Replacing metadata also resets
+	// encryption, storage class and HTTP headers, so carry them over explicitly.
+	copyInput := &s3.CopyObjectInput{
 		Bucket:            aws.String(bucket),
 		Key:               aws.String(key),
 		CopySource:        aws.String(fmt.Sprintf("/%s/%s", bucket, key)),
 		Metadata:          newS3Metadata,
 		MetadataDirective: types.MetadataDirectiveReplace, // Replace existing metadata
-	})
+	}
+	if existingMeta.ContentType != "" {
+		copyInput.ContentType = aws.String(existingMeta.ContentType)
+	}
+	if existingMeta.Encryption != "" {
+		copyInput.ServerSideEncryption = types.ServerSideEncryption(existingMeta.Encryption)
+	}
+	if existingMeta.KMSKeyID != "" {
+		copyInput.SSEKMSKeyId = aws.String(existingMeta.KMSKeyID)
+	}
+	if existingMeta.StorageClass != "" {
+		copyInput.StorageClass = types.StorageClass(existingMeta.StorageClass)
+	}
+	if existingMeta.CacheControl != "" {
+		copyInput.CacheControl = aws.String(existingMeta.CacheControl)
+	}
+	if existingMeta.ContentDisposition != "" {
+		copyInput.ContentDisposition = aws.String(existingMeta.ContentDisposition)
+	}
+
+	_, err = a.client.CopyObject(ctx, copyInput)
 	if err != nil {
 		return fmt.Errorf("failed to update S3 object metadata via copy: %w", err)
 	}
 	return nil
 }
+
+// Copy implements the Storage.Copy method for AWS S3 using CopyObject.
+// Single-request copies are limited by S3 to objects of up to 5 GB.
+func (a *AWSS3Adapter) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts UploadOptions) (*FileInfo, error) {
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(dstBucket),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(url.PathEscape(srcBucket + "/" + srcKey)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	switch opts.Encryption {
+	case "":
+	case EncryptionManaged:
+		copyInput.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		copyInput.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if opts.KMSKeyID != "" {
+			copyInput.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported S3 encryption mode: %s", opts.Encryption)
+	}
+	if opts.StorageClass != "" {
+		copyInput.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+
+	if _, err := a.client.CopyObject(ctx, copyInput); err != nil {
+		return nil, fmt.Errorf("failed to copy S3 object: %w", err)
+	}
+	return a.GetMetadata(ctx, dstBucket, dstKey)
+}
+
+// PresignDownload implements the Presigner interface for AWS S3.
+func (a *AWSS3Adapter) PresignDownload(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(a.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 download: %w", err)
+	}
+	return req.URL, nil
+}
+
+// TransitionStorageClass implements the Transitioner interface for AWS S3 by copying the
+// object onto itself with the new storage class. Objects in archive classes such as
+// GLACIER must be restored before they can be transitioned again.
+func (a *AWSS3Adapter) TransitionStorageClass(ctx context.Context, bucket, key, storageClass string) (*FileInfo, error) {
+	existing, err := a.GetMetadata(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(url.PathEscape(bucket + "/" + key)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+		StorageClass:      types.StorageClass(storageClass),
+	}
+	// A copy falls back to the bucket's default encryption unless it is requested again
+	if existing.Encryption != "" {
+		copyInput.ServerSideEncryption = types.ServerSideEncryption(existing.Encryption)
+	}
+	if existing.KMSKeyID != "" {
+		copyInput.SSEKMSKeyId = aws.String(existing.KMSKeyID)
+	}
+
+	if _, err := a.client.CopyObject(ctx, copyInput); err != nil {
+		return nil, fmt.Errorf("failed to transition S3 object to %s: %w", storageClass, err)
+	}
+	return a.GetMetadata(ctx, bucket, key)
+}
+
+// SetLegalHold implements the LegalHolder interface using S3 Object Lock legal holds.
+// The bucket must have been created with Object Lock enabled.
+func (a *AWSS3Adapter) SetLegalHold(ctx context.Context, bucket, key string, hold bool) error {
+	status := types.ObjectLockLegalHoldStatusOff
+	if hold {
+		status = types.ObjectLockLegalHoldStatusOn
+	}
+	_, err := a.client.PutObjectLegalHold(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		LegalHold: &types.ObjectLockLegalHold{Status: status},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set S3 object legal hold: %w", err)
+	}
+	return nil
+}
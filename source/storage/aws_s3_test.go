@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAWSS3Adapter runs against MinIO, or the S3 stand-in at S3_ENDPOINT:
+//
+//	docker run -d -p 9000:9000 minio/minio server /data
+//	S3_ENDPOINT=http://localhost:4566 go test ./storage  # LocalStack
+func TestAWSS3Adapter(t *testing.T) {
+	endpoint := envOr("S3_ENDPOINT", "http://localhost:9000")
+	u, err := url.Parse(endpoint)
+	require.NoError(t, err)
+	requireStandIn(t, "S3 stand-in", u.Host)
+
+	a, err := NewAWSS3Adapter(AWSS3Options{
+		EndpointURL:     endpoint,
+		UsePathStyle:    true,
+		AccessKeyID:     envOr("S3_ACCESS_KEY", "minioadmin"),
+		SecretAccessKey: envOr("S3_SECRET_KEY", "minioadmin"),
+	})
+	require.NoError(t, err)
+	bucket := testBucket(t, a,
+		func(ctx context.Context, bucket string) error {
+			_, err := a.client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+			return err
+		},
+		func(ctx context.Context, bucket string) error {
+			_, err := a.client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+			return err
+		})
+
+	t.Run("storage", func(t *testing.T) { testAdapter(t, a, bucket) })
+	t.Run("presign", func(t *testing.T) { testPresign(t, a, bucket) })
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// AzureBlobAdapter implements the Storage interface for Azure Blob Storage.
+// Containers play the role of buckets and blob names the role of keys.
+type AzureBlobAdapter struct {
+	client *azblob.Client
+}
+
+// AzureBlobOptions configures an AzureBlobAdapter. Either ConnectionString or
+// AccountName and AccountKey must be set; a shared key is required for SAS URLs.
+type AzureBlobOptions struct {
+	ConnectionString string // e.g. the Azurite development connection string
+	AccountName      string
+	AccountKey       string
+	EndpointURL      string // Blob service URL; defaults to https://<account>.blob.core.windows.net/
+}
+
+// NewAzureBlobAdapter creates a new AzureBlobAdapter instance.
+func NewAzureBlobAdapter(opts AzureBlobOptions) (*AzureBlobAdapter, error) {
+	if opts.ConnectionString != "" {
+		client, err := azblob.NewClientFromConnectionString(opts.ConnectionString, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure Blob client from connection string: %w", err)
+		}
+		return &AzureBlobAdapter{client: client}, nil
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(opts.AccountName, opts.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure shared key credential: %w", err)
+	}
+	serviceURL := opts.EndpointURL
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", opts.AccountName)
+	}
+	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+	return &AzureBlobAdapter{client: client}, nil
+}
+
+func (a *AzureBlobAdapter) blobClient(bucket, key string) *blockblob.Client {
+	return a.client.ServiceClient().NewContainerClient(bucket).NewBlockBlobClient(key)
+}
+
+// Upload implements the Storage.Upload method for Azure Blob Storage.
+func (a *AzureBlobAdapter) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string, opts UploadOptions) (*FileInfo, error) {
+	contentType := metadata["Content-Type"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	uploadOptions := &blockblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: to.Ptr(contentType),
+		},
+		Metadata: toAzureMetadata(metadata),
+	}
+	if opts.CacheControl != "" {
+		uploadOptions.HTTPHeaders.BlobCacheControl = to.Ptr(opts.CacheControl)
+	}
+	if opts.ContentDisposition != "" {
+		uploadOptions.HTTPHeaders.BlobContentDisposition = to.Ptr(opts.ContentDisposition)
+	}
+	if opts.StorageClass != "" {
+		uploadOptions.AccessTier = to.Ptr(blob.AccessTier(opts.StorageClass))
+	}
+
+	// Azure always encrypts at rest; customer-managed keys are selected through an encryption scope.
+	switch opts.Encryption {
+	case "", EncryptionManaged:
+	case EncryptionKMS:
+		if opts.KMSKeyID == "" {
+			return nil, fmt.Errorf("Azure KMS encryption requires an encryption scope")
+		}
+		uploadOptions.CPKScopeInfo = &blob.CPKScopeInfo{EncryptionScope: to.Ptr(opts.KMSKeyID)}
+	default:
+		return nil, fmt.Errorf("unsupported Azure encryption mode: %s", opts.Encryption)
+	}
+
+	resp, err := a.blobClient(bucket, key).UploadStream(ctx, data, uploadOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file to Azure Blob Storage: %w", err)
+	}
+
+	encryption := EncryptionManaged
+	if deref(resp.EncryptionScope) != "" {
+		encryption = EncryptionKMS
+	}
+
+	return &FileInfo{
+		Name:           key,
+		Size:           size,
+		ContentType:    contentType,
+		LastModified:   deref(resp.LastModified),
+		ETag:           string(deref(resp.ETag)),
+		VersionID:      deref(resp.VersionID), // Empty unless blob versioning is enabled
+		CustomMetadata: metadata,
+		CloudProvider:  "azure",
+		Bucket:         bucket,
+		StoragePath:    fmt.Sprintf("azure://%s/%s", bucket, key),
+
+		Encryption:         encryption,
+		KMSKeyID:           deref(resp.EncryptionScope),
+		StorageClass:       opts.StorageClass,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+	}, nil
+}
+
+// Download implements the Storage.Download method for Azure Blob Storage.
+func (a *AzureBlobAdapter) Download(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	resp, err := a.client.DownloadStream(ctx, bucket, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from Azure Blob Storage: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// List implements the Storage.List method for Azure Blob Storage.
+func (a *AzureBlobAdapter) List(ctx context.Context, bucket, prefix string) ([]*FileInfo, error) {
+	var files []*FileInfo
+	pager := a.client.NewListBlobsFlatPager(bucket, &container.ListBlobsFlatOptions{
+		Prefix:  to.Ptr(prefix),
+		Include: container.ListBlobsInclude{Metadata: true},
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs in Azure Blob Storage: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			name := deref(item.Name)
+			props := item.Properties
+			encryption := EncryptionManaged
+			if deref(props.EncryptionScope) != "" {
+				encryption = EncryptionKMS
+			}
+			files = append(files, &FileInfo{
+				Name:           name,
+				Size:           deref(props.ContentLength),
+				ContentType:    deref(props.ContentType),
+				LastModified:   deref(props.LastModified),
+				ETag:           string(deref(props.ETag)),
+				VersionID:      deref(item.VersionID),
+				CustomMetadata: fromAzureMetadata(item.Metadata),
+				CloudProvider:  "azure",
+				Bucket:         bucket,
+				StoragePath:    fmt.Sprintf("azure://%s/%s", bucket, name),
+
+				Encryption:         encryption,
+				KMSKeyID:           deref(props.EncryptionScope),
+				StorageClass:       string(deref(props.AccessTier)),
+				CacheControl:       deref(props.CacheControl),
+				ContentDisposition: deref(props.ContentDisposition),
+			})
+		}
+	}
+	return files, nil
+}
+
+// Delete implements the Storage.Delete method for Azure Blob Storage.
+func (a *AzureBlobAdapter) Delete(ctx context.Context, bucket, key string) error {
+	_, err := a.client.DeleteBlob(ctx, bucket, key, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file from Azure Blob Storage: %w", err)
+	}
+	return nil
+}
+
+// GetMetadata implements the Storage.GetMetadata method for Azure Blob Storage.
+func (a *AzureBlobAdapter) GetMetadata(ctx context.Context, bucket, key string) (*FileInfo, error) {
+	props, err := a.blobClient(bucket, key).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure blob properties: %w", err)
+	}
+
+	encryption := EncryptionManaged
+	if deref(props.EncryptionScope) != "" {
+		encryption = EncryptionKMS
+	}
+
+	return &FileInfo{
+		Name:           key,
+		Size:           deref(props.ContentLength),
+		ContentType:    deref(props.ContentType),
+		LastModified:   deref(props.LastModified),
+		ETag:           string(deref(props.ETag)),
+		VersionID:      deref(props.VersionID),
+		CustomMetadata: fromAzureMetadata(props.Metadata),
+		CloudProvider:  "azure",
+		Bucket:         bucket,
+		StoragePath:    fmt.Sprintf("azure://%s/%s", bucket, key),
+
+		Encryption:         encryption,
+		KMSKeyID:           deref(props.EncryptionScope),
+		StorageClass:       deref(props.AccessTier),
+		CacheControl:       deref(props.CacheControl),
+		ContentDisposition: deref(props.ContentDisposition),
+		LegalHold:          deref(props.LegalHold),
+	}, nil
+}
+
+// UpdateMetadata implements the Storage.UpdateMetadata method for Azure Blob Storage.
+// Azure replaces the whole metadata set, so new values are merged into the existing ones.
+func (a *AzureBlobAdapter) UpdateMetadata(ctx context.Context, bucket, key string, metadata map[string]string) error {
+	existingMeta, err := a.GetMetadata(ctx, bucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to get existing Azure blob metadata for update: %w", err)
+	}
+
+	merged := make(map[string]string)
+	for k, v := range existingMeta.CustomMetadata {
+		merged[k] = v
+	}
+	for k, v := range metadata {
+		merged[azureMetadataKey(k)] = v
+	}
+
+	_, err = a.blobClient(bucket, key).SetMetadata(ctx, toAzureMetadata(merged), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update Azure blob metadata: %w", err)
+	}
+	return nil
+}
+
+// Copy implements the Storage.Copy method for Azure Blob Storage. The copy is started
+// server-side and polled until it completes. The destination inherits the container's
+// default encryption scope, as Azure cannot change encryption scopes during a copy.
+func (a *AzureBlobAdapter) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts UploadOptions) (*FileInfo, error) {
+	srcURL := a.blobClient(srcBucket, srcKey).URL()
+	dst := a.blobClient(dstBucket, dstKey)
+
+	copyOptions := &blob.StartCopyFromURLOptions{}
+	if opts.StorageClass != "" {
+		copyOptions.Tier = to.Ptr(blob.AccessTier(opts.StorageClass))
+	}
+
+	resp, err := dst.StartCopyFromURL(ctx, srcURL, copyOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Azure blob copy: %w", err)
+	}
+
+	status := deref(resp.CopyStatus)
+	for status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+		props, err := dst.GetProperties(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll Azure blob copy: %w", err)
+		}
+		status = deref(props.CopyStatus)
+	}
+	if status != blob.CopyStatusTypeSuccess {
+		return nil, fmt.Errorf("azure blob copy finished with status %s", status)
+	}
+
+	return a.GetMetadata(ctx, dstBucket, dstKey)
+}
+
+// PresignDownload implements the Presigner interface with a read-only blob SAS URL.
+// The adapter must have been created with a shared key (account key or connection string).
+func (a *AzureBlobAdapter) PresignDownload(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
+	url, err := a.blobClient(bucket, key).BlobClient().GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(expiry), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Azure SAS URL: %w", err)
+	}
+	return url, nil
+}
+
+// azureMetadataKey converts a metadata key into a valid Azure metadata name.
+// Azure requires C# identifiers, so characters such as '-' become '_' (Content-Type -> Content_Type).
+func azureMetadataKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func toAzureMetadata(metadata map[string]string) map[string]*string {
+	azureMeta := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		azureMeta[azureMetadataKey(k)] = to.Ptr(v)
+	}
+	return azureMeta
+}
+
+func fromAzureMetadata(metadata map[string]*string) map[string]string {
+	customMeta := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		customMeta[k] = deref(v)
+	}
+	return customMeta
+}
+
+// deref returns the value p points to, or the zero value when p is nil.
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// TransitionStorageClass implements the Transitioner interface for Azure Blob Storage by
+// changing the blob's access tier. Blobs moved to the Archive tier must be rehydrated
+// before they can be read.
+func (a *AzureBlobAdapter) TransitionStorageClass(ctx context.Context, bucket, key, storageClass string) (*FileInfo, error) {
+	_, err := a.blobClient(bucket, key).SetTier(ctx, blob.AccessTier(storageClass), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set Azure blob access tier to %s: %w", storageClass, err)
+	}
+	return a.GetMetadata(ctx, bucket, key)
+}
+
+// SetLegalHold implements the LegalHolder interface using Azure blob legal holds.
+// The container must have version-level immutability support enabled.
+func (a *AzureBlobAdapter) SetLegalHold(ctx context.Context, bucket, key string, hold bool) error {
+	_, err := a.blobClient(bucket, key).SetLegalHold(ctx, hold, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set Azure blob legal hold: %w", err)
+	}
+	return nil
+}
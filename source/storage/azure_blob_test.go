@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// azuriteConnectionString is the well-known development account of Azurite.
+const azuriteConnectionString = "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;"
+
+// TestAzureBlobAdapter runs against Azurite, or the account in AZURITE_CONNECTION_STRING:
+//
+//	docker run -d -p 10000:10000 mcr.microsoft.com/azure-storage/azurite azurite-blob --blobHost 0.0.0.0
+func TestAzureBlobAdapter(t *testing.T) {
+	connectionString := envOr("AZURITE_CONNECTION_STRING", azuriteConnectionString)
+	var endpoint string
+	for _, setting := range strings.Split(connectionString, ";") {
+		if value, ok := strings.CutPrefix(setting, "BlobEndpoint="); ok {
+			endpoint = value
+		}
+	}
+	u, err := url.Parse(endpoint)
+	require.NoError(t, err)
+	require.NotEmpty(t, u.Host, "the connection string needs a BlobEndpoint")
+	requireStandIn(t, "Azurite", u.Host)
+
+	a, err := NewAzureBlobAdapter(AzureBlobOptions{ConnectionString: connectionString})
+	require.NoError(t, err)
+	bucket := testBucket(t, a,
+		func(ctx context.Context, bucket string) error {
+			_, err := a.client.CreateContainer(ctx, bucket, nil)
+			return err
+		},
+		func(ctx context.Context, bucket string) error {
+			_, err := a.client.DeleteContainer(ctx, bucket, nil)
+			return err
+		})
+
+	t.Run("storage", func(t *testing.T) { testAdapter(t, a, bucket) })
+	t.Run("presign", func(t *testing.T) { testPresign(t, a, bucket) })
+	t.Run("access tier", func(t *testing.T) {
+		ctx := context.Background()
+		content := []byte("cool data")
+		uploaded, err := a.Upload(ctx, bucket, "it/cool.txt", bytes.NewReader(content), int64(len(content)), nil, UploadOptions{StorageClass: "Cool"})
+		require.NoError(t, err)
+		assert.Equal(t, "Cool", uploaded.StorageClass)
+		info, err := a.GetMetadata(ctx, bucket, "it/cool.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "Cool", info.StorageClass)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"time"
 
 	gcs "cloud.google.com/go/storage"
 	"google.golang.org/api/iterator"
@@ -39,7 +40,7 @@ func NewGCSAdapter(projectID, credentialsFile string) (*GCSAdapter, error) {
 }
 
 // Upload implements the Storage.Upload method for GCS.
-func (a *GCSAdapter) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string) (*FileInfo, error) {
+func (a *GCSAdapter) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string, opts UploadOptions) (*FileInfo, error) {
 	obj := a.client.Bucket(bucket).Object(key)
 	wc := obj.NewWriter(ctx)
 
@@ -50,6 +51,21 @@ func (a *GCSAdapter) Upload(ctx context.Context, bucket, key string, data io.Rea
 	}
 	wc.Metadata = metadata // GCS directly supports custom metadata
 
+	// GCS always encrypts at rest with Google-managed keys; only CMEK needs configuring.
+	switch opts.Encryption {
+	case "", EncryptionManaged:
+	case EncryptionKMS:
+		if opts.KMSKeyID == "" {
+			return nil, fmt.Errorf("GCS KMS encryption requires a KMS key name")
+		}
+		wc.KMSKeyName = opts.KMSKeyID
+	default:
+		return nil, fmt.Errorf("unsupported GCS encryption mode: %s", opts.Encryption)
+	}
+	wc.StorageClass = opts.StorageClass
+	wc.CacheControl = opts.CacheControl
+	wc.ContentDisposition = opts.ContentDisposition
+
 	if _, err := io.Copy(wc, data); err != nil {
 		wc.Close() // Ensure writer is closed on error
 		return nil, fmt.Errorf("failed to write data to GCS: %w", err)
@@ -58,8 +74,16 @@ func (a *GCSAdapter) Upload(ctx context.Context, bucket, key string, data io.Rea
 		return nil, fmt.Errorf("failed to close GCS writer: %w", err)
 	}
 
-	attrs := wc.Attrs()
-	fileInfo := &FileInfo{
+	return gcsFileInfo(bucket, wc.Attrs()), nil
+}
+
+// gcsFileInfo converts GCS object attributes into a FileInfo.
+func gcsFileInfo(bucket string, attrs *gcs.ObjectAttrs) *FileInfo {
+	encryption := EncryptionManaged
+	if attrs.KMSKeyName != "" {
+		encryption = EncryptionKMS
+	}
+	return &FileInfo{
 		Name:           attrs.Name,
 		Size:           attrs.Size,
 		ContentType:    attrs.ContentType,
@@ -68,9 +92,16 @@ func (a *GCSAdapter) Upload(ctx context.Context, bucket, key string, data io.Rea
 		VersionID:      strconv.FormatInt(attrs.Generation, 10), // GCS uses generation numbers for versions
 		CustomMetadata: attrs.Metadata,
 		CloudProvider:  "gcp",
-		StoragePath:    fmt.Sprintf("gs://%s/%s", bucket, key),
+		Bucket:         bucket,
+		StoragePath:    fmt.Sprintf("gs://%s/%s", bucket, attrs.Name),
+
+		Encryption:         encryption,
+		KMSKeyID:           attrs.KMSKeyName,
+		StorageClass:       attrs.StorageClass,
+		LegalHold:          attrs.TemporaryHold || attrs.EventBasedHold,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
 	}
-	return fileInfo, nil
 }
 
 // Download implements the Storage.Download method for GCS.
@@ -98,17 +129,7 @@ func (a *GCSAdapter) List(ctx context.Context, bucket, prefix string) ([]*FileIn
 			return nil, fmt.Errorf("failed to list objects in GCS: %w", err)
 		}
 
-		files = append(files, &FileInfo{
-			Name:           attrs.Name,
-			Size:           attrs.Size,
-			ContentType:    attrs.ContentType,
-			LastModified:   attrs.Updated,
-			ETag:           attrs.Etag,
-			VersionID:      strconv.FormatInt(attrs.Generation, 10),
-			CustomMetadata: attrs.Metadata,
-			CloudProvider:  "gcp",
-			StoragePath:    fmt.Sprintf("gs://%s/%s", bucket, attrs.Name),
-		})
+		files = append(files, gcsFileInfo(bucket, attrs))
 	}
 	return files, nil
 }
@@ -129,28 +150,88 @@ func (a *GCSAdapter) GetMetadata(ctx context.Context, bucket, key string) (*File
 		return nil, fmt.Errorf("failed to get GCS object metadata: %w", err)
 	}
 
-	return &FileInfo{
-		Name:           attrs.Name,
-		Size:           attrs.Size,
-		ContentType:    attrs.ContentType,
-		LastModified:   attrs.Updated,
-		ETag:           attrs.Etag,
-		VersionID:      strconv.FormatInt(attrs.Generation, 10),
-		CustomMetadata: attrs.Metadata,
-		CloudProvider:  "gcp",
-		StoragePath:    fmt.Sprintf("gs://%s/%s", bucket, key),
-	}, nil
+	return gcsFileInfo(bucket, attrs), nil
 }
 
 // UpdateMetadata implements the Storage.UpdateMetadata method for GCS.
 func (a *GCSAdapter) UpdateMetadata(ctx context.Context, bucket, key string, metadata map[string]string) error {
 	// GCS allows direct update of metadata
+	update := gcs.ObjectAttrsToUpdate{Metadata: metadata}
+	if contentType, ok := metadata["Content-Type"]; ok {
+		update.ContentType = contentType // Update content type if present
+	}
+	_, err := a.client.Bucket(bucket).Object(key).Update(ctx, update)
+	if err != nil {
+		return fmt.Errorf("failed to update GCS object metadata: %w", err)
+	}
+	return nil
+}
+
+// Copy implements the Storage.Copy method for GCS using a server-side rewrite.
+func (a *GCSAdapter) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts UploadOptions) (*FileInfo, error) {
+	src := a.client.Bucket(srcBucket).Object(srcKey)
+	copier := a.client.Bucket(dstBucket).Object(dstKey).CopierFrom(src)
+
+	switch opts.Encryption {
+	case "", EncryptionManaged:
+	case EncryptionKMS:
+		if opts.KMSKeyID == "" {
+			return nil, fmt.Errorf("GCS KMS encryption requires a KMS key name")
+		}
+		copier.DestinationKMSKeyName = opts.KMSKeyID
+	default:
+		return nil, fmt.Errorf("unsupported GCS encryption mode: %s", opts.Encryption)
+	}
+	copier.StorageClass = opts.StorageClass
+
+	attrs, err := copier.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy GCS object: %w", err)
+	}
+	return gcsFileInfo(dstBucket, attrs), nil
+}
+
+// PresignDownload implements the Presigner interface for GCS using V4 signed URLs.
+// Signing requires credentials with a private key or the IAM signBlob permission.
+func (a *GCSAdapter) PresignDownload(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
+	url, err := a.client.Bucket(bucket).SignedURL(key, &gcs.SignedURLOptions{
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+		Scheme:  gcs.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCS signed URL: %w", err)
+	}
+	return url, nil
+}
+
+// TransitionStorageClass implements the Transitioner interface for GCS by rewriting the
+// object onto itself with the new storage class.
+func (a *GCSAdapter) TransitionStorageClass(ctx context.Context, bucket, key, storageClass string) (*FileInfo, error) {
+	obj := a.client.Bucket(bucket).Object(key)
+	existing, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCS object metadata: %w", err)
+	}
+
+	copier := obj.CopierFrom(obj)
+	copier.StorageClass = storageClass
+	copier.DestinationKMSKeyName = existing.KMSKeyName
+
+	attrs, err := copier.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transition GCS object to %s: %w", storageClass, err)
+	}
+	return gcsFileInfo(bucket, attrs), nil
+}
+
+// SetLegalHold implements the LegalHolder interface using GCS temporary holds.
+func (a *GCSAdapter) SetLegalHold(ctx context.Context, bucket, key string, hold bool) error {
 	_, err := a.client.Bucket(bucket).Object(key).Update(ctx, gcs.ObjectAttrsToUpdate{
-		ContentType: metadata, // Update content type if present
-		Metadata:    metadata, // Update custom metadata
+		TemporaryHold: hold,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update GCS object metadata: %w", err)
+		return fmt.Errorf("failed to set GCS object temporary hold: %w", err)
 	}
 	return nil
 }
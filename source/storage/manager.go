@@ -9,15 +9,26 @@ import (
 type StorageManager struct {
 	adapters     map[string]Storage
 	defaultCloud string
+	router       *Router
 }
 
 // NewStorageManager initializes and returns a new StorageManager.
 func NewStorageManager(cfg *config.AppConfig) (*StorageManager, error) {
 	adapters := make(map[string]Storage)
 
-	// Initialize AWS S3 Adapter
-	if cfg.StorageConfig.AWSAccessKeyID != "" && cfg.StorageConfig.AWSSecretAccessKey != "" {
-		awsAdapter, err := NewAWSS3Adapter(cfg.StorageConfig.AWSRegion, cfg.StorageConfig.AWSAccessKeyID, cfg.StorageConfig.AWSSecretAccessKey)
+	// Initialize AWS S3 Adapter. Static keys are optional: without them the SDK's
+	// default credential chain (environment, shared profile, IAM role) is used.
+	sc := cfg.StorageConfig
+	if (sc.AWSAccessKeyID != "" && sc.AWSSecretAccessKey != "") || sc.AWSProfile != "" || sc.AWSEndpointURL != "" || sc.DefaultCloud == "aws" {
+		awsAdapter, err := NewAWSS3Adapter(AWSS3Options{
+			Region:          sc.AWSRegion,
+			AccessKeyID:     sc.AWSAccessKeyID,
+			SecretAccessKey: sc.AWSSecretAccessKey,
+			Profile:         sc.AWSProfile,
+			EndpointURL:     sc.AWSEndpointURL,
+			UsePathStyle:    sc.AWSUsePathStyle,
+			CABundle:        sc.AWSCABundle,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize AWS S3 adapter: %w", err)
 		}
@@ -34,18 +45,46 @@ func NewStorageManager(cfg *config.AppConfig) (*StorageManager, error) {
 		adapters["gcp"] = gcsAdapter
 	}
 
+	// Initialize Azure Blob Storage Adapter
+	if sc.AzureConnectionString != "" || (sc.AzureStorageAccount != "" && sc.AzureStorageKey != "") {
+		azureAdapter, err := NewAzureBlobAdapter(AzureBlobOptions{
+			ConnectionString: sc.AzureConnectionString,
+			AccountName:      sc.AzureStorageAccount,
+			AccountKey:       sc.AzureStorageKey,
+			EndpointURL:      sc.AzureEndpointURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Azure Blob Storage adapter: %w", err)
+		}
+		adapters["azure"] = azureAdapter
+	}
+
 	if len(adapters) == 0 {
 		return nil, fmt.Errorf("no cloud storage adapters configured. Please check your.env file")
 	}
+	return NewStorageManagerWithAdapters(cfg, adapters)
+}
+
+// NewStorageManagerWithAdapters creates a StorageManager serving adapters that were
+// created elsewhere, e.g. InMemoryStorage, keyed by provider name. The default cloud and
+// the storage routes of cfg must only name those providers.
+func NewStorageManagerWithAdapters(cfg *config.AppConfig, adapters map[string]Storage) (*StorageManager, error) {
+	sc := cfg.StorageConfig
 
 	// Validate default cloud
 	if _, ok := adapters[cfg.StorageConfig.DefaultCloud]; !ok {
 		return nil, fmt.Errorf("default cloud '%s' is not configured or initialized", cfg.StorageConfig.DefaultCloud)
 	}
 
+	router := NewRouter(sc.Routes, sc.Tenants, sc.DefaultCloud, cfg.BucketName)
+	if err := router.validate(adapters); err != nil {
+		return nil, err
+	}
+
 	return &StorageManager{
 		adapters:     adapters,
 		defaultCloud: cfg.StorageConfig.DefaultCloud,
+		router:       router,
 	}, nil
 }
 
@@ -66,3 +105,25 @@ func (sm *StorageManager) GetAdapter(provider string) (Storage, error) {
 func (sm *StorageManager) GetAllAdapters() map[string]Storage {
 	return sm.adapters
 }
+
+// Route returns the provider and bucket an upload should be stored in.
+func (sm *StorageManager) Route(in RouteInput) Route {
+	return sm.router.Resolve(in)
+}
+
+// TenantBuckets returns the buckets uploads of a tenant can be routed to on a provider.
+func (sm *StorageManager) TenantBuckets(tenant, provider string) []string {
+	return sm.router.tenantBuckets(tenant, provider)
+}
+
+// ExclusiveBuckets returns the buckets of TenantBuckets that no other tenant's uploads
+// can be routed to on a provider.
+func (sm *StorageManager) ExclusiveBuckets(tenant, provider string) []string {
+	return sm.router.exclusiveBuckets(tenant, provider)
+}
+
+// Buckets returns the buckets uploads can be routed to on a provider: the default bucket
+// and the buckets and replica buckets of the storage routes and tenants.
+func (sm *StorageManager) Buckets(provider string) []string {
+	return sm.router.buckets(provider)
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrObjectLocked is returned by InMemoryStorage when an object under legal hold would be
+// deleted or overwritten.
+var ErrObjectLocked = errors.New("object is under legal hold")
+
+// InMemoryStorage is a simple in-memory implementation of Storage, Transitioner and
+// LegalHolder that stands in for one cloud provider. Buckets are created on first use.
+// NOT FOR PRODUCTION USE.
+type InMemoryStorage struct {
+	provider string
+	mu       sync.RWMutex
+	buckets  map[string]map[string]*memoryObject // map[bucket]map[key]*memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info FileInfo
+}
+
+// NewInMemoryStorage creates an empty InMemoryStorage reporting its objects as stored on
+// provider, e.g. "aws".
+func NewInMemoryStorage(provider string) *InMemoryStorage {
+	return &InMemoryStorage{provider: provider, buckets: make(map[string]map[string]*memoryObject)}
+}
+
+// object returns a stored object. Callers must hold m.mu.
+func (m *InMemoryStorage) object(bucket, key string) (*memoryObject, error) {
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found in %s bucket %s", key, m.provider, bucket)
+	}
+	return obj, nil
+}
+
+// put stores an object unless a held one is in the way. Callers must hold m.mu.
+func (m *InMemoryStorage) put(bucket, key string, obj *memoryObject) error {
+	if existing, ok := m.buckets[bucket][key]; ok && existing.info.LegalHold {
+		return fmt.Errorf("%w: %s", ErrObjectLocked, key)
+	}
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = make(map[string]*memoryObject)
+	}
+	sum := md5.Sum(obj.data)
+	obj.info.Name = key
+	obj.info.Size = int64(len(obj.data))
+	obj.info.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	obj.info.LastModified = time.Now()
+	obj.info.CloudProvider = m.provider
+	obj.info.Bucket = bucket
+	obj.info.StoragePath = fmt.Sprintf("mem://%s/%s/%s", m.provider, bucket, key)
+	obj.info.LegalHold = false
+	m.buckets[bucket][key] = obj
+	return nil
+}
+
+// Upload stores data as an object, applying the encryption and storage class of opts as is.
+func (m *InMemoryStorage) Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string, opts UploadOptions) (*FileInfo, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	obj := &memoryObject{data: content, info: FileInfo{
+		ContentType:        metadata["Content-Type"],
+		CustomMetadata:     maps.Clone(metadata),
+		Encryption:         opts.Encryption,
+		KMSKeyID:           opts.KMSKeyID,
+		StorageClass:       opts.StorageClass,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+	}}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.put(bucket, key, obj); err != nil {
+		return nil, err
+	}
+	return copyInfo(obj.info), nil
+}
+
+// Download returns the content of an object.
+func (m *InMemoryStorage) Download(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.object(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// List returns the objects of a bucket whose key starts with prefix, sorted by key.
+func (m *InMemoryStorage) List(ctx context.Context, bucket, prefix string) ([]*FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var infos []*FileInfo
+	for _, key := range slices.Sorted(maps.Keys(m.buckets[bucket])) {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, copyInfo(m.buckets[bucket][key].info))
+		}
+	}
+	return infos, nil
+}
+
+// Delete removes an object. Deleting a missing object succeeds, as it does on S3.
+func (m *InMemoryStorage) Delete(ctx context.Context, bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil
+	}
+	if obj.info.LegalHold {
+		return fmt.Errorf("%w: %s", ErrObjectLocked, key)
+	}
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+// GetMetadata returns the info of an object.
+func (m *InMemoryStorage) GetMetadata(ctx context.Context, bucket, key string) (*FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, err := m.object(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return copyInfo(obj.info), nil
+}
+
+// UpdateMetadata replaces the custom metadata of an object.
+func (m *InMemoryStorage) UpdateMetadata(ctx context.Context, bucket, key string, metadata map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, err := m.object(bucket, key)
+	if err != nil {
+		return err
+	}
+	obj.info.CustomMetadata = maps.Clone(metadata)
+	return nil
+}
+
+// Copy copies an object within this provider, keeping its metadata and headers.
+func (m *InMemoryStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts UploadOptions) (*FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	src, err := m.object(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	info := *copyInfo(src.info)
+	info.Encryption, info.KMSKeyID = opts.Encryption, opts.KMSKeyID
+	if opts.StorageClass != "" {
+		info.StorageClass = opts.StorageClass
+	}
+	obj := &memoryObject{data: slices.Clone(src.data), info: info}
+	if err := m.put(dstBucket, dstKey, obj); err != nil {
+		return nil, err
+	}
+	return copyInfo(obj.info), nil
+}
+
+// TransitionStorageClass changes the storage class of an object in place.
+func (m *InMemoryStorage) TransitionStorageClass(ctx context.Context, bucket, key, storageClass string) (*FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, err := m.object(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	obj.info.StorageClass = storageClass
+	return copyInfo(obj.info), nil
+}
+
+// SetLegalHold places or releases the legal hold of an object. Held objects can be
+// neither deleted nor overwritten.
+func (m *InMemoryStorage) SetLegalHold(ctx context.Context, bucket, key string, hold bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, err := m.object(bucket, key)
+	if err != nil {
+		return err
+	}
+	obj.info.LegalHold = hold
+	return nil
+}
+
+// Content returns the stored bytes of an object, or false if it does not exist.
+func (m *InMemoryStorage) Content(bucket, key string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(obj.data), true
+}
+
+func copyInfo(info FileInfo) *FileInfo {
+	info.CustomMetadata = maps.Clone(info.CustomMetadata)
+	return &info
+}
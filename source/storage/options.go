@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"file-manager/config"
+)
+
+// Encryption modes understood by the storage adapters.
+const (
+	// EncryptionManaged uses the provider-managed key (SSE-S3 on AWS; GCS always encrypts with Google-managed keys).
+	EncryptionManaged = "managed"
+	// EncryptionKMS uses a customer-managed key (SSE-KMS on AWS, CMEK on GCS, an encryption scope on Azure).
+	EncryptionKMS = "kms"
+)
+
+// UploadOptions controls how an object is written by a Storage adapter.
+// Empty fields leave the provider default in place.
+type UploadOptions struct {
+	Encryption         string // "", EncryptionManaged or EncryptionKMS
+	KMSKeyID           string // AWS KMS key ARN/ID, GCS Cloud KMS key name or Azure encryption scope
+	StorageClass       string // e.g. STANDARD_IA (AWS), NEARLINE (GCS), Cool (Azure access tier)
+	CacheControl       string
+	ContentDisposition string
+}
+
+// Merge returns a copy of o with every non-empty field of override applied on top.
+func (o UploadOptions) Merge(override UploadOptions) UploadOptions {
+	if override.Encryption != "" {
+		o.Encryption = override.Encryption
+	}
+	if override.KMSKeyID != "" {
+		o.KMSKeyID = override.KMSKeyID
+	}
+	if override.StorageClass != "" {
+		o.StorageClass = override.StorageClass
+	}
+	if override.CacheControl != "" {
+		o.CacheControl = override.CacheControl
+	}
+	if override.ContentDisposition != "" {
+		o.ContentDisposition = override.ContentDisposition
+	}
+	return o
+}
+
+// DefaultUploadOptions returns the configured upload defaults for the given cloud provider
+// and the files of a tenant, whose own keys replace the configured ones.
+func DefaultUploadOptions(cfg config.StorageConfig, provider, tenant string) UploadOptions {
+	opts := UploadOptions{
+		CacheControl:       cfg.CacheControl,
+		ContentDisposition: cfg.ContentDisposition,
+	}
+	switch provider {
+	case "aws":
+		opts.Encryption = cfg.AWSEncryption
+		opts.KMSKeyID = cfg.AWSKMSKeyID
+		opts.StorageClass = cfg.AWSStorageClass
+	case "gcp":
+		opts.KMSKeyID = cfg.GCPKMSKeyName
+		if opts.KMSKeyID != "" {
+			opts.Encryption = EncryptionKMS
+		}
+		opts.StorageClass = cfg.GCPStorageClass
+	case "azure":
+		opts.KMSKeyID = cfg.AzureEncryptionScope
+		if opts.KMSKeyID != "" {
+			opts.Encryption = EncryptionKMS
+		}
+		opts.StorageClass = cfg.AzureAccessTier
+	}
+
+	if key := tenantKey(cfg, provider, tenant); key != "" {
+		opts.Encryption = EncryptionKMS
+		opts.KMSKeyID = key
+	}
+	return opts
+}
+
+// UploadOptionsFor returns the upload defaults of a provider and tenant with the
+// per-request overrides applied. Tenants with a key of their own always get it: requests
+// can neither pick another key nor another encryption mode for them.
+func UploadOptionsFor(cfg config.StorageConfig, provider, tenant string, override UploadOptions) UploadOptions {
+	opts := DefaultUploadOptions(cfg, provider, tenant).Merge(override)
+	if key := tenantKey(cfg, provider, tenant); key != "" {
+		opts.Encryption = EncryptionKMS
+		opts.KMSKeyID = key
+	}
+	return opts
+}
+
+// tenantKey returns the customer-managed key of a tenant on a provider, or "".
+func tenantKey(cfg config.StorageConfig, provider, tenant string) string {
+	ts, ok := cfg.Tenants[tenant]
+	if !ok {
+		return ""
+	}
+	switch provider {
+	case "aws":
+		return ts.AWSKMSKeyID
+	case "gcp":
+		return ts.GCPKMSKeyName
+	case "azure":
+		return ts.AzureEncryptionScope
+	}
+	return ""
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"file-manager/config"
+)
+
+// RouteInput describes an upload for the purpose of picking its bucket.
+type RouteInput struct {
+	Tenant      string
+	ServerID    string
+	LogicalPath string
+	ContentType string
+}
+
+// Route is the storage location selected for an upload.
+type Route struct {
+	Provider       string
+	Bucket         string
+	ReplicaBuckets map[string]string
+	defaultBucket  string
+}
+
+// BucketFor returns the bucket to use on the given provider: the route's bucket on its
+// primary provider, a replica bucket if one is configured, and the default bucket otherwise.
+func (r Route) BucketFor(provider string) string {
+	if provider == r.Provider {
+		return r.Bucket
+	}
+	if bucket, ok := r.ReplicaBuckets[provider]; ok {
+		return bucket
+	}
+	return r.defaultBucket
+}
+
+// Router maps uploads to a provider and bucket using the configured storage routes and
+// tenant storage.
+type Router struct {
+	routes        []config.StorageRoute
+	tenants       map[string]config.TenantStorage
+	defaultCloud  string
+	defaultBucket string
+}
+
+// NewRouter creates a Router. Routes are evaluated in order; uploads matching none of them
+// go to their tenant's storage, or else to the default cloud and bucket. Uploads of tenants
+// with storage of their own only match routes naming the tenant.
+func NewRouter(routes []config.StorageRoute, tenants map[string]config.TenantStorage, defaultCloud, defaultBucket string) *Router {
+	return &Router{
+		routes:        routes,
+		tenants:       tenants,
+		defaultCloud:  defaultCloud,
+		defaultBucket: defaultBucket,
+	}
+}
+
+// Resolve returns the route for an upload.
+func (r *Router) Resolve(in RouteInput) Route {
+	fallback := Route{Provider: r.defaultCloud, Bucket: r.defaultBucket, defaultBucket: r.defaultBucket}
+	ts, dedicated := r.tenants[in.Tenant]
+	if dedicated {
+		fallback = Route{Provider: ts.Provider, Bucket: ts.Bucket, ReplicaBuckets: ts.ReplicaBuckets, defaultBucket: ts.Bucket}
+		if fallback.Provider == "" {
+			fallback.Provider = r.defaultCloud
+		}
+	}
+
+	for _, rule := range r.routes {
+		if (dedicated && rule.Tenant == "") || !routeMatches(rule, in) {
+			continue
+		}
+		route := Route{
+			Provider:       rule.Provider,
+			Bucket:         rule.Bucket,
+			ReplicaBuckets: rule.ReplicaBuckets,
+			defaultBucket:  fallback.defaultBucket,
+		}
+		if route.Provider == "" {
+			route.Provider = r.defaultCloud
+		}
+		if route.Bucket == "" {
+			route.Bucket = fallback.defaultBucket
+		}
+		return route
+	}
+	return fallback
+}
+
+// validate checks that every route and tenant targets a configured provider.
+func (r *Router) validate(adapters map[string]Storage) error {
+	for tenant, ts := range r.tenants {
+		if ts.Bucket == "" {
+			return fmt.Errorf("storage of tenant '%s' has no bucket", tenant)
+		}
+		if ts.Provider != "" {
+			if _, ok := adapters[ts.Provider]; !ok {
+				return fmt.Errorf("storage of tenant '%s' targets unconfigured cloud '%s'", tenant, ts.Provider)
+			}
+		}
+		for provider := range ts.ReplicaBuckets {
+			if _, ok := adapters[provider]; !ok {
+				return fmt.Errorf("storage of tenant '%s' has a replica bucket on unconfigured cloud '%s'", tenant, provider)
+			}
+		}
+	}
+	for i, rule := range r.routes {
+		if rule.Provider != "" {
+			if _, ok := adapters[rule.Provider]; !ok {
+				return fmt.Errorf("storage route %d targets unconfigured cloud '%s'", i, rule.Provider)
+			}
+		}
+		for provider := range rule.ReplicaBuckets {
+			if _, ok := adapters[provider]; !ok {
+				return fmt.Errorf("storage route %d has a replica bucket on unconfigured cloud '%s'", i, provider)
+			}
+		}
+	}
+	return nil
+}
+
+// buckets lists the distinct buckets the router can pick on a provider.
+func (r *Router) buckets(provider string) []string {
+	buckets := []string{r.defaultBucket}
+	add := func(bucket string) {
+		if bucket != "" && !slices.Contains(buckets, bucket) {
+			buckets = append(buckets, bucket)
+		}
+	}
+	for _, rule := range r.routes {
+		ruleProvider := rule.Provider
+		if ruleProvider == "" {
+			ruleProvider = r.defaultCloud
+		}
+		if ruleProvider == provider {
+			add(rule.Bucket)
+		}
+		add(rule.ReplicaBuckets[provider])
+	}
+	for _, ts := range r.tenants {
+		add(ts.Bucket) // Also used on clouds without a replica bucket
+		add(ts.ReplicaBuckets[provider])
+	}
+	return buckets
+}
+
+// tenantBuckets lists the distinct buckets the router can pick on a provider for uploads
+// of a tenant: those of its own storage, or the default bucket, and those of the routes
+// that can apply to it.
+func (r *Router) tenantBuckets(tenant, provider string) []string {
+	var buckets []string
+	add := func(bucket string) {
+		if bucket != "" && !slices.Contains(buckets, bucket) {
+			buckets = append(buckets, bucket)
+		}
+	}
+	ts, dedicated := r.tenants[tenant]
+	if dedicated {
+		add(ts.Bucket)
+		add(ts.ReplicaBuckets[provider])
+	} else {
+		add(r.defaultBucket)
+	}
+	for _, rule := range r.routes {
+		if rule.Tenant != tenant && (dedicated || rule.Tenant != "") {
+			continue
+		}
+		ruleProvider := rule.Provider
+		if ruleProvider == "" {
+			ruleProvider = r.defaultCloud
+		}
+		if ruleProvider == provider {
+			add(rule.Bucket)
+		}
+		add(rule.ReplicaBuckets[provider])
+	}
+	return buckets
+}
+
+// exclusiveBuckets lists the buckets of tenantBuckets that no other tenant can be routed
+// to on a provider, so everything in them belongs to the tenant.
+func (r *Router) exclusiveBuckets(tenant, provider string) []string {
+	others := []string{""} // Tenants without storage of their own and without routes
+	for name := range r.tenants {
+		others = append(others, name)
+	}
+	for _, rule := range r.routes {
+		others = append(others, rule.Tenant)
+	}
+
+	var buckets []string
+	for _, bucket := range r.tenantBuckets(tenant, provider) {
+		shared := slices.ContainsFunc(others, func(other string) bool {
+			return other != tenant && slices.Contains(r.tenantBuckets(other, provider), bucket)
+		})
+		if !shared {
+			buckets = append(buckets, bucket)
+		}
+	}
+	return buckets
+}
+
+func routeMatches(rule config.StorageRoute, in RouteInput) bool {
+	if rule.Tenant != "" && rule.Tenant != in.Tenant {
+		return false
+	}
+	if rule.ServerID != "" && rule.ServerID != in.ServerID {
+		return false
+	}
+	if rule.PathPrefix != "" && !strings.HasPrefix(in.LogicalPath, rule.PathPrefix) {
+		return false
+	}
+	if rule.ContentType != "" {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(in.ContentType, ";")[0]))
+		pattern := strings.ToLower(rule.ContentType)
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			return strings.HasPrefix(mediaType, prefix+"/")
+		}
+		return pattern == mediaType
+	}
+	return true
+}
@@ -16,7 +16,15 @@ type FileInfo struct {
 	VersionID      string            // Cloud-specific version ID (e.g., S3 version ID, GCS generation number)
 	CustomMetadata map[string]string // Custom metadata from the cloud provider
 	CloudProvider  string            // Which cloud provider stores this file
+	Bucket         string            // Bucket/container holding the object
 	StoragePath    string            // The actual path/key in the cloud storage
+
+	Encryption         string // Server-side encryption applied (e.g. AES256, aws:kms, kms)
+	KMSKeyID           string // Customer-managed key used for encryption, if any
+	StorageClass       string // Storage class of the object (e.g. STANDARD_IA, NEARLINE)
+	CacheControl       string
+	ContentDisposition string
+	LegalHold          bool // Cloud-side legal hold (S3 Object Lock, GCS temporary hold, Azure legal hold)
 }
 
 // Storage defines the generic interface for multi-cloud file operations.
@@ -24,8 +32,9 @@ type Storage interface {
 	// Upload uploads a file/object to the specified bucket/container.
 	// `data` is the content of the file, `size` is its length.
 	// `metadata` can include content type, custom headers, etc.
+	// `opts` selects encryption, storage class and HTTP caching headers.
 	// Returns the cloud-specific object key/path and an error.
-	Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string) (*FileInfo, error)
+	Upload(ctx context.Context, bucket, key string, data io.Reader, size int64, metadata map[string]string, opts UploadOptions) (*FileInfo, error)
 
 	// Download retrieves a file/object from the specified bucket/container.
 	// Returns an io.ReadCloser for streaming the content.
@@ -43,4 +52,31 @@ type Storage interface {
 
 	// UpdateMetadata updates metadata for a specific file/object.
 	UpdateMetadata(ctx context.Context, bucket, key string, metadata map[string]string) error
+
+	// Copy performs a server-side copy of an object within this provider.
+	// Custom metadata and HTTP headers are carried over from the source object;
+	// `opts` can change the encryption and storage class of the destination.
+	Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts UploadOptions) (*FileInfo, error)
+}
+
+// Presigner is implemented by adapters that can issue time-limited download URLs
+// (S3 presigned URLs, GCS signed URLs, Azure SAS URLs).
+type Presigner interface {
+	// PresignDownload returns a URL that allows anyone holding it to download the object until expiry.
+	PresignDownload(ctx context.Context, bucket, key string, expiry time.Duration) (string, error)
+}
+
+// Transitioner is implemented by adapters that can change the storage class of an
+// existing object in place, keeping its content, metadata and encryption.
+type Transitioner interface {
+	// TransitionStorageClass moves the object to the given storage class and returns its updated info.
+	TransitionStorageClass(ctx context.Context, bucket, key, storageClass string) (*FileInfo, error)
+}
+
+// LegalHolder is implemented by adapters that can place a cloud-side legal hold on an
+// object, so that the provider itself refuses to delete or overwrite it. The bucket must
+// support it (S3 Object Lock, Azure version-level immutability); GCS supports it everywhere.
+type LegalHolder interface {
+	// SetLegalHold places (hold=true) or releases (hold=false) the legal hold of an object.
+	SetLegalHold(ctx context.Context, bucket, key string, hold bool) error
 }
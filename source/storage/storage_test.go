@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The adapter tests run against local stand-ins for the clouds and are skipped when
+// those are not reachable (or with -short).
+
+// envOr returns the environment variable name, or fallback when it is unset.
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// requireStandIn skips t unless the stand-in called name accepts connections on addr.
+func requireStandIn(t *testing.T, name, addr string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skipf("skipping %s integration test in short mode", name)
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Skipf("%s is not reachable at %s: %v", name, addr, err)
+	}
+	conn.Close()
+}
+
+// testBucket returns a bucket name for one test run. create makes the bucket; remove,
+// which runs when the test ends, deletes it once s has emptied it.
+func testBucket(t *testing.T, s Storage, create, remove func(ctx context.Context, bucket string) error) string {
+	t.Helper()
+	bucket := fmt.Sprintf("file-manager-it-%d", time.Now().UnixNano())
+	require.NoError(t, create(context.Background(), bucket))
+	t.Cleanup(func() {
+		ctx := context.Background()
+		files, err := s.List(ctx, bucket, "")
+		if assert.NoError(t, err) {
+			for _, file := range files {
+				assert.NoError(t, s.Delete(ctx, bucket, file.Name))
+			}
+		}
+		assert.NoError(t, remove(ctx, bucket))
+	})
+	return bucket
+}
+
+func readAll(t *testing.T, rc io.ReadCloser) []byte {
+	t.Helper()
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return data
+}
+
+// testAdapter runs the Storage operations of s against the empty bucket.
+func testAdapter(t *testing.T, s Storage, bucket string) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("file-manager integration test\n"), 2048)
+	meta := map[string]string{"Content-Type": "text/plain", "owner": "calculator"}
+	opts := UploadOptions{CacheControl: "no-cache", ContentDisposition: "attachment"}
+
+	uploaded, err := s.Upload(ctx, bucket, "it/a.txt", bytes.NewReader(content), int64(len(content)), meta, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "it/a.txt", uploaded.Name)
+	assert.Equal(t, bucket, uploaded.Bucket)
+	assert.Equal(t, "no-cache", uploaded.CacheControl)
+
+	rc, err := s.Download(ctx, bucket, "it/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, content, readAll(t, rc))
+
+	info, err := s.GetMetadata(ctx, bucket, "it/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, "no-cache", info.CacheControl)
+	assert.Equal(t, "attachment", info.ContentDisposition)
+	assert.Equal(t, "calculator", info.CustomMetadata["owner"])
+
+	require.NoError(t, s.UpdateMetadata(ctx, bucket, "it/a.txt", map[string]string{"reviewed": "yes"}))
+	info, err = s.GetMetadata(ctx, bucket, "it/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "yes", info.CustomMetadata["reviewed"])
+	assert.Equal(t, "no-cache", info.CacheControl, "updating metadata keeps the HTTP headers")
+
+	copied, err := s.Copy(ctx, bucket, "it/a.txt", bucket, "it/b.txt", UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "it/b.txt", copied.Name)
+	assert.Equal(t, int64(len(content)), copied.Size)
+	assert.Equal(t, "calculator", copied.CustomMetadata["owner"], "the copy keeps the custom metadata")
+	rc, err = s.Download(ctx, bucket, "it/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, content, readAll(t, rc))
+
+	files, err := s.List(ctx, bucket, "it/")
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	assert.ElementsMatch(t, []string{"it/a.txt", "it/b.txt"}, names)
+	files, err = s.List(ctx, bucket, "other/")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	require.NoError(t, s.Delete(ctx, bucket, "it/a.txt"))
+	_, err = s.GetMetadata(ctx, bucket, "it/a.txt")
+	assert.Error(t, err)
+	files, err = s.List(ctx, bucket, "it/")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "it/b.txt", files[0].Name)
+}
+
+// testPresign downloads an object of bucket through a URL presigned by s.
+func testPresign(t *testing.T, s Storage, bucket string) {
+	ctx := context.Background()
+	content := []byte("presigned download")
+	_, err := s.Upload(ctx, bucket, "it/presigned.txt", bytes.NewReader(content), int64(len(content)), map[string]string{"Content-Type": "text/plain"}, UploadOptions{})
+	require.NoError(t, err)
+
+	presigner, ok := s.(Presigner)
+	require.True(t, ok)
+	url, err := presigner.PresignDownload(ctx, bucket, "it/presigned.txt", time.Minute)
+	require.NoError(t, err)
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, content, readAll(t, resp.Body))
+}